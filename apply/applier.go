@@ -1,6 +1,7 @@
 package apply
 
 import (
+	"errors"
 	"fmt"
 
 	jsonpatch "github.com/evanphx/json-patch"
@@ -61,8 +62,13 @@ func (a Applier) Apply(u unstructured.Unstructured, patchFileData []byte) ([]byt
 
 	// Apply the rest of the patches
 	doc, err = patch.Apply(doc)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		// A test operation guarding a replace did not match, the patches were
+		// generated for a different version of the object.
+		return nil, fmt.Errorf("unable to apply patches, the object does not match the patches - %w", err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("unable to apply patches - %v", err)
+		return nil, fmt.Errorf("unable to apply patches - %w", err)
 	}
 
 	//Validate the the doc can still be an unstrucutred Object.
@@ -1,9 +1,11 @@
 package apply_test
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 
+	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/konveyor/crane-lib/apply"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
@@ -114,3 +116,60 @@ func TestApplierApply(t *testing.T) {
 		})
 	}
 }
+
+func TestApplierApplyTestOperation(t *testing.T) {
+	object := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "Deployment",
+			"apiVersion": "apps/v1",
+			"metadata": map[string]interface{}{
+				"name": "test-thing",
+			},
+			"spec": map[string]interface{}{
+				"image": "quay.io/konveyor/app:v1",
+			},
+		},
+	}
+
+	cases := []struct {
+		Name          string
+		Patch         string
+		ExpectedImage string
+		ShouldErr     bool
+	}{
+		{
+			Name: "TestPasses",
+			Patch: `[{"op": "test", "path": "/spec/image", "value": "quay.io/konveyor/app:v1"},
+{"op": "replace", "path": "/spec/image", "value": "registry.example.com/konveyor/app:v1"}]`,
+			ExpectedImage: "registry.example.com/konveyor/app:v1",
+		},
+		{
+			Name: "TestFails",
+			Patch: `[{"op": "test", "path": "/spec/image", "value": "quay.io/konveyor/app:v0"},
+{"op": "replace", "path": "/spec/image", "value": "registry.example.com/konveyor/app:v0"}]`,
+			ShouldErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			doc, err := apply.Applier{}.Apply(*object.DeepCopy(), []byte(c.Patch))
+			if c.ShouldErr {
+				if !errors.Is(err, jsonpatch.ErrTestFailed) {
+					t.Fatalf("expected a failed test operation, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to run apply - %v", err)
+			}
+			u := unstructured.Unstructured{}
+			if err := u.UnmarshalJSON(doc); err != nil {
+				t.Fatalf("unable to use output json - %v", err)
+			}
+			if image, _, _ := unstructured.NestedString(u.Object, "spec", "image"); image != c.ExpectedImage {
+				t.Errorf("incorrect image, actual: %v expected: %v", image, c.ExpectedImage)
+			}
+		})
+	}
+}
@@ -5,7 +5,10 @@ go 1.16
 require (
 	github.com/evanphx/json-patch v4.9.0+incompatible
 	github.com/pkg/errors v0.9.1
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/sirupsen/logrus v1.8.1
+	gopkg.in/yaml.v2 v2.4.0
 	k8s.io/api v0.21.1
 	k8s.io/apimachinery v0.21.1
+	sigs.k8s.io/yaml v1.2.0
 )
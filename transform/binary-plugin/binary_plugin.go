@@ -1,10 +1,19 @@
 package binary_plugin
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/konveyor/crane-lib/transform"
 	"github.com/sirupsen/logrus"
@@ -13,66 +22,408 @@ import (
 
 type BinaryPlugin struct {
 	commandRunner
-	log logrus.FieldLogger
+	path  string
+	log   logrus.FieldLogger
+	retry RetryPolicy
+	sleep func(time.Duration)
+
+	// queryProtocolVersion, when set, is used to negotiate the protocol
+	// version before the first run.
+	queryProtocolVersion func(ctx context.Context) (string, error)
+	versionLock          sync.Mutex
+	protocolVersion      string
+}
+
+// ProtocolVersion is the version of the protocol BinaryPlugin speaks: the
+// object is written to the plugin's stdin as JSON and a PluginResponse is
+// read back from its stdout.
+const ProtocolVersion = "v1"
+
+// EnvelopeProtocolVersion is the version of the protocol where the plugin's
+// stdin carries a transform.PluginRequest, the object along with the source
+// context of the run, if any, instead of the bare object. It is only spoken
+// with plugins reporting it when the protocol version is negotiated, see
+// WithProtocolVersionCheck, the others are sent the bare object.
+const EnvelopeProtocolVersion = "v2"
+
+// supportedProtocolVersions are the plugin protocol versions BinaryPlugin can
+// run.
+var supportedProtocolVersions = map[string]bool{
+	ProtocolVersion:         true,
+	EnvelopeProtocolVersion: true,
+}
+
+// UnsupportedProtocolVersionError is returned when a plugin reports a
+// protocol version BinaryPlugin does not support.
+type UnsupportedProtocolVersionError struct {
+	Path    string
+	Version string
+}
+
+func (e *UnsupportedProtocolVersionError) Error() string {
+	return fmt.Sprintf("plugin %v uses unsupported protocol version %q", e.Path, e.Version)
+}
+
+// ErrorClass classifies the failures to run the plugin process, so that a
+// RetryPolicy can name the ones worth retrying.
+type ErrorClass string
+
+const (
+	// ErrorClassStart is a failure to start the plugin process, e.g. when
+	// the system is out of resources.
+	ErrorClassStart ErrorClass = "Start"
+	// ErrorClassExit is the plugin process exiting with a non-zero status or
+	// being killed, e.g. by the OOM killer.
+	ErrorClassExit ErrorClass = "Exit"
+)
+
+// runError is a failure to run the plugin process.
+type runError struct {
+	class ErrorClass
+	err   error
 }
 
-func NewBinaryPlugin(path string) transform.Plugin {
-	return &BinaryPlugin{commandRunner: &binaryRunner{path: path}, log: logrus.New().WithField("path", path)}
+func (e *runError) Error() string {
+	return e.err.Error()
+}
+
+func (e *runError) Unwrap() error {
+	return e.err
+}
+
+// RetryPolicy controls how often a plugin run that failed with a retryable
+// error is attempted. Only the failures to run the plugin process of the
+// classes listed in RetryOn are retried. Errors reported by the plugin on
+// stderr and invalid responses are considered deterministic and are never
+// retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, values below 1 mean a
+	// single attempt.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, it doubles for every
+	// subsequent retry.
+	Backoff time.Duration
+	// RetryOn lists the classes of errors that are retried. Plugins that
+	// exit with a non-zero status for deterministic failures should not
+	// list ErrorClassExit.
+	RetryOn []ErrorClass
+}
+
+// retries reports whether the policy retries err.
+func (p RetryPolicy) retries(err error) bool {
+	var runErr *runError
+	if !errors.As(err, &runErr) {
+		return false
+	}
+	for _, class := range p.RetryOn {
+		if class == runErr.class {
+			return true
+		}
+	}
+	return false
+}
+
+// Option configures a BinaryPlugin.
+type Option func(*BinaryPlugin)
+
+// WithRetryPolicy retries failed plugin runs according to the given policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(b *BinaryPlugin) {
+		b.retry = policy
+	}
+}
+
+// WithProtocolVersionCheck makes the plugin negotiate the protocol version
+// before it is first run: the binary is called with "--protocol-version" and
+// must print the version of the protocol it speaks. Plugins reporting an
+// unsupported version are refused with an UnsupportedProtocolVersionError.
+// The negotiated version is cached for the following runs.
+func WithProtocolVersionCheck() Option {
+	return func(b *BinaryPlugin) {
+		b.queryProtocolVersion = func(ctx context.Context) (string, error) {
+			return queryProtocolVersion(ctx, b.path)
+		}
+	}
+}
+
+// NewBinaryPlugin returns a plugin running the binary at path. Plain names,
+// and on Windows paths without an extension, are resolved like a shell would
+// through exec.LookPath, so that the same plugin name works on every OS
+// (e.g. "my-plugin" resolves to "my-plugin.exe" on Windows). When the
+// lookup fails the path is used as is.
+func NewBinaryPlugin(path string, opts ...Option) transform.Plugin {
+	path = resolvePluginPath(path)
+	b := &BinaryPlugin{commandRunner: &binaryRunner{path: path}, path: path, log: logrus.New().WithField("path", path)}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+var _ transform.ContextPlugin = &BinaryPlugin{}
+
+// String returns the path of the plugin binary, which the Runner includes in
+// the errors of the plugin.
+func (b *BinaryPlugin) String() string {
+	return b.path
 }
 
 func (b *BinaryPlugin) Run(u *unstructured.Unstructured) (transform.PluginResponse, error) {
+	return b.RunContext(context.Background(), u)
+}
+
+// RunContext runs the plugin binary, killing it if ctx is cancelled before it
+// exits. No retries are attempted once ctx is cancelled, including while
+// waiting for the next attempt. The source context carried by ctx, if any,
+// is passed to plugins speaking the EnvelopeProtocolVersion.
+func (b *BinaryPlugin) RunContext(ctx context.Context, u *unstructured.Unstructured) (transform.PluginResponse, error) {
+	version, err := b.checkProtocolVersion(ctx)
+	if err != nil {
+		return transform.PluginResponse{}, err
+	}
+	request := pluginRequest(ctx, u, version)
 	p := transform.PluginResponse{}
 
-	out, errBytes, err := b.commandRunner.Run(u, b.log)
+	// The response is decoded while the plugin writes it, rather than
+	// buffering all of stdout first.
+	var decodeErr error
+	readStdout := func(stdout io.Reader) {
+		p = transform.PluginResponse{}
+		decodeErr = json.NewDecoder(stdout).Decode(&p)
+	}
+	errBytes, err := b.commandRunner.Run(ctx, request, readStdout, b.log)
+	backoff := b.retry.Backoff
+	for attempt := 1; err != nil && b.retry.retries(err) && attempt < b.retry.MaxAttempts; attempt++ {
+		b.log.Warnf("error running the plugin command, retrying in %v: %v", backoff, err)
+		if b.wait(ctx, backoff) != nil {
+			break
+		}
+		backoff *= 2
+		errBytes, err = b.commandRunner.Run(ctx, request, readStdout, b.log)
+	}
 	if err != nil {
 		b.log.Errorf("error running the plugin command")
-		return p, fmt.Errorf("error running the plugin command: %v", err)
+		return transform.PluginResponse{}, fmt.Errorf("error running the plugin command: %v", err)
 	}
 
 	if len(errBytes) != 0 {
 		b.log.Errorf("error from plugin binary")
-		return p, fmt.Errorf("error from plugin binary: %s", string(errBytes))
+		return transform.PluginResponse{}, fmt.Errorf("error from plugin binary: %s", string(errBytes))
 	}
 
-	err = json.Unmarshal(out, &p)
-	if err != nil {
+	if decodeErr != nil {
 		b.log.Errorf("unable to decode json sent by the plugin")
-		return p, fmt.Errorf("unable to decode json sent by the plugin: %s, err: %v", string(out), err)
+		return transform.PluginResponse{}, fmt.Errorf("unable to decode json sent by the plugin, err: %v", decodeErr)
 	}
 
 	return p, nil
 }
 
+// checkProtocolVersion negotiates the protocol version on first use when
+// WithProtocolVersionCheck is set. Once the plugin reported its version, the
+// outcome is cached, failures to query it are retried on the next run. It
+// returns the version to speak, ProtocolVersion when it is not negotiated.
+func (b *BinaryPlugin) checkProtocolVersion(ctx context.Context) (string, error) {
+	if b.queryProtocolVersion == nil {
+		return ProtocolVersion, nil
+	}
+	b.versionLock.Lock()
+	defer b.versionLock.Unlock()
+	if b.protocolVersion == "" {
+		version, err := b.queryProtocolVersion(ctx)
+		if err != nil {
+			b.log.Errorf("unable to negotiate the plugin protocol version")
+			return "", fmt.Errorf("unable to negotiate the plugin protocol version, err: %v", err)
+		}
+		b.protocolVersion = version
+	}
+	if !supportedProtocolVersions[b.protocolVersion] {
+		return "", &UnsupportedProtocolVersionError{Path: b.path, Version: b.protocolVersion}
+	}
+	return b.protocolVersion, nil
+}
+
+// queryProtocolVersion runs the plugin binary with "--protocol-version" and
+// returns the version it prints.
+func queryProtocolVersion(ctx context.Context, path string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, path, "--protocol-version")
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		return "", fmt.Errorf("%v, stderr: %s", err, stderr.String())
+	}
+	version := strings.TrimSpace(stdout.String())
+	if version == "" {
+		return "", fmt.Errorf("the plugin did not report a protocol version")
+	}
+	return version, nil
+}
+
+// resolvePluginPath resolves path through exec.LookPath unless it is already
+// a relative or absolute path with an extension.
+func resolvePluginPath(path string) string {
+	if strings.ContainsAny(path, `/\`) && filepath.Ext(path) != "" {
+		return path
+	}
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return path
+	}
+	return resolved
+}
+
+// wait waits for d, or until ctx is cancelled in which case it returns
+// ctx.Err().
+func (b *BinaryPlugin) wait(ctx context.Context, d time.Duration) error {
+	if b.sleep != nil {
+		b.sleep(d)
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 type commandRunner interface {
-	Run(u *unstructured.Unstructured, log logrus.FieldLogger) ([]byte, []byte, error)
+	// Run runs the plugin with the request, see pluginRequest, as its stdin,
+	// handing the plugin's stdout to readStdout as it is produced. It returns
+	// what the plugin wrote to stderr.
+	Run(ctx context.Context, request map[string]interface{}, readStdout func(io.Reader), log logrus.FieldLogger) ([]byte, error)
 }
 
 type binaryRunner struct {
 	path string
+	// wrapStdin, when set, wraps the writer the object is encoded to, so
+	// tests can observe how it is written.
+	wrapStdin func(io.Writer) io.Writer
 }
 
-func (b *binaryRunner) Run(u *unstructured.Unstructured, log logrus.FieldLogger) ([]byte, []byte, error) {
-	objJson, err := u.MarshalJSON()
+func (b *binaryRunner) Run(ctx context.Context, request map[string]interface{}, readStdout func(io.Reader), log logrus.FieldLogger) ([]byte, error) {
+	command := exec.CommandContext(ctx, b.path)
+
+	// set var to get the errors
+	var errorBytes bytes.Buffer
+	command.Stderr = &errorBytes
+
+	stdin, err := command.StdinPipe()
 	if err != nil {
-		log.Errorf("unable to marshal unstructured Object")
-		return nil, nil, fmt.Errorf("unable to marshal unstructured Object: %s, err: %v", u, err)
+		return nil, &runError{class: ErrorClassStart, err: fmt.Errorf("unable to create the plugin stdin pipe, err: %v", err)}
+	}
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, &runError{class: ErrorClassStart, err: fmt.Errorf("unable to create the plugin stdout pipe, err: %v", err)}
 	}
 
-	command := exec.Command(b.path)
+	err = command.Start()
+	if err != nil {
+		log.Errorf("unable to run the plugin binary")
+		return nil, &runError{class: ErrorClassStart, err: fmt.Errorf("unable to run the plugin binary, err: %v", err)}
+	}
 
-	// set var to get the output
-	var out bytes.Buffer
-	var errorBytes bytes.Buffer
+	// Encode the object in the background so a plugin that writes before it
+	// has read all of its input does not dead lock.
+	encodeErr := make(chan error, 1)
+	go func() {
+		var w io.Writer = stdin
+		if b.wrapStdin != nil {
+			w = b.wrapStdin(w)
+		}
+		encodeErr <- encodeObject(w, request)
+		stdin.Close()
+	}()
 
-	// set the output to our variable
-	command.Stdout = &out
-	command.Stdin = bytes.NewBuffer(objJson)
-	command.Stderr = &errorBytes
-	err = command.Run()
+	readStdout(stdout)
+	// Drain anything the plugin wrote after the response so it can exit.
+	_, _ = io.Copy(io.Discard, stdout)
+
+	err = command.Wait()
+	if marshalErr := <-encodeErr; marshalErr != nil {
+		log.Errorf("unable to marshal unstructured Object")
+		return nil, fmt.Errorf("unable to marshal unstructured Object: %s, err: %v", request, marshalErr)
+	}
 	if err != nil {
 		log.Errorf("unable to run the plugin binary")
-		return nil, nil, fmt.Errorf("unable to run the plugin binary, err: %v", err)
+		return nil, &runError{class: ErrorClassExit, err: fmt.Errorf("unable to run the plugin binary, err: %v", err)}
 	}
 
-	return out.Bytes(), errorBytes.Bytes(), nil
+	return errorBytes.Bytes(), nil
+}
+
+// encodeObject writes the JSON encoding of the object to w while walking it,
+// rather than marshaling all of it in memory first: only the values that are
+// neither maps nor slices are marshaled on their own. It returns the errors
+// marshaling the values, errors writing to w surface as a failure of the
+// plugin process instead.
+func encodeObject(w io.Writer, object map[string]interface{}) error {
+	buffered := bufio.NewWriter(w)
+	if err := encodeValue(buffered, object); err != nil {
+		return err
+	}
+	_ = buffered.Flush()
+	return nil
+}
+
+func encodeValue(w *bufio.Writer, value interface{}) error {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		// Sort the keys like encoding/json does.
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		w.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := encodeValue(w, key); err != nil {
+				return err
+			}
+			w.WriteByte(':')
+			if err := encodeValue(w, value[key]); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('}')
+	case []interface{}:
+		w.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := encodeValue(w, item); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+	default:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		w.Write(b)
+	}
+	return nil
+}
+
+// pluginRequest returns the document written to the plugin's stdin for the
+// object: the object itself, or for plugins speaking the
+// EnvelopeProtocolVersion a transform.PluginRequest carrying it along with
+// the source context of ctx, if any.
+func pluginRequest(ctx context.Context, u *unstructured.Unstructured, protocolVersion string) map[string]interface{} {
+	if protocolVersion != EnvelopeProtocolVersion {
+		return u.Object
+	}
+	request := map[string]interface{}{"object": u.Object}
+	if source, ok := transform.SourceContextFrom(ctx); ok {
+		request["sourceContext"] = source
+	}
+	return request
 }
@@ -1,22 +1,127 @@
 package binary_plugin
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/transform/cli"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
+const helperPluginEnv = "BINARY_PLUGIN_TEST_HELPER"
+
+// TestMain lets the test binary act as a plugin binary when helperPluginEnv
+// is set, so the real binaryRunner can be exercised. Setting it to "stream"
+// runs a streaming plugin instead, and to "source" a plugin reporting its
+// source context.
+func TestMain(m *testing.M) {
+	switch os.Getenv(helperPluginEnv) {
+	case "1":
+		runHelperPlugin()
+		os.Exit(0)
+	case "stream":
+		runStreamingHelperPlugin()
+		os.Exit(0)
+	case "source":
+		runSourceHelperPlugin()
+		os.Exit(0)
+	case "size":
+		runSizeHelperPlugin()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runHelperPlugin echoes the object's data back as a replace patch.
+func runHelperPlugin() {
+	if len(os.Args) > 1 && os.Args[1] == "--protocol-version" {
+		fmt.Fprintln(os.Stdout, ProtocolVersion)
+		return
+	}
+	u := unstructured.Unstructured{}
+	if err := json.NewDecoder(os.Stdin).Decode(&u); err != nil {
+		fmt.Fprint(os.Stderr, err.Error())
+		return
+	}
+	data, _, _ := unstructured.NestedString(u.Object, "data", "big")
+	value, _ := json.Marshal(data)
+	fmt.Fprintf(os.Stdout, `{"version": "v1", "patches": [{"op": "replace", "path": "/data/big", "value": %s}]}`, value)
+}
+
+// runSizeHelperPlugin reports the number of data keys of the object and the
+// total length of their values as annotations.
+func runSizeHelperPlugin() {
+	u := unstructured.Unstructured{}
+	if err := json.NewDecoder(os.Stdin).Decode(&u); err != nil {
+		fmt.Fprint(os.Stderr, err.Error())
+		return
+	}
+	data, _, _ := unstructured.NestedStringMap(u.Object, "data")
+	size := 0
+	for _, value := range data {
+		size += len(value)
+	}
+	fmt.Fprintf(os.Stdout, `{"version": "v1", "patches": [{"op": "add", "path": "/metadata/annotations/keys", "value": "%v"}, {"op": "add", "path": "/metadata/annotations/size", "value": "%v"}]}`, len(data), size)
+}
+
+// runSourceHelperPlugin speaks the envelope protocol and reports the source
+// context it was run with as add patches, one per field that is set, and
+// whether the object it decoded still holds the request's fields.
+func runSourceHelperPlugin() {
+	if len(os.Args) > 1 && os.Args[1] == "--protocol-version" {
+		fmt.Fprintln(os.Stdout, EnvelopeProtocolVersion)
+		return
+	}
+	u, source, err := cli.UnstructuredWithSourceContext(os.Stdin)
+	if err != nil {
+		fmt.Fprint(os.Stderr, err.Error())
+		return
+	}
+	fields := map[string]string{}
+	if source != nil {
+		fields = map[string]string{"cluster": source.Cluster, "namespace": source.Namespace, "migrationID": source.MigrationID}
+	}
+	for _, field := range []string{"object", "sourceContext"} {
+		if _, ok := u.Object[field]; ok {
+			fields["leaked"] = "true"
+		}
+	}
+	resp := transform.PluginResponse{Version: "v1"}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		patch, _ := jsonpatch.DecodePatch([]byte(fmt.Sprintf(`[{"op": "add", "path": "/metadata/annotations/%v", "value": %q}]`, name, value)))
+		resp.Patches = append(resp.Patches, patch...)
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(resp)
+}
+
 type fakeCommandRunner struct {
 	stdout, stderr      []byte
 	errorRunningCommand error
 }
 
-func (f *fakeCommandRunner) Run(_ *unstructured.Unstructured, _ logrus.FieldLogger) ([]byte, []byte, error) {
-	return f.stdout, f.stderr, f.errorRunningCommand
+func (f *fakeCommandRunner) Run(_ context.Context, _ map[string]interface{}, readStdout func(io.Reader), _ logrus.FieldLogger) ([]byte, error) {
+	if f.errorRunningCommand != nil {
+		return nil, f.errorRunningCommand
+	}
+	readStdout(bytes.NewReader(f.stdout))
+	return f.stderr, nil
 }
 
 func TestBinaryPlugin_Run(t *testing.T) {
@@ -80,3 +185,513 @@ func TestBinaryPlugin_Run(t *testing.T) {
 		})
 	}
 }
+
+func TestBinaryPlugin_RunLargeObject(t *testing.T) {
+	os.Setenv(helperPluginEnv, "1")
+	defer os.Unsetenv(helperPluginEnv)
+
+	big := strings.Repeat("0123456789abcdef", 4*1024*1024/16)
+	u := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"data": map[string]interface{}{
+				"big": big,
+			},
+		},
+	}
+
+	p := NewBinaryPlugin(os.Args[0])
+	resp, err := p.Run(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Patches) != 1 {
+		t.Fatalf("expected a single patch, got %v", len(resp.Patches))
+	}
+	value, err := resp.Patches[0].ValueInterface()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != big {
+		t.Errorf("patch value does not match the object sent to the plugin, length: %v expected: %v", len(fmt.Sprint(value)), len(big))
+	}
+}
+
+// maxWriteRecorder records the largest write to w.
+type maxWriteRecorder struct {
+	w   io.Writer
+	max int
+}
+
+func (m *maxWriteRecorder) Write(p []byte) (int, error) {
+	if len(p) > m.max {
+		m.max = len(p)
+	}
+	return m.w.Write(p)
+}
+
+func TestBinaryPlugin_RunStreamsObject(t *testing.T) {
+	os.Setenv(helperPluginEnv, "size")
+	defer os.Unsetenv(helperPluginEnv)
+
+	value := strings.Repeat("0123456789abcdef", 64*1024/16)
+	data := map[string]interface{}{}
+	for i := 0; i < 64; i++ {
+		data[fmt.Sprintf("key-%v", i)] = value
+	}
+	u := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"data":       data,
+		},
+	}
+
+	recorder := &maxWriteRecorder{}
+	b := NewBinaryPlugin(os.Args[0]).(*BinaryPlugin)
+	b.commandRunner = &binaryRunner{
+		path: os.Args[0],
+		wrapStdin: func(w io.Writer) io.Writer {
+			recorder.w = w
+			return recorder
+		},
+	}
+	resp, err := b.Run(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, op := range resp.Patches {
+		path, err := op.Path()
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := op.ValueInterface()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[strings.TrimPrefix(path, "/metadata/annotations/")] = fmt.Sprint(value)
+	}
+	want := map[string]string{"keys": "64", "size": fmt.Sprint(64 * len(value))}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("object received by the plugin = %v, want %v", got, want)
+	}
+	// The object is written value by value, it is never held in a
+	// single buffer.
+	if recorder.max == 0 || recorder.max > 2*len(value) {
+		t.Errorf("largest write to the plugin stdin = %v bytes, want at most %v", recorder.max, 2*len(value))
+	}
+}
+
+func TestEncodeObject(t *testing.T) {
+	u := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":   "cm",
+				"labels": map[string]interface{}{"app": "<web>"},
+			},
+			"data": map[string]interface{}{
+				"text": "line\n\"quoted\"",
+			},
+			"list":  []interface{}{int64(1), 2.5, true, nil, map[string]interface{}{}, []interface{}{}},
+			"empty": map[string]interface{}{},
+		},
+	}
+	var buf bytes.Buffer
+	if err := encodeObject(&buf, u.Object); err != nil {
+		t.Fatal(err)
+	}
+	want, err := u.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != strings.TrimSpace(string(want)) {
+		t.Errorf("encodeObject() = %s, want %s", got, want)
+	}
+}
+
+// flakyCommandRunner fails its first runs with errors of the given class,
+// ErrorClassExit by default.
+type flakyCommandRunner struct {
+	failures int
+	class    ErrorClass
+	calls    int
+	stdout   []byte
+	stderr   []byte
+}
+
+func (f *flakyCommandRunner) Run(_ context.Context, _ map[string]interface{}, readStdout func(io.Reader), _ logrus.FieldLogger) ([]byte, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		class := f.class
+		if class == "" {
+			class = ErrorClassExit
+		}
+		return nil, &runError{class: class, err: fmt.Errorf("attempt %v failed", f.calls)}
+	}
+	readStdout(bytes.NewReader(f.stdout))
+	return f.stderr, nil
+}
+
+func TestBinaryPlugin_RunRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		class     ErrorClass
+		stdout    []byte
+		stderr    []byte
+		policy    RetryPolicy
+		wantCalls int
+		wantWaits []time.Duration
+		wantErr   bool
+	}{
+		{
+			name:      "SucceedsAfterRetries",
+			failures:  2,
+			stdout:    []byte(`{"version": "v1", "isWhiteOut": true}`),
+			policy:    RetryPolicy{MaxAttempts: 3, Backoff: time.Second, RetryOn: []ErrorClass{ErrorClassExit}},
+			wantCalls: 3,
+			wantWaits: []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:      "AttemptsExhausted",
+			failures:  3,
+			stdout:    []byte(`{"version": "v1", "isWhiteOut": true}`),
+			policy:    RetryPolicy{MaxAttempts: 3, Backoff: time.Second, RetryOn: []ErrorClass{ErrorClassExit}},
+			wantCalls: 3,
+			wantWaits: []time.Duration{time.Second, 2 * time.Second},
+			wantErr:   true,
+		},
+		{
+			name:      "StartFailureRetried",
+			failures:  1,
+			class:     ErrorClassStart,
+			stdout:    []byte(`{"version": "v1", "isWhiteOut": true}`),
+			policy:    RetryPolicy{MaxAttempts: 3, Backoff: time.Second, RetryOn: []ErrorClass{ErrorClassStart}},
+			wantCalls: 2,
+			wantWaits: []time.Duration{time.Second},
+		},
+		{
+			name:      "ClassNotListedNotRetried",
+			failures:  1,
+			class:     ErrorClassExit,
+			stdout:    []byte(`{"version": "v1", "isWhiteOut": true}`),
+			policy:    RetryPolicy{MaxAttempts: 3, Backoff: time.Second, RetryOn: []ErrorClass{ErrorClassStart}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "NoClassListedNotRetried",
+			failures:  1,
+			stdout:    []byte(`{"version": "v1", "isWhiteOut": true}`),
+			policy:    RetryPolicy{MaxAttempts: 3, Backoff: time.Second},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "NoRetryPolicy",
+			failures:  1,
+			stdout:    []byte(`{"version": "v1", "isWhiteOut": true}`),
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "PluginErrorNotRetried",
+			stderr:    []byte("panic: invalid reference"),
+			policy:    RetryPolicy{MaxAttempts: 3, Backoff: time.Second, RetryOn: []ErrorClass{ErrorClassExit}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "InvalidJsonNotRetried",
+			stdout:    []byte(`{"version": v1"}`),
+			policy:    RetryPolicy{MaxAttempts: 3, Backoff: time.Second, RetryOn: []ErrorClass{ErrorClassExit}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &flakyCommandRunner{failures: tt.failures, class: tt.class, stdout: tt.stdout, stderr: tt.stderr}
+			waits := []time.Duration{}
+			b := NewBinaryPlugin("unused", WithRetryPolicy(tt.policy)).(*BinaryPlugin)
+			b.commandRunner = runner
+			b.sleep = func(d time.Duration) { waits = append(waits, d) }
+
+			_, err := b.Run(&unstructured.Unstructured{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if runner.calls != tt.wantCalls {
+				t.Errorf("Run() calls = %v, want %v", runner.calls, tt.wantCalls)
+			}
+			if len(waits) != len(tt.wantWaits) || (len(waits) > 0 && !reflect.DeepEqual(waits, tt.wantWaits)) {
+				t.Errorf("Run() waits = %v, want %v", waits, tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestResolvePluginPath(t *testing.T) {
+	dir, err := os.MkdirTemp("", "binary-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := "crane-test-plugin"
+	file := name
+	if runtime.GOOS == "windows" {
+		file += ".exe"
+	}
+	pluginPath := filepath.Join(dir, file)
+	if err := os.WriteFile(pluginPath, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{
+			name: "PlainNameOnPath",
+			path: name,
+			want: pluginPath,
+		},
+		{
+			name: "PlainNameNotFound",
+			path: "crane-missing-plugin",
+			want: "crane-missing-plugin",
+		},
+		{
+			name: "PathWithExtension",
+			path: filepath.Join(dir, "plugin.sh"),
+			want: filepath.Join(dir, "plugin.sh"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolvePluginPath(tt.path); got != tt.want {
+				t.Errorf("resolvePluginPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBinaryPlugin_RunContextCancelled(t *testing.T) {
+	runner := &flakyCommandRunner{failures: 3, stdout: []byte(`{"version": "v1"}`)}
+	b := NewBinaryPlugin("unused", WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Second, RetryOn: []ErrorClass{ErrorClassExit}})).(*BinaryPlugin)
+	b.commandRunner = runner
+	b.sleep = func(time.Duration) {}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := b.RunContext(ctx, &unstructured.Unstructured{}); err == nil {
+		t.Error("expected an error")
+	}
+	if runner.calls != 1 {
+		t.Errorf("RunContext() calls = %v, want 1", runner.calls)
+	}
+}
+
+func TestBinaryPlugin_RunContextCancelledDuringBackoff(t *testing.T) {
+	runner := &flakyCommandRunner{failures: 3, stdout: []byte(`{"version": "v1"}`)}
+	b := NewBinaryPlugin("unused", WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Hour, RetryOn: []ErrorClass{ErrorClassExit}})).(*BinaryPlugin)
+	b.commandRunner = runner
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := b.RunContext(ctx, &unstructured.Unstructured{}); err == nil {
+		t.Error("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("RunContext() returned after %v, want it to stop waiting once cancelled", elapsed)
+	}
+	if runner.calls != 1 {
+		t.Errorf("RunContext() calls = %v, want 1", runner.calls)
+	}
+}
+
+func TestBinaryPlugin_ProtocolVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     string
+		queryErr    error
+		wantErr     bool
+		unsupported bool
+	}{
+		{
+			name:    "matching",
+			version: ProtocolVersion,
+		},
+		{
+			name:        "unsupported",
+			version:     "v3",
+			wantErr:     true,
+			unsupported: true,
+		},
+		{
+			name:     "handshake failure",
+			queryErr: fmt.Errorf("unknown flag --protocol-version"),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries := 0
+			b := NewBinaryPlugin("unused", WithProtocolVersionCheck()).(*BinaryPlugin)
+			b.commandRunner = &fakeCommandRunner{stdout: []byte(`{"version": "v1"}`)}
+			b.queryProtocolVersion = func(context.Context) (string, error) {
+				queries++
+				return tt.version, tt.queryErr
+			}
+
+			for i := 0; i < 2; i++ {
+				_, err := b.Run(&unstructured.Unstructured{})
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				var versionErr *UnsupportedProtocolVersionError
+				if errors.As(err, &versionErr) != tt.unsupported {
+					t.Errorf("Run() error = %v, want UnsupportedProtocolVersionError %v", err, tt.unsupported)
+				}
+			}
+			// Failed handshakes are retried, negotiated versions are cached.
+			wantQueries := 1
+			if tt.queryErr != nil {
+				wantQueries = 2
+			}
+			if queries != wantQueries {
+				t.Errorf("protocol version queries = %v, want %v", queries, wantQueries)
+			}
+		})
+	}
+}
+
+func TestBinaryPlugin_ProtocolVersionBinary(t *testing.T) {
+	os.Setenv(helperPluginEnv, "1")
+	defer os.Unsetenv(helperPluginEnv)
+
+	u := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"data": map[string]interface{}{
+				"big": "value",
+			},
+		},
+	}
+	b := NewBinaryPlugin(os.Args[0], WithProtocolVersionCheck()).(*BinaryPlugin)
+	if _, err := b.Run(u); err != nil {
+		t.Fatal(err)
+	}
+	if b.protocolVersion != ProtocolVersion {
+		t.Errorf("negotiated protocol version = %q, want %q", b.protocolVersion, ProtocolVersion)
+	}
+}
+
+// sourceContextPatches returns the values of the add patches of the source
+// helper plugins, keyed by annotation.
+func sourceContextPatches(t *testing.T, patch jsonpatch.Patch) map[string]string {
+	t.Helper()
+	got := map[string]string{}
+	for _, op := range patch {
+		path, err := op.Path()
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := op.ValueInterface()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[strings.TrimPrefix(path, "/metadata/annotations/")] = fmt.Sprint(value)
+	}
+	return got
+}
+
+var sourceContextTests = []struct {
+	name   string
+	source *transform.SourceContext
+	want   map[string]string
+}{
+	{
+		name: "not configured",
+		want: map[string]string{},
+	},
+	{
+		name:   "configured",
+		source: &transform.SourceContext{Cluster: "source-cluster", Namespace: "shop", MigrationID: "mig-42"},
+		want: map[string]string{
+			"cluster":     "source-cluster",
+			"namespace":   "shop",
+			"migrationID": "mig-42",
+		},
+	},
+	{
+		name:   "partially configured",
+		source: &transform.SourceContext{Cluster: "source-cluster"},
+		want: map[string]string{
+			"cluster": "source-cluster",
+		},
+	},
+}
+
+func TestBinaryPlugin_SourceContext(t *testing.T) {
+	os.Setenv(helperPluginEnv, "source")
+	defer os.Unsetenv(helperPluginEnv)
+
+	for _, tt := range sourceContextTests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := transform.Runner{SourceContext: tt.source}
+			u := unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "ConfigMap",
+					"metadata":   map[string]interface{}{"name": "cm"},
+				},
+			}
+			_, _, responses, err := r.RunNamed(u, []transform.NamedPlugin{{Name: "source", Plugin: NewBinaryPlugin(os.Args[0], WithProtocolVersionCheck())}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sourceContextPatches(t, responses["source"].Patches); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("source context passed to the plugin = %v, want %v", got, tt.want)
+			}
+			if _, ok := u.Object["sourceContext"]; ok {
+				t.Error("the source context should not be added to the object")
+			}
+		})
+	}
+}
+
+func TestBinaryPlugin_SourceContextNotNegotiated(t *testing.T) {
+	os.Setenv(helperPluginEnv, "source")
+	defer os.Unsetenv(helperPluginEnv)
+
+	// Without the handshake the plugin is sent the bare object, as plugins
+	// speaking ProtocolVersion expect.
+	r := transform.Runner{SourceContext: &transform.SourceContext{Cluster: "source-cluster"}}
+	u := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "cm"},
+		},
+	}
+	_, _, responses, err := r.RunNamed(u, []transform.NamedPlugin{{Name: "source", Plugin: NewBinaryPlugin(os.Args[0])}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sourceContextPatches(t, responses["source"].Patches); len(got) != 0 {
+		t.Errorf("source context passed to the plugin = %v, want none", got)
+	}
+}
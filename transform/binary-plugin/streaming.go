@@ -0,0 +1,175 @@
+package binary_plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// StreamingBinaryPlugin runs a resident plugin binary that handles many
+// objects over the lifetime of a single process, instead of being started
+// once per object.
+//
+// The streaming protocol is JSON Lines: every object is written to the
+// plugin's stdin as a single line of JSON, and the plugin must answer each
+// of them, in order, with a single PluginResponse written as a line of JSON
+// on stdout. Requests are sent one at a time, so the n-th response always
+// belongs to the n-th object. The plugin should exit once its stdin is
+// closed. Plugins speaking the EnvelopeProtocolVersion are sent a line of
+// transform.PluginRequest instead of the object.
+type StreamingBinaryPlugin struct {
+	mu      sync.Mutex
+	path    string
+	command *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *json.Decoder
+	stderr  lockedBuffer
+	log     logrus.FieldLogger
+	closed  bool
+
+	checkProtocolVersion bool
+	protocolVersion      string
+}
+
+// StreamingOption configures a StreamingBinaryPlugin.
+type StreamingOption func(*StreamingBinaryPlugin)
+
+// WithStreamingProtocolVersionCheck makes the plugin negotiate the protocol
+// version before the process is started, like WithProtocolVersionCheck.
+func WithStreamingProtocolVersionCheck() StreamingOption {
+	return func(s *StreamingBinaryPlugin) {
+		s.checkProtocolVersion = true
+	}
+}
+
+// NewStreamingBinaryPlugin starts the plugin binary at path in streaming
+// mode. The caller must call Close once all objects are processed.
+func NewStreamingBinaryPlugin(path string, opts ...StreamingOption) (*StreamingBinaryPlugin, error) {
+	path = resolvePluginPath(path)
+	s := &StreamingBinaryPlugin{
+		path:            path,
+		command:         exec.Command(path),
+		log:             logrus.New().WithField("path", path),
+		protocolVersion: ProtocolVersion,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.checkProtocolVersion {
+		version, err := queryProtocolVersion(context.Background(), path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to negotiate the plugin protocol version, err: %v", err)
+		}
+		if !supportedProtocolVersions[version] {
+			return nil, &UnsupportedProtocolVersionError{Path: path, Version: version}
+		}
+		s.protocolVersion = version
+	}
+	s.command.Stderr = &s.stderr
+
+	stdin, err := s.command.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the plugin stdin pipe, err: %v", err)
+	}
+	stdout, err := s.command.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the plugin stdout pipe, err: %v", err)
+	}
+	if err := s.command.Start(); err != nil {
+		return nil, fmt.Errorf("unable to run the plugin binary, err: %v", err)
+	}
+	s.stdin = stdin
+	s.stdout = json.NewDecoder(stdout)
+	return s, nil
+}
+
+var _ transform.ContextPlugin = &StreamingBinaryPlugin{}
+
+// String returns the path of the plugin binary.
+func (s *StreamingBinaryPlugin) String() string {
+	return s.path
+}
+
+func (s *StreamingBinaryPlugin) Run(u *unstructured.Unstructured) (transform.PluginResponse, error) {
+	return s.RunContext(context.Background(), u)
+}
+
+// RunContext sends the object to the plugin, along with the source context
+// carried by ctx, if any, for plugins speaking the EnvelopeProtocolVersion.
+// A request already sent is not aborted when ctx is cancelled, as the plugin
+// process is shared by all objects.
+func (s *StreamingBinaryPlugin) RunContext(ctx context.Context, u *unstructured.Unstructured) (transform.PluginResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return transform.PluginResponse{}, err
+	}
+	// json.Marshal escapes the newlines of string values, so exactly one
+	// line is sent per object.
+	objJson, err := json.Marshal(pluginRequest(ctx, u, s.protocolVersion))
+	if err != nil {
+		s.log.Errorf("unable to marshal unstructured Object")
+		return transform.PluginResponse{}, fmt.Errorf("unable to marshal unstructured Object: %s, err: %v", u, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return transform.PluginResponse{}, fmt.Errorf("the plugin process is closed")
+	}
+
+	line := append(objJson, '\n')
+	if _, err := s.stdin.Write(line); err != nil {
+		s.log.Errorf("unable to send the object to the plugin")
+		return transform.PluginResponse{}, fmt.Errorf("unable to send the object to the plugin, err: %v, stderr: %s", err, s.stderr.String())
+	}
+
+	p := transform.PluginResponse{}
+	if err := s.stdout.Decode(&p); err != nil {
+		s.log.Errorf("unable to decode json sent by the plugin")
+		return transform.PluginResponse{}, fmt.Errorf("unable to decode json sent by the plugin, err: %v, stderr: %s", err, s.stderr.String())
+	}
+	return p, nil
+}
+
+// Close closes the plugin's stdin and waits for the process to exit.
+func (s *StreamingBinaryPlugin) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.stdin.Close()
+	if err := s.command.Wait(); err != nil {
+		return fmt.Errorf("unable to run the plugin binary, err: %v, stderr: %s", err, s.stderr.String())
+	}
+	return nil
+}
+
+// lockedBuffer collects the plugin's stderr, which is written concurrently
+// with the requests reading it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *lockedBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
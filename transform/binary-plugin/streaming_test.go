@@ -0,0 +1,173 @@
+package binary_plugin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/transform/cli"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// runStreamingHelperPlugin answers every object read from stdin with a patch
+// recording the object's name and how many objects the process has handled,
+// along with the cluster of its source context, if any. It speaks the
+// envelope protocol.
+func runStreamingHelperPlugin() {
+	if len(os.Args) > 1 && os.Args[1] == "--protocol-version" {
+		fmt.Fprintln(os.Stdout, EnvelopeProtocolVersion)
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	handled := 0
+	for scanner.Scan() {
+		u, source, err := cli.UnstructuredWithSourceContext(bytes.NewReader(scanner.Bytes()))
+		if err != nil {
+			fmt.Fprint(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		handled++
+		annotations := map[string]string{"name": u.GetName(), "handled": fmt.Sprint(handled)}
+		if source != nil {
+			annotations["cluster"] = source.Cluster
+		}
+		value, _ := json.Marshal(annotations)
+		fmt.Fprintf(os.Stdout, `{"version": "v1", "patches": [{"op": "add", "path": "/metadata/annotations", "value": %s}]}`+"\n", value)
+	}
+}
+
+func TestStreamingBinaryPlugin_Run(t *testing.T) {
+	os.Setenv(helperPluginEnv, "stream")
+	defer os.Unsetenv(helperPluginEnv)
+
+	p, err := NewStreamingBinaryPlugin(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, name := range []string{"first", "second", "third"} {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("v1")
+		u.SetKind("ConfigMap")
+		u.SetName(name)
+
+		resp, err := p.Run(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Patches) != 1 {
+			t.Fatalf("expected a single patch, got %v", len(resp.Patches))
+		}
+		value, err := resp.Patches[0].ValueInterface()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{"name": name, "handled": fmt.Sprint(i + 1)}
+		if fmt.Sprint(value) != fmt.Sprint(want) {
+			t.Errorf("response = %v, want %v", value, want)
+		}
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Run(&unstructured.Unstructured{}); err == nil {
+		t.Error("expected an error running a closed plugin")
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("closing twice should not fail, got: %v", err)
+	}
+}
+
+func TestStreamingBinaryPlugin_SourceContext(t *testing.T) {
+	os.Setenv(helperPluginEnv, "stream")
+	defer os.Unsetenv(helperPluginEnv)
+
+	p, err := NewStreamingBinaryPlugin(os.Args[0], WithStreamingProtocolVersionCheck())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for i, tt := range sourceContextTests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := unstructured.Unstructured{}
+			u.SetAPIVersion("v1")
+			u.SetKind("ConfigMap")
+			u.SetName("cm")
+
+			r := transform.Runner{SourceContext: tt.source}
+			_, _, responses, err := r.RunNamed(u, []transform.NamedPlugin{{Name: "stream", Plugin: p}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(responses["stream"].Patches) != 1 {
+				t.Fatalf("expected a single patch, got %v", len(responses["stream"].Patches))
+			}
+			value, err := responses["stream"].Patches[0].ValueInterface()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]interface{}{"name": "cm", "handled": fmt.Sprint(i + 1)}
+			if tt.source != nil {
+				want["cluster"] = tt.source.Cluster
+			}
+			if fmt.Sprint(value) != fmt.Sprint(want) {
+				t.Errorf("response = %v, want %v", value, want)
+			}
+		})
+	}
+}
+
+func TestStreamingBinaryPlugin_SourceContextNotNegotiated(t *testing.T) {
+	os.Setenv(helperPluginEnv, "stream")
+	defer os.Unsetenv(helperPluginEnv)
+
+	p, err := NewStreamingBinaryPlugin(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	u := unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("ConfigMap")
+	u.SetName("cm")
+	r := transform.Runner{SourceContext: &transform.SourceContext{Cluster: "source-cluster"}}
+	_, _, responses, err := r.RunNamed(u, []transform.NamedPlugin{{Name: "stream", Plugin: p}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses["stream"].Patches) != 1 {
+		t.Fatalf("expected a single patch, got %v", len(responses["stream"].Patches))
+	}
+	value, err := responses["stream"].Patches[0].ValueInterface()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"name": "cm", "handled": "1"}
+	if fmt.Sprint(value) != fmt.Sprint(want) {
+		t.Errorf("response = %v, want %v", value, want)
+	}
+}
+
+func TestStreamingBinaryPlugin_RunPluginExited(t *testing.T) {
+	os.Setenv(helperPluginEnv, "stream")
+	defer os.Unsetenv(helperPluginEnv)
+
+	p, err := NewStreamingBinaryPlugin(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// An invalid line makes the helper exit before answering.
+	p.stdin.Write([]byte("{\n"))
+	if _, err := p.Run(&unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap"}}); err == nil {
+		t.Error("expected an error when the plugin exits")
+	}
+}
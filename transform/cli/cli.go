@@ -12,7 +12,6 @@ import (
 )
 
 type CustomPlugin struct {
-	// TODO: figure out a way to include the name of the plugin in the error messages.
 	name    string
 	runFunc func(*unstructured.Unstructured) (transform.PluginResponse, error)
 }
@@ -24,6 +23,12 @@ func (c *CustomPlugin) Run(u *unstructured.Unstructured) (transform.PluginRespon
 	return c.runFunc(u)
 }
 
+// String returns the name of the plugin, which the Runner includes in the
+// errors of the plugin.
+func (c *CustomPlugin) String() string {
+	return c.name
+}
+
 func NewCustomPlugin(name string, runFunc func(*unstructured.Unstructured) (transform.PluginResponse, error)) transform.Plugin {
 	return &CustomPlugin{
 		name:    name,
@@ -38,6 +43,27 @@ func Unstructured(reader io.Reader) (*unstructured.Unstructured, error) {
 	return u, err
 }
 
+// UnstructuredWithSourceContext decodes the object a binary plugin speaking
+// the "v2" protocol is run with, along with the source context of the run,
+// if any, from the transform.PluginRequest. Hosts that do not negotiate the
+// protocol version send the bare object instead, without an object field,
+// and no source context.
+func UnstructuredWithSourceContext(reader io.Reader) (*unstructured.Unstructured, *transform.SourceContext, error) {
+	u := &unstructured.Unstructured{}
+	doc := json.RawMessage{}
+	if err := json.NewDecoder(reader).Decode(&doc); err != nil {
+		return u, nil, err
+	}
+	request := transform.PluginRequest{}
+	if err := json.Unmarshal(doc, &request); err != nil {
+		return u, nil, fmt.Errorf("invalid plugin request: %v", err)
+	}
+	if len(request.Object) == 0 {
+		return u, nil, u.UnmarshalJSON(doc)
+	}
+	return u, request.SourceContext, u.UnmarshalJSON(request.Object)
+}
+
 func ObjectReaderOrDie() io.Reader {
 	return os.Stdin
 }
@@ -0,0 +1,63 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// CompositePlugin presents a list of plugins as a single Plugin, for instance
+// to bundle the Kubernetes transforms with a custom plugin. The plugins are
+// ordered and skipped as the Runner does, by PriorityPlugin and ScopedPlugin.
+// Each plugin is run against a copy of the object and their responses are
+// merged with PluginResponse.Merge. Once a plugin whites out the object the
+// remaining plugins are not run.
+type CompositePlugin struct {
+	Plugins []Plugin
+}
+
+var _ ContextPlugin = &CompositePlugin{}
+
+// String names the composed plugins, the Runner includes it in the errors of
+// the plugin, while the errors of the composed plugins name the one failing.
+func (c *CompositePlugin) String() string {
+	names := make([]string, 0, len(c.Plugins))
+	for _, plugin := range c.Plugins {
+		names = append(names, pluginName(plugin))
+	}
+	return "composite(" + strings.Join(names, ", ") + ")"
+}
+
+func (c *CompositePlugin) Run(u *unstructured.Unstructured) (PluginResponse, error) {
+	return c.RunContext(context.Background(), u)
+}
+
+// RunContext runs the plugins, passing ctx on to those implementing
+// ContextPlugin.
+func (c *CompositePlugin) RunContext(ctx context.Context, u *unstructured.Unstructured) (PluginResponse, error) {
+	// The object is unhandled until one of the plugins handles it.
+	merged := PluginResponse{Unhandled: true}
+	for _, i := range pluginOrder(c.Plugins) {
+		plugin := c.Plugins[i]
+		if err := ctx.Err(); err != nil {
+			return PluginResponse{}, err
+		}
+		if scoped, ok := plugin.(ScopedPlugin); ok && !scoped.AppliesTo(u.GroupVersionKind().GroupKind()) {
+			continue
+		}
+		resp, err := runPluginContext(ctx, plugin, u.DeepCopy())
+		if err != nil {
+			return PluginResponse{}, fmt.Errorf("%v: %w", pluginName(plugin), err)
+		}
+		merged, err = merged.Merge(resp)
+		if err != nil {
+			return PluginResponse{}, fmt.Errorf("%v: %w", pluginName(plugin), err)
+		}
+		if merged.IsWhiteOut {
+			break
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,177 @@
+package transform_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/konveyor/crane-lib/transform"
+	internaljsonpatch "github.com/konveyor/crane-lib/transform/internal/jsonpatch"
+	"github.com/konveyor/crane-lib/transform/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type labelPlugin struct {
+	calls int
+}
+
+func (l *labelPlugin) Run(u *unstructured.Unstructured) (transform.PluginResponse, error) {
+	l.calls++
+	p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/metadata/labels", "value": {"migrated": "true"}}]`))
+	if err != nil {
+		return transform.PluginResponse{}, err
+	}
+	return transform.PluginResponse{Version: "v1", Patches: p}, nil
+}
+
+func TestCompositePlugin(t *testing.T) {
+	cases := []struct {
+		Name              string
+		Object            *unstructured.Unstructured
+		IsWhiteOut        bool
+		PatchResponseJson string
+		LabelPluginCalls  int
+	}{
+		{
+			Name: "MergesPatches",
+			Object: &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind":       "Service",
+					"apiVersion": "v1",
+					"spec": map[string]interface{}{
+						"clusterIP": "172.30.12.4",
+					},
+				},
+			},
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/clusterIP"}, {"op": "add", "path": "/metadata/labels", "value": {"migrated": "true"}}]`,
+			LabelPluginCalls:  1,
+		},
+		{
+			Name: "ShortCircuitsOnWhiteOut",
+			Object: &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind":       "Endpoints",
+					"apiVersion": "v1",
+				},
+			},
+			IsWhiteOut: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			labels := &labelPlugin{}
+			var p transform.Plugin = &transform.CompositePlugin{
+				Plugins: []transform.Plugin{&kubernetes.KubernetesTransformPlugin{}, labels},
+			}
+			resp, err := p.Run(c.Object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.IsWhiteOut != c.IsWhiteOut {
+				t.Errorf("incorrect white out determination, actual: %v expected: %v", resp.IsWhiteOut, c.IsWhiteOut)
+			}
+			if labels.calls != c.LabelPluginCalls {
+				t.Errorf("incorrect number of calls to the label plugin, actual: %v expected: %v", labels.calls, c.LabelPluginCalls)
+			}
+			if c.PatchResponseJson == "" {
+				if len(resp.Patches) != 0 {
+					t.Errorf("expected no patches, got: %v", resp.Patches)
+				}
+				return
+			}
+			expected, err := jsonpatch.DecodePatch([]byte(c.PatchResponseJson))
+			if err != nil {
+				t.Fatal(err)
+			}
+			equal, err := internaljsonpatch.Equal(resp.Patches, expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equal {
+				t.Errorf("incorrect patches, actual: %v expected: %v", resp.Patches, expected)
+			}
+		})
+	}
+}
+
+// orderedPlugin appends its name to /spec/order, for the kinds it applies to.
+type orderedPlugin struct {
+	name     string
+	priority int
+	kinds    []string
+}
+
+func (o orderedPlugin) Run(u *unstructured.Unstructured) (transform.PluginResponse, error) {
+	p, err := jsonpatch.DecodePatch([]byte(fmt.Sprintf(`[{"op": "add", "path": "/spec/order/-", "value": %q}]`, o.name)))
+	if err != nil {
+		return transform.PluginResponse{}, err
+	}
+	return transform.PluginResponse{Patches: p}, nil
+}
+
+func (o orderedPlugin) Priority() int {
+	return o.priority
+}
+
+func (o orderedPlugin) AppliesTo(gk schema.GroupKind) bool {
+	for _, kind := range o.kinds {
+		if kind == gk.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCompositePluginOrderAndScope(t *testing.T) {
+	composite := &transform.CompositePlugin{
+		Plugins: []transform.Plugin{
+			orderedPlugin{name: "low", priority: -1, kinds: []string{"Service"}},
+			orderedPlugin{name: "default", kinds: []string{"Service"}},
+			orderedPlugin{name: "deployment", priority: 5, kinds: []string{"Deployment"}},
+			orderedPlugin{name: "high", priority: 10, kinds: []string{"Service"}},
+		},
+	}
+	resp, err := composite.Run(&unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":       "Service",
+		"apiVersion": "v1",
+		"spec":       map[string]interface{}{"order": []interface{}{}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := []string{}
+	for _, op := range resp.Patches {
+		value, err := op.ValueInterface()
+		if err != nil {
+			t.Fatal(err)
+		}
+		order = append(order, value.(string))
+	}
+	expected := []string{"high", "default", "low"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("plugins not run by priority and scope, actual: %v expected: %v", order, expected)
+	}
+}
+
+func TestCompositePluginError(t *testing.T) {
+	composite := &transform.CompositePlugin{
+		Plugins: []transform.Plugin{&kubernetes.KubernetesTransformPlugin{}, failingPlugin{}},
+	}
+	if name := composite.String(); name != "composite(KubernetesPlugin, transform_test.failingPlugin)" {
+		t.Errorf("incorrect name, actual: %v", name)
+	}
+
+	runner := transform.Runner{}
+	_, _, err := runner.Run(unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":       "ConfigMap",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{"name": "settings"},
+	}}, []transform.Plugin{composite})
+	expected := `plugin "composite(KubernetesPlugin, transform_test.failingPlugin)" failed: transform_test.failingPlugin: cannot transform settings`
+	if err == nil || err.Error() != expected {
+		t.Errorf("incorrect error, actual: %v expected: %v", err, expected)
+	}
+}
@@ -0,0 +1,102 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DiffToPatch computes a JSON patch transforming original into desired, so
+// plugins can mutate a copy of the object instead of building operations by
+// hand. Objects are diffed member by member. Arrays of the same length are
+// diffed element by element, other arrays are replaced as a whole.
+func DiffToPatch(original, desired unstructured.Unstructured) (jsonpatch.Patch, error) {
+	from, err := normalizedJSON(original)
+	if err != nil {
+		return nil, err
+	}
+	to, err := normalizedJSON(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := diffValues("", from, to, []map[string]interface{}{})
+	patchJSON, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.DecodePatch(patchJSON)
+}
+
+// normalizedJSON round trips the object through JSON, so numbers compare
+// equal regardless of their Go type.
+func normalizedJSON(u unstructured.Unstructured) (interface{}, error) {
+	b, err := json.Marshal(u.Object)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// diffValues appends the operations turning from into to at path to ops.
+func diffValues(path string, from, to interface{}, ops []map[string]interface{}) []map[string]interface{} {
+	switch f := from.(type) {
+	case map[string]interface{}:
+		if t, ok := to.(map[string]interface{}); ok {
+			return diffObjects(path, f, t, ops)
+		}
+	case []interface{}:
+		if t, ok := to.([]interface{}); ok && len(f) == len(t) {
+			for i := range f {
+				ops = diffValues(path+"/"+strconv.Itoa(i), f[i], t[i], ops)
+			}
+			return ops
+		}
+	}
+	if reflect.DeepEqual(from, to) {
+		return ops
+	}
+	return append(ops, map[string]interface{}{"op": "replace", "path": path, "value": to})
+}
+
+func diffObjects(path string, from, to map[string]interface{}, ops []map[string]interface{}) []map[string]interface{} {
+	// Emit the operations sorted by key so the patch is stable between runs.
+	keys := make([]string, 0, len(from)+len(to))
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		memberPath := path + "/" + escapePointerToken(key)
+		fromValue, inFrom := from[key]
+		toValue, inTo := to[key]
+		switch {
+		case !inTo:
+			ops = append(ops, map[string]interface{}{"op": "remove", "path": memberPath})
+		case !inFrom:
+			ops = append(ops, map[string]interface{}{"op": "add", "path": memberPath, "value": toValue})
+		default:
+			ops = diffValues(memberPath, fromValue, toValue, ops)
+		}
+	}
+	return ops
+}
+
+func escapePointerToken(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
@@ -0,0 +1,123 @@
+package transform
+
+import (
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	internaljsonpatch "github.com/konveyor/crane-lib/transform/internal/jsonpatch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDiffToPatch(t *testing.T) {
+	original := func() unstructured.Unstructured {
+		return unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"kind":       "Service",
+				"apiVersion": "v1",
+				"metadata": map[string]interface{}{
+					"name": "frontend",
+					"annotations": map[string]interface{}{
+						"example.com/owner": "team-a",
+					},
+				},
+				"spec": map[string]interface{}{
+					"clusterIP": "172.30.12.4",
+					"ports": []interface{}{
+						map[string]interface{}{"port": int64(80), "nodePort": int64(30080)},
+					},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		Name   string
+		Mutate func(u *unstructured.Unstructured)
+		Patch  string
+	}{
+		{
+			Name:   "Unchanged",
+			Mutate: func(u *unstructured.Unstructured) {},
+			Patch:  `[]`,
+		},
+		{
+			Name: "AddedNestedField",
+			Mutate: func(u *unstructured.Unstructured) {
+				u.SetLabels(map[string]string{"migrated": "true"})
+			},
+			Patch: `[{"op": "add", "path": "/metadata/labels", "value": {"migrated": "true"}}]`,
+		},
+		{
+			Name: "RemovedNestedField",
+			Mutate: func(u *unstructured.Unstructured) {
+				unstructured.RemoveNestedField(u.Object, "spec", "clusterIP")
+			},
+			Patch: `[{"op": "remove", "path": "/spec/clusterIP"}]`,
+		},
+		{
+			Name: "ChangedNestedField",
+			Mutate: func(u *unstructured.Unstructured) {
+				u.SetAnnotations(map[string]string{"example.com/owner": "team-b"})
+			},
+			Patch: `[{"op": "replace", "path": "/metadata/annotations/example.com~1owner", "value": "team-b"}]`,
+		},
+		{
+			Name: "ChangedArrayElement",
+			Mutate: func(u *unstructured.Unstructured) {
+				unstructured.SetNestedSlice(u.Object, []interface{}{
+					map[string]interface{}{"port": int64(80)},
+				}, "spec", "ports")
+			},
+			Patch: `[{"op": "remove", "path": "/spec/ports/0/nodePort"}]`,
+		},
+		{
+			Name: "ResizedArray",
+			Mutate: func(u *unstructured.Unstructured) {
+				unstructured.SetNestedSlice(u.Object, []interface{}{
+					map[string]interface{}{"port": int64(80), "nodePort": int64(30080)},
+					map[string]interface{}{"port": int64(443)},
+				}, "spec", "ports")
+			},
+			Patch: `[{"op": "replace", "path": "/spec/ports", "value": [{"port": 80, "nodePort": 30080}, {"port": 443}]}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			desired := original()
+			c.Mutate(&desired)
+
+			patch, err := DiffToPatch(original(), desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := jsonpatch.DecodePatch([]byte(c.Patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := internaljsonpatch.Equal(patch, expected); !ok || err != nil {
+				t.Errorf("unexpected patch, actual: %v expected: %v", patch, expected)
+			}
+
+			// Applying the patch must produce the desired object.
+			o := original()
+			doc, err := o.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(patch) > 0 {
+				doc, err = patch.Apply(doc)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := desired.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !jsonpatch.Equal(doc, want) {
+				t.Errorf("patched object does not match, actual: %s expected: %s", doc, want)
+			}
+		})
+	}
+}
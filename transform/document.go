@@ -0,0 +1,192 @@
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+const yamlSeparator = "---\n"
+
+// TransformYAML runs the plugins against every document of a, possibly multi
+// document, YAML stream and returns the transformed documents in their
+// original order. Whited out documents are dropped. The keys of the
+// transformed documents keep their original order, keys added by the
+// transforms follow them.
+func TransformYAML(data []byte, plugins []Plugin) ([]byte, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	docs := [][]byte{}
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objJSON, err := yaml.YAMLToJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+		transformed, err := (&Runner{}).transformDocument(objJSON, plugins)
+		if err != nil {
+			return nil, err
+		}
+		if transformed == nil {
+			continue
+		}
+		out, err := preserveYAMLOrder(doc, transformed)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, out)
+	}
+	return bytes.Join(docs, []byte(yamlSeparator)), nil
+}
+
+// TransformJSON runs the plugins against every object of a stream of JSON
+// objects and returns the transformed objects, one per line, in their
+// original order. Whited out objects are dropped.
+func TransformJSON(data []byte, plugins []Plugin) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	out := bytes.Buffer{}
+	for {
+		doc := json.RawMessage{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		transformed, err := (&Runner{}).transformDocument(doc, plugins)
+		if err != nil {
+			return nil, err
+		}
+		if transformed == nil {
+			continue
+		}
+		out.Write(bytes.TrimSpace(transformed))
+		out.WriteString("\n")
+	}
+	return out.Bytes(), nil
+}
+
+// RunBytes runs the plugins against a single JSON or YAML encoded object and
+// returns the transformed object, encoded like data. The encoding is detected
+// from the content: objects starting with "{" are JSON, anything else YAML.
+// YAML objects keep the original order of their keys.
+// Lists have each of their items transformed. Whited out objects are reported
+// with nil bytes.
+func (r *Runner) RunBytes(data []byte, plugins []Plugin) ([]byte, bool, error) {
+	trimmed := bytes.TrimSpace(data)
+	isJSON := bytes.HasPrefix(trimmed, []byte("{"))
+	doc := trimmed
+	if !isJSON {
+		var err error
+		doc, err = yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if trimmed := bytes.TrimSpace(doc); len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return nil, false, fmt.Errorf("no object to transform")
+	}
+
+	transformed, err := r.transformDocument(doc, plugins)
+	if err != nil {
+		return nil, false, err
+	}
+	if transformed == nil {
+		return nil, true, nil
+	}
+	if isJSON {
+		return transformed, false, nil
+	}
+	out, err := preserveYAMLOrder(data, transformed)
+	if err != nil {
+		return nil, false, err
+	}
+	return out, false, nil
+}
+
+// transformDocument runs the plugins against a single JSON document and
+// applies the resulting patches. Lists have each of their items transformed.
+// It returns nil for empty documents and objects that are whited out.
+func (r *Runner) transformDocument(doc []byte, plugins []Plugin) ([]byte, error) {
+	trimmed := bytes.TrimSpace(doc)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return nil, nil
+	}
+	u := unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(trimmed); err != nil {
+		return nil, err
+	}
+
+	if isList(u) {
+		list, err := r.RunList(u, plugins)
+		if err != nil {
+			return nil, err
+		}
+		return list.MarshalJSON()
+	}
+	patches, isWhiteOut, err := r.Run(u, plugins)
+	if err != nil {
+		return nil, err
+	}
+	if isWhiteOut {
+		return nil, nil
+	}
+	if len(patches) == 0 {
+		return u.MarshalJSON()
+	}
+	return applyPatch(u, patches)
+}
+
+// applyPatch applies a patch returned by the Runner to the object and returns
+// the patched object as JSON. The patch is applied to the patchableDocument,
+// so annotations can be added to objects without any, but the annotations
+// map, and the metadata holding it, are dropped again when the patch leaves
+// them empty: the parts of the object the patch does not touch are returned
+// unchanged.
+func applyPatch(object unstructured.Unstructured, patch []byte) ([]byte, error) {
+	decoded, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := patchableDocument(object)
+	if err != nil {
+		return nil, err
+	}
+	doc, err = decoded.Apply(doc)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return nil, fmt.Errorf("unable to apply patches, the object does not match the patches - %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to apply patches - %w", err)
+	}
+
+	patched := unstructured.Unstructured{}
+	if err := patched.UnmarshalJSON(doc); err != nil {
+		return nil, fmt.Errorf("unable to apply transformations to create a valid kubernetes object - %w", err)
+	}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(object.Object, "metadata", "annotations"); !ok {
+		if annotations, ok, _ := unstructured.NestedMap(patched.Object, "metadata", "annotations"); ok && len(annotations) == 0 {
+			unstructured.RemoveNestedField(patched.Object, "metadata", "annotations")
+		}
+	}
+	if _, ok := object.Object["metadata"]; !ok {
+		if metadata, ok := patched.Object["metadata"].(map[string]interface{}); ok && len(metadata) == 0 {
+			delete(patched.Object, "metadata")
+		}
+	}
+	return patched.MarshalJSON()
+}
@@ -0,0 +1,373 @@
+package transform_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/transform/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const multiDocumentYAML = `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+spec:
+  resources:
+    requests:
+      storage: 1Gi
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  template:
+    spec:
+      containers:
+      - name: frontend
+        image: quay.io/konveyor/frontend:latest
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+spec:
+  clusterIP: 172.30.12.4
+  ports:
+  - port: 80
+`
+
+func TestTransformYAML(t *testing.T) {
+	plugins := []transform.Plugin{
+		&kubernetes.KubernetesTransformPlugin{
+			RegistryReplacement: map[string]string{"quay.io": "registry.example.com"},
+		},
+	}
+	out, err := transform.TransformYAML([]byte(multiDocumentYAML), plugins)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := strings.Split(string(out), "---\n")
+	if len(docs) != 2 {
+		t.Fatalf("expected the PVC to be dropped, got %v documents:\n%s", len(docs), out)
+	}
+	deployment := unstructured.Unstructured{}
+	if err := yaml.Unmarshal([]byte(docs[0]), &deployment.Object); err != nil {
+		t.Fatal(err)
+	}
+	if deployment.GetKind() != "Deployment" {
+		t.Fatalf("expected the Deployment first, got %v", deployment.GetKind())
+	}
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	if image := containers[0].(map[string]interface{})["image"]; image != "registry.example.com/konveyor/frontend:latest" {
+		t.Errorf("image not rewritten: %v", image)
+	}
+
+	service := unstructured.Unstructured{}
+	if err := yaml.Unmarshal([]byte(docs[1]), &service.Object); err != nil {
+		t.Fatal(err)
+	}
+	if service.GetKind() != "Service" {
+		t.Fatalf("expected the Service second, got %v", service.GetKind())
+	}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(service.Object, "spec", "clusterIP"); ok {
+		t.Error("clusterIP not removed")
+	}
+}
+
+func TestTransformYAMLKeyOrder(t *testing.T) {
+	input := `kind: Deployment
+apiVersion: apps/v1
+metadata:
+  name: frontend
+  labels:
+    app: frontend
+  annotations:
+    owner: team-a
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: frontend
+        image: quay.io/konveyor/frontend:latest
+        ports:
+        - containerPort: 8080
+          name: http
+`
+	plugins := []transform.Plugin{
+		&kubernetes.KubernetesTransformPlugin{
+			RegistryReplacement: map[string]string{"quay.io": "registry.example.com"},
+		},
+	}
+	out, err := transform.TransformYAML([]byte(input), plugins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(input, "quay.io", "registry.example.com", 1)
+	if string(out) != expected {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", out, expected)
+	}
+}
+
+func TestTransformUntouchedMetadata(t *testing.T) {
+	// The plugins need an annotations map to add annotations to, none of
+	// them may be left in the output when nothing was added.
+	input := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  namespace: shop
+  labels:
+    app: frontend
+spec:
+  template:
+    spec:
+      containers:
+      - name: frontend
+        image: quay.io/konveyor/frontend:latest
+`
+	plugins := []transform.Plugin{
+		&kubernetes.KubernetesTransformPlugin{
+			RegistryReplacement: map[string]string{"quay.io": "registry.example.com"},
+		},
+	}
+	metadata := func(doc string) string {
+		start := strings.Index(doc, "metadata:\n")
+		end := strings.Index(doc, "spec:\n")
+		if start < 0 || end < start {
+			t.Fatalf("no metadata block in:\n%s", doc)
+		}
+		return doc[start:end]
+	}
+	cases := []struct {
+		Name      string
+		Transform func() ([]byte, error)
+	}{
+		{
+			Name: "TransformYAML",
+			Transform: func() ([]byte, error) {
+				return transform.TransformYAML([]byte(input), plugins)
+			},
+		},
+		{
+			Name: "RunBytes",
+			Transform: func() ([]byte, error) {
+				out, _, err := (&transform.Runner{}).RunBytes([]byte(input), plugins)
+				return out, err
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			out, err := c.Transform()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(out), "registry.example.com/konveyor/frontend:latest") {
+				t.Fatalf("image not rewritten:\n%s", out)
+			}
+			if metadata(string(out)) != metadata(input) {
+				t.Errorf("metadata changed:\n%s\nwant:\n%s", metadata(string(out)), metadata(input))
+			}
+		})
+	}
+}
+
+func TestTransformJSON(t *testing.T) {
+	input := `{"apiVersion": "v1", "kind": "PersistentVolumeClaim", "metadata": {"name": "data"}}
+{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "frontend"}, "spec": {"clusterIP": "172.30.12.4"}}
+{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "config"}, "data": {"key": "value"}}`
+
+	out, err := transform.TransformJSON([]byte(input), []transform.Plugin{&kubernetes.KubernetesTransformPlugin{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected the PVC to be dropped, got:\n%s", out)
+	}
+	if strings.Contains(lines[0], "clusterIP") || !strings.Contains(lines[0], `"kind":"Service"`) {
+		t.Errorf("unexpected service: %v", lines[0])
+	}
+	if lines[1] != `{"apiVersion":"v1","data":{"key":"value"},"kind":"ConfigMap","metadata":{"name":"config"}}` {
+		t.Errorf("unexpected config map: %v", lines[1])
+	}
+}
+
+func TestRunnerRunList(t *testing.T) {
+	list := unstructured.Unstructured{}
+	if err := list.UnmarshalJSON([]byte(`{"apiVersion": "v1", "kind": "List", "metadata": {}, "items": [
+{"apiVersion": "v1", "kind": "PersistentVolumeClaim", "metadata": {"name": "data"}},
+{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "frontend"}, "spec": {"clusterIP": "172.30.12.4"}},
+{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "config"}, "data": {"key": "value"}}]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := transform.Runner{}
+	out, err := runner.RunList(list, []transform.Plugin{&kubernetes.KubernetesTransformPlugin{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.GetKind() != "List" {
+		t.Errorf("expected a List, got %v", out.GetKind())
+	}
+	items, _, _ := unstructured.NestedSlice(out.Object, "items")
+	if len(items) != 2 {
+		t.Fatalf("expected the PVC to be dropped, got %v items", len(items))
+	}
+	service := unstructured.Unstructured{Object: items[0].(map[string]interface{})}
+	if service.GetKind() != "Service" {
+		t.Fatalf("expected the Service first, got %v", service.GetKind())
+	}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(service.Object, "spec", "clusterIP"); ok {
+		t.Error("clusterIP not removed")
+	}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(service.Object, "metadata", "annotations"); ok {
+		t.Errorf("expected no annotations added to the Service, got %v", service.GetAnnotations())
+	}
+	configMap := unstructured.Unstructured{Object: items[1].(map[string]interface{})}
+	if !reflect.DeepEqual(configMap.Object, list.Object["items"].([]interface{})[2]) {
+		t.Errorf("expected the ConfigMap unchanged, got %v", configMap.Object)
+	}
+}
+
+func TestRunnerRunAllPluginsFor(t *testing.T) {
+	deploymentConfig := func(namespace string) unstructured.Unstructured {
+		return unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps.openshift.io/v1",
+			"kind":       "DeploymentConfig",
+			"metadata":   map[string]interface{}{"name": "frontend", "namespace": namespace},
+			"spec": map[string]interface{}{
+				"triggers": []interface{}{
+					map[string]interface{}{
+						"type": "ImageChange",
+						"imageChangeParams": map[string]interface{}{
+							"from": map[string]interface{}{"kind": "ImageStreamTag", "name": "frontend:latest", "namespace": namespace},
+						},
+					},
+				},
+			},
+		}}
+	}
+	newNamespaces := map[string]string{"shop": "shop-destination", "billing": "billing-destination"}
+	runner := transform.Runner{
+		PluginsFor: func(object unstructured.Unstructured) []transform.Plugin {
+			newNamespace, ok := newNamespaces[object.GetNamespace()]
+			if !ok {
+				return nil
+			}
+			return []transform.Plugin{&kubernetes.KubernetesTransformPlugin{NewNamespace: newNamespace}}
+		},
+	}
+	objects := []unstructured.Unstructured{deploymentConfig("shop"), deploymentConfig("billing"), deploymentConfig("other")}
+	results, err := runner.RunAll(objects, []transform.Plugin{&kubernetes.KubernetesTransformPlugin{NewNamespace: "destination"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"shop-destination", "billing-destination", "destination"}
+	for i, result := range results {
+		patch, err := jsonpatch.DecodePatch(result.Patches)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := objects[i].MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err = patch.Apply(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := unstructured.Unstructured{}
+		if err := u.UnmarshalJSON(doc); err != nil {
+			t.Fatal(err)
+		}
+		triggers, _, _ := unstructured.NestedSlice(u.Object, "spec", "triggers")
+		namespace, _, _ := unstructured.NestedString(triggers[0].(map[string]interface{}), "imageChangeParams", "from", "namespace")
+		if namespace != expected[i] {
+			t.Errorf("result %v: incorrect trigger namespace, actual: %v expected: %v", i, namespace, expected[i])
+		}
+	}
+}
+
+func TestRunnerRunBytes(t *testing.T) {
+	plugins := []transform.Plugin{
+		&kubernetes.KubernetesTransformPlugin{
+			RegistryReplacement: map[string]string{"quay.io": "registry.example.com"},
+		},
+	}
+	cases := []struct {
+		Name       string
+		Input      string
+		Output     string
+		IsWhiteOut bool
+	}{
+		{
+			Name:   "JSON",
+			Input:  `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "frontend"}, "spec": {"clusterIP": "172.30.12.4"}}`,
+			Output: `{"apiVersion":"v1","kind":"Service","metadata":{"name":"frontend"},"spec":{}}`,
+		},
+		{
+			Name: "YAML",
+			Input: `apiVersion: v1
+kind: Pod
+metadata:
+  name: frontend
+spec:
+  containers:
+  - name: frontend
+    image: quay.io/konveyor/frontend:latest
+`,
+			Output: `apiVersion: v1
+kind: Pod
+metadata:
+  name: frontend
+spec:
+  containers:
+  - name: frontend
+    image: registry.example.com/konveyor/frontend:latest
+`,
+		},
+		{
+			Name:       "WhiteOut",
+			Input:      "apiVersion: v1\nkind: PersistentVolumeClaim\nmetadata:\n  name: data\n",
+			IsWhiteOut: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := transform.Runner{}
+			out, isWhiteOut, err := runner.RunBytes([]byte(c.Input), plugins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isWhiteOut != c.IsWhiteOut {
+				t.Errorf("isWhiteOut = %v, want %v", isWhiteOut, c.IsWhiteOut)
+			}
+			if c.IsWhiteOut {
+				if out != nil {
+					t.Errorf("expected no output for a whited out object, got %s", out)
+				}
+				return
+			}
+			if strings.TrimSpace(string(out)) != strings.TrimSpace(c.Output) {
+				t.Errorf("unexpected output:\n%s\nwant:\n%s", out, c.Output)
+			}
+		})
+	}
+
+	runner := transform.Runner{}
+	if _, _, err := runner.RunBytes([]byte("\n"), plugins); err == nil {
+		t.Error("expected an empty input to error")
+	}
+}
@@ -1,6 +1,8 @@
 package jsonpatch
 
 import (
+	"reflect"
+
 	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/pkg/errors"
 )
@@ -32,7 +34,7 @@ func Equal(patch1, patch2 jsonpatch.Patch) (bool, error) {
 				if err != nil && err2 != jsonpatch.ErrMissing {
 					return false, err
 				}
-				if val1 != val2 && !(err2 == jsonpatch.ErrMissing && err1 == jsonpatch.ErrMissing) {
+				if !reflect.DeepEqual(val1, val2) && !(err2 == jsonpatch.ErrMissing && err1 == jsonpatch.ErrMissing) {
 					continue
 				}
 				found = append(found, true)
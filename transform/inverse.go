@@ -0,0 +1,177 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// InversePatch computes the patch reverting patch when applied to the result
+// of applying patch to original, e.g. to roll back a transform. Removed and
+// replaced values are captured from original, so patch must be valid for it.
+// Like the patches of the Runner, patch may add annotations to an original
+// without any.
+func InversePatch(original unstructured.Unstructured, patch jsonpatch.Patch) (jsonpatch.Patch, error) {
+	doc, err := patchableDocument(original)
+	if err != nil {
+		return nil, err
+	}
+
+	inverse := []map[string]interface{}{}
+	for _, op := range patch {
+		var current interface{}
+		if err := json.Unmarshal(doc, &current); err != nil {
+			return nil, err
+		}
+		ops, err := invertOperation(current, op)
+		if err != nil {
+			return nil, err
+		}
+		// The inverse operations are applied in the reverse order.
+		inverse = append(ops, inverse...)
+
+		doc, err = jsonpatch.Patch{op}.Apply(doc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The annotations patch added to an original without any are removed
+	// altogether.
+	if _, ok, _ := unstructured.NestedFieldNoCopy(original.Object, "metadata", "annotations"); !ok {
+		var patched interface{}
+		if err := json.Unmarshal(doc, &patched); err != nil {
+			return nil, err
+		}
+		if annotations, ok := valueAtPointer(patched, "/metadata/annotations"); ok {
+			if a, ok := annotations.(map[string]interface{}); ok && len(a) > 0 {
+				inverse = append(inverse, map[string]interface{}{"op": "remove", "path": "/metadata/annotations"})
+			}
+		}
+	}
+
+	patchJSON, err := json.Marshal(inverse)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.DecodePatch(patchJSON)
+}
+
+// invertOperation returns the operations reverting op on doc.
+func invertOperation(doc interface{}, op jsonpatch.Operation) ([]map[string]interface{}, error) {
+	switch op.Kind() {
+	case "test":
+		return nil, nil
+	case "remove", "replace":
+		path, err := op.Path()
+		if err != nil {
+			return nil, err
+		}
+		value, ok := valueAtPointer(doc, path)
+		if !ok {
+			return nil, fmt.Errorf("unable to invert %v operation: %v does not exist", op.Kind(), path)
+		}
+		kind := "add"
+		if op.Kind() == "replace" {
+			kind = "replace"
+		}
+		return []map[string]interface{}{{"op": kind, "path": path, "value": value}}, nil
+	case "add", "copy":
+		path, err := op.Path()
+		if err != nil {
+			return nil, err
+		}
+		return invertInsert(doc, path)
+	case "move":
+		from, err := op.From()
+		if err != nil {
+			return nil, err
+		}
+		path, err := op.Path()
+		if err != nil {
+			return nil, err
+		}
+		ops, err := invertInsert(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		// The value is moved back, then the value it overwrote, if any, is
+		// restored.
+		restore := ops[0]
+		ops = []map[string]interface{}{{"op": "move", "from": restore["path"], "path": from}}
+		if restore["op"] == "replace" {
+			ops = append(ops, map[string]interface{}{"op": "add", "path": path, "value": restore["value"]})
+		}
+		return ops, nil
+	}
+	return nil, fmt.Errorf("unable to invert unsupported operation %v", op.Kind())
+}
+
+// invertInsert returns the operations reverting a value being set at path:
+// the previous value of an object member is restored, other values are
+// removed.
+func invertInsert(doc interface{}, path string) ([]map[string]interface{}, error) {
+	parentPath, key := splitPointer(path)
+	parent, ok := valueAtPointer(doc, parentPath)
+	if !ok {
+		return nil, fmt.Errorf("unable to invert operation: %v does not exist", parentPath)
+	}
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if value, ok := p[key]; ok {
+			return []map[string]interface{}{{"op": "replace", "path": path, "value": value}}, nil
+		}
+	case []interface{}:
+		if key == "-" {
+			// Appended values end up after the current elements.
+			path = parentPath + "/" + strconv.Itoa(len(p))
+		}
+	}
+	return []map[string]interface{}{{"op": "remove", "path": path}}, nil
+}
+
+// splitPointer splits a JSON pointer into the pointer of its parent and its
+// unescaped last reference token.
+func splitPointer(pointer string) (string, string) {
+	i := strings.LastIndex(pointer, "/")
+	if i < 0 {
+		return "", unescapePointerToken(pointer)
+	}
+	return pointer[:i], unescapePointerToken(pointer[i+1:])
+}
+
+func unescapePointerToken(token string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+}
+
+// valueAtPointer returns the value of doc the JSON pointer refers to.
+func valueAtPointer(doc interface{}, pointer string) (interface{}, bool) {
+	if pointer == "" {
+		return doc, true
+	}
+	current := doc
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = unescapePointerToken(token)
+		switch c := current.(type) {
+		case map[string]interface{}:
+			value, ok := c[token]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			current = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
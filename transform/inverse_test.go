@@ -0,0 +1,168 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestInversePatch(t *testing.T) {
+	original := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "Service",
+			"apiVersion": "v1",
+			"metadata": map[string]interface{}{
+				"name": "frontend",
+				"annotations": map[string]interface{}{
+					"example.com/owner": "team-a",
+				},
+			},
+			"spec": map[string]interface{}{
+				"clusterIP": "172.30.12.4",
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(80)},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		Name  string
+		Patch string
+	}{
+		{
+			Name:  "Add",
+			Patch: `[{"op": "add", "path": "/metadata/labels", "value": {"migrated": "true"}}]`,
+		},
+		{
+			Name:  "AddOverwritingMember",
+			Patch: `[{"op": "add", "path": "/metadata/annotations/example.com~1owner", "value": "team-b"}]`,
+		},
+		{
+			Name:  "AddToArray",
+			Patch: `[{"op": "add", "path": "/spec/ports/-", "value": {"port": 443}}, {"op": "add", "path": "/spec/ports/0", "value": {"port": 8080}}]`,
+		},
+		{
+			Name:  "Remove",
+			Patch: `[{"op": "remove", "path": "/spec/clusterIP"}]`,
+		},
+		{
+			Name:  "Replace",
+			Patch: `[{"op": "replace", "path": "/metadata/name", "value": "backend"}]`,
+		},
+		{
+			Name:  "Move",
+			Patch: `[{"op": "move", "from": "/spec/clusterIP", "path": "/metadata/name"}]`,
+		},
+		{
+			Name: "Combined",
+			Patch: `[{"op": "test", "path": "/metadata/name", "value": "frontend"},
+{"op": "remove", "path": "/spec/clusterIP"},
+{"op": "add", "path": "/spec/clusterIP", "value": "10.0.0.1"},
+{"op": "replace", "path": "/spec/clusterIP", "value": "10.0.0.2"},
+{"op": "copy", "from": "/metadata/annotations", "path": "/metadata/labels"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			patch, err := jsonpatch.DecodePatch([]byte(c.Patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			inverse, err := InversePatch(original, patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			doc, err := original.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, err = patch.Apply(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, err = inverse.Apply(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u := unstructured.Unstructured{}
+			if err := u.UnmarshalJSON(doc); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(u.Object, original.Object) {
+				t.Errorf("the inverse patch did not restore the original object, actual: %v expected: %v", u.Object, original.Object)
+			}
+		})
+	}
+}
+
+func TestInversePatchRunnerAnnotations(t *testing.T) {
+	original := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "Service",
+			"apiVersion": "v1",
+			"metadata": map[string]interface{}{
+				"name": "frontend",
+			},
+		},
+	}
+	plugin := fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+		p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/metadata/annotations/example.com~1owner", "value": "team-a"}]`))
+		if err != nil {
+			return PluginResponse{}, err
+		}
+		return PluginResponse{Patches: p}, nil
+	})
+
+	patches, _, err := (&Runner{}).Run(original, []Plugin{plugin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := jsonpatch.DecodePatch(patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inverse, err := InversePatch(original, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inversePatches, err := json.Marshal(inverse)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := applyPatch(original, patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched := unstructured.Unstructured{}
+	if err := patched.UnmarshalJSON(doc); err != nil {
+		t.Fatal(err)
+	}
+	doc, err = applyPatch(patched, inversePatches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(doc); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(u.Object, original.Object) {
+		t.Errorf("the inverse patch did not restore the original object, actual: %v expected: %v", u.Object, original.Object)
+	}
+}
+
+func TestInversePatchInvalid(t *testing.T) {
+	patch, err := jsonpatch.DecodePatch([]byte(`[{"op": "remove", "path": "/spec/missing"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InversePatch(unstructured.Unstructured{Object: map[string]interface{}{"kind": "Service"}}, patch); err == nil {
+		t.Error("expected an error inverting a patch not valid for the object")
+	}
+}
@@ -1,26 +1,34 @@
 package kubernetes
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	transform "github.com/konveyor/crane-lib/transform"
 	"github.com/konveyor/crane-lib/transform/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
-	containerImageUpdate     = "/spec/template/spec/containers/%v/image"
-	initContainerImageUpdate = "/spec/template/spec/initContainers/%v/image"
-	annotationInitial        = `%v
-{"op": "add", "path": "/metadata/annotations/%v", "value": "%v"}`
-	annotationNext = `%v,
-{"op": "add", "path": "/metadata/annotations/%v", "value": "%v"}`
-	updateImageString = `[
-{"op": "replace", "path": "%v", "value": "%v"}
-]`
+	podContainerImageUpdate     = "/spec/containers/%v/image"
+	podInitContainerImageUpdate = "/spec/initContainers/%v/image"
+
+	deploymentConfigTriggerNamespace = "/spec/triggers/%v/imageChangeParams/from/namespace"
+	deploymentConfigTriggerImage     = "/spec/triggers/%v/imageChangeParams/lastTriggeredImage"
+
 	podSelectedNode = `[
 {"op": "remove", "path": "/spec/nodeName"}
 ]`
@@ -34,6 +42,25 @@ const (
 
 	updateClusterIP = `[
 {"op": "remove", "path": "/spec/clusterIP"}
+]`
+
+	removeFinalizersString = `[
+{"op": "remove", "path": "/metadata/finalizers"}
+]`
+
+	removePathString = `[
+{"op": "remove", "path": "%v"}
+]`
+
+	replacePathString = `[
+{"op": "replace", "path": "%v", "value": %s}
+]`
+	testPathString = `[
+{"op": "test", "path": "%v", "value": %s}
+]`
+
+	updateFinalizersString = `[
+{"op": "replace", "path": "/metadata/finalizers", "value": %s}
 ]`
 )
 
@@ -52,6 +79,34 @@ var pvcGK = schema.GroupKind{
 	Kind:  "PersistentVolumeClaim",
 }
 
+var pvGK = schema.GroupKind{
+	Group: "",
+	Kind:  "PersistentVolume",
+}
+
+var ingressGK = schema.GroupKind{
+	Group: "networking.k8s.io",
+	Kind:  "Ingress",
+}
+
+var extensionsIngressGK = schema.GroupKind{
+	Group: "extensions",
+	Kind:  "Ingress",
+}
+
+// totalAnnotationSizeLimit is the limit the API server enforces on the total
+// size of the keys and values of an object's annotations.
+const totalAnnotationSizeLimit = 256 * (1 << 10)
+
+var routeGK = schema.GroupKind{
+	Group: "route.openshift.io",
+	Kind:  "Route",
+}
+
+// ingressClassAnnotation is the deprecated predecessor of
+// spec.ingressClassName.
+const ingressClassAnnotation = "kubernetes.io/ingress.class"
+
 var podGK = schema.GroupKind{
 	Group: "",
 	Kind:  "Pod",
@@ -62,183 +117,2457 @@ var serviceGK = schema.GroupKind{
 	Kind:  "Service",
 }
 
+var jobGK = schema.GroupKind{
+	Group: "batch",
+	Kind:  "Job",
+}
+
+// jobControllerLabels are added to a Job's pod template by the job controller
+// and reference the uid of the original Job.
+var jobControllerLabels = []string{
+	"controller-uid",
+	"batch.kubernetes.io/controller-uid",
+}
+
+var deploymentGK = schema.GroupKind{
+	Group: "apps",
+	Kind:  "Deployment",
+}
+
+var replicaSetGK = schema.GroupKind{
+	Group: "apps",
+	Kind:  "ReplicaSet",
+}
+
+var statefulSetGK = schema.GroupKind{
+	Group: "apps",
+	Kind:  "StatefulSet",
+}
+
+var daemonSetGK = schema.GroupKind{
+	Group: "apps",
+	Kind:  "DaemonSet",
+}
+
+// podTemplateHashLabel is managed by the workload controllers and is
+// regenerated on the destination cluster.
+const podTemplateHashLabel = "pod-template-hash"
+
+var deploymentConfigGK = schema.GroupKind{
+	Group: "apps.openshift.io",
+	Kind:  "DeploymentConfig",
+}
+
+var crdGK = schema.GroupKind{
+	Group: "apiextensions.k8s.io",
+	Kind:  "CustomResourceDefinition",
+}
+
+var validatingWebhookConfigurationGK = schema.GroupKind{
+	Group: "admissionregistration.k8s.io",
+	Kind:  "ValidatingWebhookConfiguration",
+}
+
+var mutatingWebhookConfigurationGK = schema.GroupKind{
+	Group: "admissionregistration.k8s.io",
+	Kind:  "MutatingWebhookConfiguration",
+}
+
+var secretGK = schema.GroupKind{
+	Group: "",
+	Kind:  "Secret",
+}
+
+var configMapGK = schema.GroupKind{
+	Group: "",
+	Kind:  "ConfigMap",
+}
+
+// jsonPointerEscaper escapes a key for use as a JSON pointer reference token (RFC 6901).
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
 type KubernetesTransformPlugin struct {
+	// AddedAnnotations are added to every object. The %NAMESPACE%, %NAME%
+	// and %KIND% placeholders in values are replaced with the namespace,
+	// name and kind of the object as found on the source cluster, any other
+	// text is used as is.
 	AddedAnnotations    map[string]string
 	RegistryReplacement map[string]string
 	NewNamespace        string
 	RemoveAnnotation    []string
+	// SourceNamespace is the namespace the objects are exported from. The
+	// webhook configurations and CustomResourceDefinitions are cluster
+	// scoped, only their webhook services in SourceNamespace are moved to
+	// NewNamespace.
+	SourceNamespace string
+	// RequireRegistryMatch fails the transform of Pods and pod templates
+	// with container images whose registry matches no RegistryReplacement
+	// rule, listing them, to catch registries missing from the mapping.
+	// Images already under a replacement registry match. With
+	// WarnUnmatchedRegistries the images are only reported in the Warnings of
+	// the response.
+	RequireRegistryMatch    bool
+	WarnUnmatchedRegistries bool
+	// RemoveFinalizers removes finalizers from the object so it is not stuck
+	// on a cluster lacking the controllers that own them. When
+	// RemoveFinalizerNames is empty all finalizers are removed, otherwise
+	// only the named ones.
+	RemoveFinalizers     bool
+	RemoveFinalizerNames []string
+	// StripSecretData removes all data and stringData from Secrets.
+	StripSecretData bool
+	// RemoveSecretKeys removes the named keys from the data and stringData of Secrets.
+	RemoveSecretKeys []string
+	// RemoveOwnerReferences removes ownerReferences, whose uids are not valid
+	// on the destination cluster, from objects that are not whited out.
+	RemoveOwnerReferences bool
+	// RemovePodTemplateHash removes the controller managed pod-template-hash
+	// label from the pod template and selector of Deployments, ReplicaSets,
+	// StatefulSets and DaemonSets.
+	RemovePodTemplateHash bool
+	// RemoveDeprecatedServiceAccount removes the deprecated spec.serviceAccount
+	// of Pods when it duplicates spec.serviceAccountName.
+	RemoveDeprecatedServiceAccount bool
+	// ClearImmutable removes the immutable field from ConfigMaps and Secrets.
+	ClearImmutable bool
+	// NormalizeShortImageNames expands image references without a registry,
+	// such as "nginx" or "user/repo", to their implied docker.io registry
+	// when no RegistryReplacement key matches them as written, so "docker.io"
+	// rules match them.
+	NormalizeShortImageNames bool
+	// ConsolidateAnnotations emits a single operation setting the whole
+	// annotations map, the object's existing annotations merged with
+	// AddedAnnotations less the removed annotations, instead of one
+	// operation per key. It does not depend on the object having an
+	// annotations map, and annotations both added and removed are removed.
+	ConsolidateAnnotations bool
+	// RemoveAnnotationsByPrefix removes every annotation of the object whose
+	// key starts with one of the prefixes, except those listed in
+	// KeepAnnotations.
+	RemoveAnnotationsByPrefix []string
+	KeepAnnotations           []string
+	// StripKubectlAnnotations removes the annotations kubectl records on the
+	// objects it applies, such as the last-applied-configuration capturing
+	// the state of the object on the source cluster.
+	StripKubectlAnnotations bool
+	// PruneEmptyAnnotations removes metadata.annotations altogether when the
+	// annotation removals, including the ones of the transforms such as the
+	// binding annotations of claims, leave it empty, rather than leaving an
+	// empty map that some tools report as a difference.
+	PruneEmptyAnnotations bool
+	// StripPodStatus removes the status and the RuntimeClass derived
+	// spec.overhead of Pods. Pods are not whited out, so standalone pods are
+	// recreated on the destination cluster: their spec.nodeName is always
+	// cleared so they are rescheduled, and this option clears the remaining
+	// fields bound to the source cluster.
+	StripPodStatus bool
+	// SafeReplace precedes the namespace and image replacements with a test
+	// operation asserting the value the replacement was computed from, so
+	// applying the patches to a changed object fails instead of silently
+	// overwriting the new value.
+	SafeReplace bool
+	// APIVersionMapping moves objects off deprecated or removed APIs. Keys
+	// are the old kind in the "Kind.version.group" form, such as
+	// "Deployment.v1beta1.extensions", and values the new apiVersion, such as
+	// "apps/v1". Objects of a matching kind get their apiVersion replaced,
+	// their other fields are left as is.
+	APIVersionMapping map[string]string
+	// TransformPVCsInline disables the whiteout of PersistentVolumeClaims,
+	// which are otherwise assumed to be handled by a different part of the
+	// tool chain. The claims are instead stripped of their binding to the
+	// source cluster's volume so they bind again on the destination.
+	TransformPVCsInline bool
+	// TransformEndpointSlices disables the whiteout of EndpointSlices, for
+	// headless services whose endpoints are managed by hand. Their
+	// ownerReferences are removed, and with NewNamespace the targetRefs of
+	// their endpoints in the slice's own namespace follow it.
+	TransformEndpointSlices bool
+	// PVCDataSourceMapping renames the VolumeSnapshot or
+	// PersistentVolumeClaim the spec.dataSource and spec.dataSourceRef of
+	// claims transformed with TransformPVCsInline are populated from, from
+	// the keys to the values. References to objects not in the mapping,
+	// which do not exist on the destination, are removed.
+	PVCDataSourceMapping map[string]string
+	// StripPVCVolumeName also disables the whiteout of
+	// PersistentVolumeClaims, but only removes their spec.volumeName, which
+	// pins them to a volume that does not exist on the destination. It is
+	// implied by TransformPVCsInline.
+	StripPVCVolumeName bool
+	// StorageClassMapping rewrites the storage class of PersistentVolumes,
+	// PersistentVolumeClaims and StatefulSet volumeClaimTemplates from the
+	// keys to the values. An empty value removes the storage class so the
+	// destination's default class is used. PersistentVolumeClaims are only
+	// rewritten along with TransformPVCsInline or StripPVCVolumeName, as
+	// they are whited out otherwise.
+	StorageClassMapping map[string]string
+	// IngressClassMapping rewrites the spec.ingressClassName and the
+	// deprecated kubernetes.io/ingress.class annotation of Ingresses from the
+	// keys to the values.
+	IngressClassMapping map[string]string
+	// HostDomainMapping rewrites the host names of Ingress rules and TLS
+	// entries and of OpenShift Routes under one of the key domains, such as
+	// "apps.old.example.com", to be under the value domain instead, keeping
+	// their subdomain, e.g. "shop.apps.old.example.com" becomes
+	// "shop.apps.new.example.com". Wildcard hosts are rewritten alike.
+	HostDomainMapping map[string]string
+	// RemoveNodePorts removes the nodePorts of Service ports, so they are
+	// allocated again rather than clashing on the destination cluster. When
+	// NodePortRange is set, such as "30000-32767", only the nodePorts outside
+	// of it are removed, keeping the ones valid on the destination.
+	RemoveNodePorts bool
+	NodePortRange   string
+	// ImageAnnotations are the keys of pod annotations holding image
+	// references, such as the sidecar.istio.io/proxyImage annotation of
+	// service meshes injecting sidecars. Their values are rewritten by
+	// RegistryReplacement like the images of containers.
+	ImageAnnotations []string
+	// ImageArchSuffixMapping rewrites image tags ending with one of the keys,
+	// such as "-amd64", to end with the value instead, such as "-arm64", for
+	// registries publishing a tag per architecture. It applies to the same
+	// images as RegistryReplacement and combines with it. Images pinned by
+	// digest are left as is, as the digest takes precedence over the tag.
+	ImageArchSuffixMapping map[string]string
+	// LabelSelector, when set, restricts the plugin to objects whose labels
+	// match it, e.g. "team=payments". Other objects are left untouched and
+	// are not whited out.
+	LabelSelector string
+	// RemoveStatefulSetStatus removes the status of StatefulSets along with
+	// the status of their volumeClaimTemplates.
+	RemoveStatefulSetStatus bool
+	// RemoveDaemonSetStatus removes the status of DaemonSets.
+	RemoveDaemonSetStatus bool
+	// ClearHostNetworking removes hostNetwork, hostPID, hostIPC and the
+	// hostPorts of containers from Pods and pod templates, as they are bound
+	// to the nodes of the source cluster.
+	ClearHostNetworking bool
+	// StripTopologyConstraints removes the topologySpreadConstraints of Pods
+	// and pod templates, whose topology keys, such as
+	// topology.kubernetes.io/zone, may not label the nodes of the
+	// destination cluster and leave the pods unschedulable.
+	StripTopologyConstraints bool
+	// NormalizeDeploymentDefaults removes the revisionHistoryLimit and
+	// progressDeadlineSeconds of apps/v1 Deployments when they hold the
+	// Kubernetes defaults, 10 and 600, so the destination defaults them again
+	// and GitOps tools see no difference. Custom values are kept.
+	NormalizeDeploymentDefaults bool
+	// RemoveContainerEnv removes the environment variables with these names
+	// from the containers and init containers of Pods and pod templates, e.g.
+	// variables pointing at endpoints of the source cluster.
+	RemoveContainerEnv []string
+	// SetImagePullPolicy, when set, sets the imagePullPolicy of the
+	// containers and init containers of Pods and pod templates, e.g. to
+	// "Always" so images moved to a new registry are pulled from it. It must
+	// be one of "Always", "Never" or "IfNotPresent".
+	SetImagePullPolicy string
+	// ResourceOverride sets the resource requests and limits of the
+	// containers and init containers of Pods and pod templates, e.g. to
+	// scale them down for a destination cluster with less capacity.
+	// Overrides naming a container take precedence over "*" overrides.
+	ResourceOverride []ContainerResourceOverride
+	// StripServiceAccountTokenVolumes removes the volumes holding the
+	// service account token of Pods, the projected kube-api-access- volumes
+	// and the legacy default-token- secret volumes, along with their
+	// volumeMounts. They are injected again on the destination cluster and
+	// otherwise reference the source cluster's token.
+	StripServiceAccountTokenVolumes bool
+	// DisableServiceTransform, DisableImageReplacement and
+	// DisablePodFieldRemoval turn off built-in transforms, so a shared
+	// configuration can be tuned without removing the plugin. They
+	// respectively keep the clusterIPs, load balancer fields and nodePorts
+	// of Services, the images rewritten by RegistryReplacement,
+	// ImageArchSuffixMapping and NormalizeShortImageNames, and the fields
+	// removed from Pods and the nodeName of pod templates.
+	DisableServiceTransform bool
+	DisableImageReplacement bool
+	DisablePodFieldRemoval  bool
+	// WhiteoutPredicate, when set, is consulted for objects the built-in
+	// rules keep, returning whether to white out the object and why. It can
+	// only add whiteouts, objects whited out by the built-in rules are never
+	// passed to it.
+	WhiteoutPredicate func(obj unstructured.Unstructured) (bool, string) `json:"-"`
+}
+
+// ContainerResourceOverride sets the resource requests and limits of the
+// containers named Container, or of every container when it is "*". Requests
+// and Limits map resource names, such as "cpu" or "memory", to quantities,
+// such as "100m" or "128Mi". The other resources of the containers are kept.
+type ContainerResourceOverride struct {
+	Container string            `json:"container"`
+	Requests  map[string]string `json:"requests,omitempty"`
+	Limits    map[string]string `json:"limits,omitempty"`
+}
+
+// NewKubernetesTransformPlugin validates the given configuration and returns
+// it as a Plugin. Using a KubernetesTransformPlugin value directly skips this
+// validation, configuration errors then only surface when patches are built
+// or applied.
+func NewKubernetesTransformPlugin(k KubernetesTransformPlugin) (transform.Plugin, error) {
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// NewKubernetesTransformPluginFromJSON configures the plugin from a JSON
+// object whose keys are the option names, e.g.
+// {"addedAnnotations": {"example.com/migrated": "true"}, "newNamespace": "dest"}.
+// Keys match the option names case insensitively and unknown keys are
+// rejected, the configuration is then validated like with
+// NewKubernetesTransformPlugin.
+func NewKubernetesTransformPluginFromJSON(config []byte) (transform.Plugin, error) {
+	k := KubernetesTransformPlugin{}
+	decoder := json.NewDecoder(bytes.NewReader(config))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&k); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return NewKubernetesTransformPlugin(k)
+}
+
+// Validate checks that the configured options are well formed.
+func (k KubernetesTransformPlugin) Validate() error {
+	if k.NewNamespace != "" {
+		if errs := validation.IsDNS1123Label(k.NewNamespace); len(errs) > 0 {
+			return fmt.Errorf("invalid NewNamespace %q: %v", k.NewNamespace, strings.Join(errs, "; "))
+		}
+	}
+	if k.SourceNamespace != "" {
+		if errs := validation.IsDNS1123Label(k.SourceNamespace); len(errs) > 0 {
+			return fmt.Errorf("invalid SourceNamespace %q: %v", k.SourceNamespace, strings.Join(errs, "; "))
+		}
+	}
+	for registry, replacement := range k.RegistryReplacement {
+		if registry == "" || replacement == "" {
+			return fmt.Errorf("invalid RegistryReplacement %q=%q: registries must not be empty", registry, replacement)
+		}
+	}
+	switch v1.PullPolicy(k.SetImagePullPolicy) {
+	case "", v1.PullAlways, v1.PullNever, v1.PullIfNotPresent:
+	default:
+		return fmt.Errorf("invalid SetImagePullPolicy %q: must be one of %v, %v or %v", k.SetImagePullPolicy, v1.PullAlways, v1.PullNever, v1.PullIfNotPresent)
+	}
+	for name, target := range k.PVCDataSourceMapping {
+		if name == "" || target == "" {
+			return fmt.Errorf("invalid PVCDataSourceMapping %q=%q: names must not be empty", name, target)
+		}
+	}
+	for _, name := range k.RemoveContainerEnv {
+		if errs := validation.IsEnvVarName(name); len(errs) > 0 {
+			return fmt.Errorf("invalid RemoveContainerEnv name %q: %v", name, strings.Join(errs, "; "))
+		}
+	}
+	for _, override := range k.ResourceOverride {
+		if override.Container == "" {
+			return fmt.Errorf("invalid ResourceOverride: container must not be empty, use \"*\" for all containers")
+		}
+		if err := validateResourceQuantities(override); err != nil {
+			return err
+		}
+	}
+	for suffix := range k.ImageArchSuffixMapping {
+		if suffix == "" {
+			return fmt.Errorf("invalid ImageArchSuffixMapping: suffixes must not be empty")
+		}
+	}
+	for key := range k.AddedAnnotations {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid annotation key %q in AddedAnnotations: %v", key, strings.Join(errs, "; "))
+		}
+	}
+	if err := validateAnnotationsSize(k.AddedAnnotations); err != nil {
+		return err
+	}
+	for _, key := range k.RemoveAnnotation {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid annotation key %q in RemoveAnnotation: %v", key, strings.Join(errs, "; "))
+		}
+	}
+	for storageClass := range k.StorageClassMapping {
+		if storageClass == "" {
+			return fmt.Errorf("invalid StorageClassMapping: source storage classes must not be empty")
+		}
+	}
+	if k.NodePortRange != "" {
+		if _, err := utilnet.ParsePortRange(k.NodePortRange); err != nil {
+			return fmt.Errorf("invalid NodePortRange %q: %v", k.NodePortRange, err)
+		}
+	}
+	if _, err := labels.Parse(k.LabelSelector); err != nil {
+		return fmt.Errorf("invalid LabelSelector %q: %v", k.LabelSelector, err)
+	}
+	for ingressClass, replacement := range k.IngressClassMapping {
+		if ingressClass == "" || replacement == "" {
+			return fmt.Errorf("invalid IngressClassMapping %q=%q: ingress classes must not be empty", ingressClass, replacement)
+		}
+	}
+	for domain, replacement := range k.HostDomainMapping {
+		if domain == "" || replacement == "" {
+			return fmt.Errorf("invalid HostDomainMapping %q=%q: domains must not be empty", domain, replacement)
+		}
+	}
+	for kind, apiVersion := range k.APIVersionMapping {
+		if _, _, err := parseAPIVersionMapping(kind, apiVersion); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (k KubernetesTransformPlugin) Run(u *unstructured.Unstructured) (transform.PluginResponse, error) {
 	resp := transform.PluginResponse{}
 	// Set version in the future
 	resp.Version = "v1"
-	var err error
-	resp.IsWhiteOut = k.getWhiteOuts(u.GroupVersionKind().GroupKind())
+	selected, err := k.selects(*u)
+	if err != nil {
+		return transform.PluginResponse{}, err
+	}
+	if !selected {
+		resp.Unhandled = true
+		return resp, nil
+	}
+	resp.IsWhiteOut, resp.WhiteOutReason = k.whiteOut(*u)
 	if resp.IsWhiteOut {
-		return resp, err
+		return resp, nil
+	}
+	transforms, err := k.getKubernetesTransforms(*u)
+	if err == nil {
+		resp.Patches, resp.Reasons, resp.Warnings = transforms.patch, transforms.reasons, transforms.warnings
 	}
-	resp.Patches, err = k.getKubernetesTransforms(*u)
+	// Objects of the kinds the plugin has transforms for are handled even
+	// when they need no change, e.g. when they were transformed already.
+	resp.Unhandled = err == nil && len(resp.Patches) == 0 && !k.recognizes(*u)
 	return resp, err
 
 }
 
 var _ transform.Plugin = &KubernetesTransformPlugin{}
 
-func (k KubernetesTransformPlugin) getWhiteOuts(groupKind schema.GroupKind) bool {
-	if groupKind == endpointGK {
-		return true
+// String identifies the plugin in the errors and metrics of the Runner.
+func (k KubernetesTransformPlugin) String() string {
+	return "KubernetesPlugin"
+}
+
+// WillWhiteOut reports whether Run would white out the object, and why,
+// without computing its patches. An invalid LabelSelector makes Run fail, no
+// object is reported as whited out then.
+func (k KubernetesTransformPlugin) WillWhiteOut(u unstructured.Unstructured) (bool, string) {
+	if selected, err := k.selects(u); err != nil || !selected {
+		return false, ""
 	}
+	return k.whiteOut(u)
+}
 
-	if groupKind == endpointSliceGK {
+// recognizes reports whether the plugin, as configured, has transforms
+// specific to the kind of the object, as opposed to the transforms of any
+// object such as the annotation changes.
+func (k KubernetesTransformPlugin) recognizes(u unstructured.Unstructured) bool {
+	if _, _, ok := types.NestedPodTemplate(u); ok {
+		return true
+	}
+	for kind, apiVersion := range k.APIVersionMapping {
+		if from, _, err := parseAPIVersionMapping(kind, apiVersion); err == nil && u.GroupVersionKind() == from {
+			return true
+		}
+	}
+	groupKind := u.GroupVersionKind().GroupKind()
+	if (len(k.RegistryReplacement) > 0 || len(k.ImageArchSuffixMapping) > 0) && len(types.ImagePaths(groupKind)) > 0 {
+		return true
+	}
+	switch groupKind {
+	case podGK, deploymentConfigGK, jobGK, secretGK, pvcGK:
 		return true
+	case serviceGK:
+		return !k.DisableServiceTransform
+	case endpointSliceGK:
+		return k.TransformEndpointSlices
+	case crdGK, validatingWebhookConfigurationGK, mutatingWebhookConfigurationGK:
+		return k.NewNamespace != "" && k.SourceNamespace != ""
+	case pvGK:
+		return len(k.StorageClassMapping) > 0
+	case ingressGK, extensionsIngressGK:
+		return len(k.IngressClassMapping) > 0 || len(k.HostDomainMapping) > 0
+	case routeGK:
+		return len(k.HostDomainMapping) > 0
+	}
+	return false
+}
+
+// selects reports whether the object matches the LabelSelector.
+func (k KubernetesTransformPlugin) selects(u unstructured.Unstructured) (bool, error) {
+	if k.LabelSelector == "" {
+		return true, nil
+	}
+	selector, err := labels.Parse(k.LabelSelector)
+	if err != nil {
+		return false, fmt.Errorf("invalid LabelSelector %q: %v", k.LabelSelector, err)
+	}
+	return selector.Matches(labels.Set(u.GetLabels())), nil
+}
+
+// whiteOut applies the built-in whiteout rules, then the WhiteoutPredicate.
+func (k KubernetesTransformPlugin) whiteOut(u unstructured.Unstructured) (bool, string) {
+	if isWhiteOut, reason := k.getWhiteOuts(u.GroupVersionKind().GroupKind()); isWhiteOut {
+		return true, reason
+	}
+	if k.WhiteoutPredicate != nil {
+		return k.WhiteoutPredicate(*u.DeepCopy())
+	}
+	return false, ""
+}
+
+func (k KubernetesTransformPlugin) getWhiteOuts(groupKind schema.GroupKind) (bool, string) {
+	if groupKind == endpointGK {
+		return true, "Endpoints auto-generated"
+	}
+
+	if groupKind == endpointSliceGK && !k.TransformEndpointSlices {
+		return true, "EndpointSlice auto-generated"
 	}
 
 	// For right now we assume PVC's are handled by a different part
 	// of the tool chain.
-	if groupKind == pvcGK {
-		return true
+	if groupKind == pvcGK && !k.TransformPVCsInline && !k.StripPVCVolumeName {
+		return true, "PVC handled separately"
 	}
-	return false
+	return false, ""
 }
 
-func (k KubernetesTransformPlugin) getKubernetesTransforms(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+func (k KubernetesTransformPlugin) getKubernetesTransforms(obj unstructured.Unstructured) (*patchBuilder, error) {
 
 	// Always attempt to add annotations for each thing.
-	jsonPatch := jsonpatch.Patch{}
-	if len(k.AddedAnnotations) > 0 {
-		patches, err := addAnnotations(k.AddedAnnotations)
+	jsonPatch := &patchBuilder{}
+	removed := k.annotationsToRemove(obj)
+	bindingRemoved := k.pvcBindingAnnotationsToRemove(obj, removed)
+	if k.ConsolidateAnnotations {
+		patches, err := k.mergeAnnotations(obj, expandAnnotations(obj, k.AddedAnnotations), append(removed, bindingRemoved...))
 		if err != nil {
 			return nil, err
 		}
-		jsonPatch = append(jsonPatch, patches...)
+		jsonPatch.add(patches, "set configured annotations")
+	} else {
+		if len(k.AddedAnnotations) > 0 {
+			patches, err := addAnnotations(obj.GetAnnotations(), expandAnnotations(obj, k.AddedAnnotations))
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "added configured annotation")
+		}
+		if len(removed) > 0 {
+			patches, err := removeAnnotations(obj.GetAnnotations(), removed)
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "removed configured annotation")
+		}
+		if len(bindingRemoved) > 0 {
+			patches, err := removeAnnotations(obj.GetAnnotations(), bindingRemoved)
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "removed binding to the source cluster's volume")
+		}
 	}
-	if podGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
-		patches, err := removePodSelectedNode()
-		if err != nil {
-			return nil, err
+	if podGK == obj.GetObjectKind().GroupVersionKind().GroupKind() && !k.DisablePodFieldRemoval {
+		if _, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "nodeName"); ok {
+			patches, err := removePodSelectedNode()
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "removed nodeName so the pod is scheduled on the destination cluster")
+		}
+
+		if k.RemoveDeprecatedServiceAccount {
+			patches, err := removeDeprecatedServiceAccount(obj)
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "removed deprecated serviceAccount duplicating serviceAccountName")
+		}
+
+		if k.StripPodStatus {
+			patches, err := removePodRuntimeFields(obj)
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "removed pod status and overhead bound to the source cluster")
+		}
+
+		if k.StripServiceAccountTokenVolumes {
+			spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+			patches, err := removeServiceAccountTokenVolumes(spec, "/spec")
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "removed service account token volume injected on the source cluster")
+		}
+	}
+	if _, ok := types.IsPodSpecable(obj); ok && podGK != obj.GetObjectKind().GroupVersionKind().GroupKind() && !k.DisablePodFieldRemoval {
+		// Pod templates are not expected to carry a nodeName, but one copied
+		// from a scheduled pod pins every pod of the workload to a node of
+		// the source cluster.
+		if spec, specPath := podSpec(obj); spec["nodeName"] != nil {
+			patches, err := removePath(specPath + "/nodeName")
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "removed nodeName so the pods are scheduled on the destination cluster")
 		}
-		jsonPatch = append(jsonPatch, patches...)
 	}
-	if len(k.RegistryReplacement) > 0 {
+	if len(k.RegistryReplacement) > 0 || len(k.ImageArchSuffixMapping) > 0 || k.RequireRegistryMatch {
 		if podGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
-			// jsonPatch for return
+			pod := v1.Pod{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &pod); err != nil {
+				return nil, err
+			}
+			if err := k.replaceContainerImages(jsonPatch, pod.Spec.Containers, podContainerImageUpdate); err != nil {
+				return nil, err
+			}
+			if err := k.replaceContainerImages(jsonPatch, pod.Spec.InitContainers, podInitContainerImageUpdate); err != nil {
+				return nil, err
+			}
+			if err := k.replaceAnnotationImages(jsonPatch, pod.Annotations, "/metadata/annotations/"); err != nil {
+				return nil, err
+			}
 		} else if template, ok := types.IsPodSpecable(obj); ok {
-			jps := jsonpatch.Patch{}
-			for i, container := range template.Spec.Containers {
-				updatedImage, update := updateImageRegistry(k.RegistryReplacement, container.Image)
-				if update {
-					jp, err := updateImage(fmt.Sprintf(containerImageUpdate, i), updatedImage)
-					if err != nil {
-						return nil, err
-					}
-					jps = append(jps, jp...)
-				}
+			templatePath := types.PodTemplatePath(obj.GroupVersionKind().GroupKind())
+			if err := k.replaceContainerImages(jsonPatch, template.Spec.Containers, templatePath+podContainerImageUpdate); err != nil {
+				return nil, err
 			}
-			for i, container := range template.Spec.InitContainers {
-				updatedImage, update := updateImageRegistry(k.RegistryReplacement, container.Image)
-				if update {
-					jp, err := updateImage(fmt.Sprintf(initContainerImageUpdate, i), updatedImage)
-					if err != nil {
-						return nil, err
-					}
-					jps = append(jps, jp...)
-				}
+			if err := k.replaceContainerImages(jsonPatch, template.Spec.InitContainers, templatePath+podInitContainerImageUpdate); err != nil {
+				return nil, err
+			}
+			if err := k.replaceAnnotationImages(jsonPatch, template.Annotations, templatePath+"/metadata/annotations/"); err != nil {
+				return nil, err
+			}
+		}
+		if len(jsonPatch.unmatchedImages) > 0 {
+			message := fmt.Sprintf("images of %v %v/%v match no RegistryReplacement rule: %v", obj.GetKind(), obj.GetNamespace(), obj.GetName(), strings.Join(jsonPatch.unmatchedImages, ", "))
+			if !k.WarnUnmatchedRegistries {
+				return nil, errors.New(message)
 			}
-			jsonPatch = append(jsonPatch, jps...)
+			jsonPatch.warnings = append(jsonPatch.warnings, message)
+		}
+	}
+	if len(k.RegistryReplacement) > 0 || len(k.ImageArchSuffixMapping) > 0 {
+		if err := k.replaceRegisteredImages(jsonPatch, obj); err != nil {
+			return nil, err
 		}
 	}
-	if obj.GetObjectKind().GroupVersionKind().GroupKind() == serviceGK {
-		patches, err := removeServiceClusterIPs()
+	if obj.GetObjectKind().GroupVersionKind().GroupKind() == deploymentConfigGK {
+		patches, reasons, err := k.updateDeploymentConfigTriggers(obj)
 		if err != nil {
 			return nil, err
 		}
-		jsonPatch = append(jsonPatch, patches...)
+		jsonPatch.patch = append(jsonPatch.patch, patches...)
+		jsonPatch.reasons = append(jsonPatch.reasons, reasons...)
 	}
+	if obj.GetObjectKind().GroupVersionKind().GroupKind() == serviceGK && !k.DisableServiceTransform {
+		patches, err := removeServiceClusterIPs(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed clusterIP so it is allocated on the destination cluster")
 
-	return jsonPatch, nil
-}
+		patches, err = removeLoadBalancerFields(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed load balancer address bound to the source cluster")
 
-func updateImageRegistry(registryReplacements map[string]string, oldImageName string) (string, bool) {
-	// Break up oldImage to get the registry URL. Assume all manifests are using fully qualified image paths, if not ignore.
-	imageParts := strings.Split(oldImageName, "/")
-	if len(imageParts) != 3 {
-		return "", false
+		if k.RemoveNodePorts {
+			patches, err := k.removeNodePorts(obj)
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "removed nodePort so it is allocated on the destination cluster")
+		}
 	}
-	if newRegistry, ok := registryReplacements[imageParts[0]]; ok {
-		return strings.Join([]string{newRegistry, imageParts[1], imageParts[2]}, "/"), true
+	if k.RemoveFinalizers && len(obj.GetFinalizers()) > 0 {
+		patches, err := removeFinalizers(obj.GetFinalizers(), k.RemoveFinalizerNames)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed finalizers")
 	}
-
-	return "", false
-}
-
-func addAnnotations(addedAnnotations map[string]string) (jsonpatch.Patch, error) {
-	patchJSON := `[`
-	i := 0
-	for key, value := range addedAnnotations {
-		if i == 0 {
-			patchJSON = fmt.Sprintf(annotationInitial, patchJSON, key, value)
-		} else {
-			patchJSON = fmt.Sprintf(annotationNext, patchJSON, key, value)
+	if k.RemoveOwnerReferences && len(obj.GetOwnerReferences()) > 0 {
+		patches, err := removePath("/metadata/ownerReferences")
+		if err != nil {
+			return nil, err
 		}
-		i++
+		jsonPatch.add(patches, "removed ownerReferences because the owner uids are not valid on the destination cluster")
 	}
-
-	patchJSON = fmt.Sprintf("%v]", patchJSON)
-	patch, err := jsonpatch.DecodePatch([]byte(patchJSON))
-	if err != nil {
-		fmt.Printf("%v", patchJSON)
-		return nil, err
+	if k.TransformEndpointSlices && obj.GetObjectKind().GroupVersionKind().GroupKind() == endpointSliceGK {
+		patches, reasons, err := k.updateEndpointSlice(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.patch = append(jsonPatch.patch, patches...)
+		jsonPatch.reasons = append(jsonPatch.reasons, reasons...)
 	}
-	return patch, nil
-}
-
-func updateImage(containerImagePath, updatedImagePath string) (jsonpatch.Patch, error) {
-	patchJSON := fmt.Sprintf(updateImageString, containerImagePath, updatedImagePath)
-
-	patch, err := jsonpatch.DecodePatch([]byte(patchJSON))
-	if err != nil {
-		return nil, err
+	if k.RemovePodTemplateHash && isWorkload(obj.GetObjectKind().GroupVersionKind().GroupKind()) {
+		patches, err := removePodTemplateHash(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed controller managed pod-template-hash label")
 	}
-	return patch, nil
-}
-
-func removePodSelectedNode() (jsonpatch.Patch, error) {
-	patch, err := jsonpatch.DecodePatch([]byte(podSelectedNode))
-	if err != nil {
-		return nil, err
+	if obj.GetObjectKind().GroupVersionKind().GroupKind() == jobGK {
+		patches, err := removeJobControllerFields(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed job controller generated selector and labels")
 	}
-	return patch, nil
-}
-
-func updateNamespace(newNamespace string) (jsonpatch.Patch, error) {
-	patchJSON := fmt.Sprintf(updateNamespaceString, newNamespace)
+	if obj.GetObjectKind().GroupVersionKind().GroupKind() == secretGK {
+		patches, err := k.removeSecretData(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed secret data")
 
-	patch, err := jsonpatch.DecodePatch([]byte(patchJSON))
-	if err != nil {
-		return nil, err
+		if len(k.RegistryReplacement) > 0 && !k.DisableImageReplacement {
+			patches, err := k.updateDockerConfigRegistries(obj)
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "rewrote registries of the image pull credentials")
+		}
 	}
-	return patch, nil
-}
-
-func updateRoleBindingSVCACCTNamespace(newNamespace string, numberOfSubjects int) (jsonpatch.Patch, error) {
-	patchJSON := "["
-	for i := 0; i < numberOfSubjects; i++ {
-		if i != 0 {
-			patchJSON = fmt.Sprintf("%v,", patchJSON)
+	if k.NewNamespace != "" {
+		patches, err := k.updateWebhookServiceNamespaces(obj)
+		if err != nil {
+			return nil, err
 		}
-		patchJSON = fmt.Sprintf(updateRoleBindingSVCACCTNamspacestring, patchJSON, i, newNamespace)
+		jsonPatch.add(patches, fmt.Sprintf("rewrote webhook service namespace to %v", k.NewNamespace))
 	}
-
-	patch, err := jsonpatch.DecodePatch([]byte(patchJSON))
-	if err != nil {
-		return nil, err
+	if k.ClearImmutable && isImmutable(obj) {
+		patches, err := removePath("/immutable")
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed immutable so the object can be updated on the destination cluster")
 	}
-	return patch, nil
-}
+	if obj.GetObjectKind().GroupVersionKind().GroupKind() == pvcGK && k.TransformPVCsInline {
+		patches, err := removePVCBinding(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed binding to the source cluster's volume")
 
-func removeServiceClusterIPs() (jsonpatch.Patch, error) {
-	patch, err := jsonpatch.DecodePatch([]byte(updateClusterIP))
+		patches, reasons, err := k.updatePVCDataSource(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.patch = append(jsonPatch.patch, patches...)
+		jsonPatch.reasons = append(jsonPatch.reasons, reasons...)
+	} else if obj.GetObjectKind().GroupVersionKind().GroupKind() == pvcGK && k.StripPVCVolumeName {
+		if _, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "volumeName"); ok {
+			patches, err := removePath("/spec/volumeName")
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "removed volumeName bound to the source cluster's volume")
+		}
+	}
+	if k.ClearHostNetworking {
+		spec, specPath := podSpec(obj)
+		patches, err := removeHostNetworking(spec, specPath)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed host networking bound to the source cluster's nodes")
+	}
+	if k.StripTopologyConstraints {
+		if spec, specPath := podSpec(obj); spec["topologySpreadConstraints"] != nil {
+			patches, err := removePath(specPath + "/topologySpreadConstraints")
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "removed topologySpreadConstraints whose topology keys may not exist on the destination cluster")
+		}
+	}
+	if len(k.RemoveContainerEnv) > 0 {
+		spec, specPath := podSpec(obj)
+		patches, err := removeContainerEnv(spec, specPath, k.RemoveContainerEnv)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed configured container environment variable")
+	}
+	if k.SetImagePullPolicy != "" {
+		spec, specPath := podSpec(obj)
+		patches, err := k.setImagePullPolicy(spec, specPath)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, fmt.Sprintf("set imagePullPolicy to %v", k.SetImagePullPolicy))
+	}
+	if len(k.ResourceOverride) > 0 {
+		spec, specPath := podSpec(obj)
+		patches, err := k.overrideResources(spec, specPath)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "overrode configured container resources")
+	}
+	if k.RemoveStatefulSetStatus && obj.GetObjectKind().GroupVersionKind().GroupKind() == statefulSetGK {
+		patches, err := removeStatefulSetStatus(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed StatefulSet status managed by the source cluster's controllers")
+	}
+	if k.RemoveDaemonSetStatus && obj.GetObjectKind().GroupVersionKind().GroupKind() == daemonSetGK {
+		if _, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "status"); ok {
+			patches, err := removePath("/status")
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch.add(patches, "removed DaemonSet status managed by the source cluster's controllers")
+		}
+	}
+	if k.NormalizeDeploymentDefaults && obj.GroupVersionKind() == deploymentGK.WithVersion("v1") {
+		patches, err := removeDeploymentDefaults(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, "removed field set to the Kubernetes default")
+	}
+	if len(k.StorageClassMapping) > 0 {
+		patches, reasons, err := k.updateStorageClasses(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.patch = append(jsonPatch.patch, patches...)
+		jsonPatch.reasons = append(jsonPatch.reasons, reasons...)
+	}
+	if gk := obj.GetObjectKind().GroupVersionKind().GroupKind(); len(k.IngressClassMapping) > 0 && (gk == ingressGK || gk == extensionsIngressGK) {
+		patches, reasons, err := k.updateIngressClass(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.patch = append(jsonPatch.patch, patches...)
+		jsonPatch.reasons = append(jsonPatch.reasons, reasons...)
+	}
+	if gk := obj.GetObjectKind().GroupVersionKind().GroupKind(); len(k.HostDomainMapping) > 0 && (gk == ingressGK || gk == extensionsIngressGK || gk == routeGK) {
+		patches, reasons, err := k.updateHostDomains(obj)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.patch = append(jsonPatch.patch, patches...)
+		jsonPatch.reasons = append(jsonPatch.reasons, reasons...)
+	}
+	for kind, apiVersion := range k.APIVersionMapping {
+		from, to, err := parseAPIVersionMapping(kind, apiVersion)
+		if err != nil {
+			return nil, err
+		}
+		if obj.GroupVersionKind() != from {
+			continue
+		}
+		patches, err := replacePath("/apiVersion", to.String())
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch.add(patches, fmt.Sprintf("converted apiVersion %v→%v", from.GroupVersion(), to))
+	}
+
+	if k.PruneEmptyAnnotations && !k.ConsolidateAnnotations {
+		if err := pruneAnnotations(obj, jsonPatch); err != nil {
+			return nil, err
+		}
+	}
+	return jsonPatch, nil
+}
+
+// pruneAnnotations replaces the removals of the object's annotations with the
+// removal of metadata.annotations when, once all transforms ran, they remove
+// every annotation and no other operation touches the annotations.
+func pruneAnnotations(obj unstructured.Unstructured, jsonPatch *patchBuilder) error {
+	if len(obj.GetAnnotations()) == 0 {
+		return nil
+	}
+	removed := map[string]bool{}
+	first := -1
+	for i, op := range jsonPatch.patch {
+		path, err := op.Path()
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(path+"/", "/metadata/annotations/") {
+			continue
+		}
+		if op.Kind() != "remove" || path == "/metadata/annotations" {
+			return nil
+		}
+		removed[path] = true
+		if first < 0 {
+			first = i
+		}
+	}
+	for key := range obj.GetAnnotations() {
+		if !removed[annotationPath(key)] {
+			return nil
+		}
+	}
+
+	prune, err := removePath("/metadata/annotations")
+	if err != nil {
+		return err
+	}
+	pruned := patchBuilder{unmatchedImages: jsonPatch.unmatchedImages, warnings: jsonPatch.warnings}
+	for i, op := range jsonPatch.patch {
+		if i == first {
+			pruned.add(prune, "removed annotations left empty by the removed annotations")
+		}
+		if path, _ := op.Path(); removed[path] {
+			continue
+		}
+		pruned.add(jsonpatch.Patch{op}, "")
+		if i < len(jsonPatch.reasons) {
+			pruned.reasons[len(pruned.reasons)-1] = jsonPatch.reasons[i]
+		}
+	}
+	*jsonPatch = pruned
+	return nil
+}
+
+// validateAnnotationsSize checks that the added annotations alone fit in the
+// annotation size limit, naming the largest one when they do not, as adding
+// them would make the API server reject every object.
+func validateAnnotationsSize(annotations map[string]string) error {
+	size, largest := 0, ""
+	for key, value := range annotations {
+		size += len(key) + len(value)
+		if largest == "" || len(key)+len(value) > len(largest)+len(annotations[largest]) {
+			largest = key
+		}
+	}
+	if size > totalAnnotationSizeLimit {
+		return fmt.Errorf("invalid AddedAnnotations: total size of %v bytes exceeds the limit of %v bytes, the largest annotation is %q with %v bytes", size, totalAnnotationSizeLimit, largest, len(largest)+len(annotations[largest]))
+	}
+	return nil
+}
+
+// parseAPIVersionMapping parses an APIVersionMapping entry.
+func parseAPIVersionMapping(kind, apiVersion string) (schema.GroupVersionKind, schema.GroupVersion, error) {
+	from, _ := schema.ParseKindArg(kind)
+	if from == nil {
+		return schema.GroupVersionKind{}, schema.GroupVersion{}, fmt.Errorf("invalid APIVersionMapping kind %q: expected Kind.version.group", kind)
+	}
+	to, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil || to.Version == "" {
+		return schema.GroupVersionKind{}, schema.GroupVersion{}, fmt.Errorf("invalid APIVersionMapping apiVersion %q for %q", apiVersion, kind)
+	}
+	return *from, to, nil
+}
+
+// updateEndpointSlice removes the ownerReferences of an EndpointSlice, unless
+// RemoveOwnerReferences already does, and points the targetRefs of its
+// endpoints in the slice's namespace at NewNamespace.
+func (k KubernetesTransformPlugin) updateEndpointSlice(obj unstructured.Unstructured) (jsonpatch.Patch, []string, error) {
+	jsonPatch := &patchBuilder{}
+	if !k.RemoveOwnerReferences && len(obj.GetOwnerReferences()) > 0 {
+		patch, err := removePath("/metadata/ownerReferences")
+		if err != nil {
+			return nil, nil, err
+		}
+		jsonPatch.add(patch, "removed ownerReferences because the owner uids are not valid on the destination cluster")
+	}
+	if k.NewNamespace == "" || k.NewNamespace == obj.GetNamespace() {
+		return jsonPatch.patch, jsonPatch.reasons, nil
+	}
+	endpoints, _, _ := unstructured.NestedSlice(obj.Object, "endpoints")
+	for i, e := range endpoints {
+		endpoint, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		namespace, ok, _ := unstructured.NestedString(endpoint, "targetRef", "namespace")
+		if !ok || namespace != obj.GetNamespace() {
+			continue
+		}
+		patch, err := k.replace(fmt.Sprintf("/endpoints/%v/targetRef/namespace", i), namespace, k.NewNamespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		jsonPatch.add(patch, fmt.Sprintf("rewrote endpoint targetRef namespace %v→%v", namespace, k.NewNamespace))
+	}
+	return jsonPatch.patch, jsonPatch.reasons, nil
+}
+
+// updateWebhookServiceNamespaces points the webhook services in the source
+// namespace referenced by CustomResourceDefinition conversion webhooks and
+// admission webhook configurations at NewNamespace. Being cluster scoped,
+// their source namespace is SourceNamespace rather than their own.
+func (k KubernetesTransformPlugin) updateWebhookServiceNamespaces(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	sourceNamespace := obj.GetNamespace()
+	if sourceNamespace == "" {
+		sourceNamespace = k.SourceNamespace
+	}
+	jsonPatch := jsonpatch.Patch{}
+	update := func(clientConfig map[string]interface{}, path string) error {
+		namespace, ok, _ := unstructured.NestedString(clientConfig, "service", "namespace")
+		if !ok || namespace != sourceNamespace || namespace == k.NewNamespace {
+			return nil
+		}
+		patch, err := k.replace(path, namespace, k.NewNamespace)
+		if err != nil {
+			return err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+		return nil
+	}
+
+	switch obj.GetObjectKind().GroupVersionKind().GroupKind() {
+	case crdGK:
+		clientConfig, _, _ := unstructured.NestedMap(obj.Object, "spec", "conversion", "webhook", "clientConfig")
+		if err := update(clientConfig, "/spec/conversion/webhook/clientConfig/service/namespace"); err != nil {
+			return nil, err
+		}
+	case validatingWebhookConfigurationGK, mutatingWebhookConfigurationGK:
+		webhooks, _, _ := unstructured.NestedSlice(obj.Object, "webhooks")
+		for i, w := range webhooks {
+			webhook, ok := w.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			clientConfig, _, _ := unstructured.NestedMap(webhook, "clientConfig")
+			if err := update(clientConfig, fmt.Sprintf("/webhooks/%v/clientConfig/service/namespace", i)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return jsonPatch, nil
+}
+
+// isImmutable reports whether the object is a ConfigMap or Secret with the immutable field set.
+func isImmutable(obj unstructured.Unstructured) bool {
+	groupKind := obj.GetObjectKind().GroupVersionKind().GroupKind()
+	if groupKind != configMapGK && groupKind != secretGK {
+		return false
+	}
+	_, ok := obj.UnstructuredContent()["immutable"]
+	return ok
+}
+
+// patchBuilder accumulates patches along with a human readable reason for each operation.
+type patchBuilder struct {
+	patch   jsonpatch.Patch
+	reasons []string
+	// unmatchedImages are the container images found to match no
+	// RegistryReplacement rule when RequireRegistryMatch is set.
+	unmatchedImages []string
+	// warnings are reported in the plugin response.
+	warnings []string
+}
+
+func (b *patchBuilder) add(patch jsonpatch.Patch, reason string) {
+	for range patch {
+		b.reasons = append(b.reasons, reason)
+	}
+	b.patch = append(b.patch, patch...)
+}
+
+// updateDeploymentConfigTriggers updates the image change triggers of an
+// OpenShift DeploymentConfig. Triggers referencing image streams in the
+// object's own namespace follow it to NewNamespace, and the last triggered
+// image is updated like the images of containers. The pod template itself is
+// handled like any other pod specable object.
+func (k KubernetesTransformPlugin) updateDeploymentConfigTriggers(obj unstructured.Unstructured) (jsonpatch.Patch, []string, error) {
+	triggers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "triggers")
+	jsonPatch := &patchBuilder{}
+	for i, t := range triggers {
+		trigger, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		namespace, ok, _ := unstructured.NestedString(trigger, "imageChangeParams", "from", "namespace")
+		if ok && k.NewNamespace != "" && namespace == obj.GetNamespace() && namespace != k.NewNamespace {
+			patch, err := k.replace(fmt.Sprintf(deploymentConfigTriggerNamespace, i), namespace, k.NewNamespace)
+			if err != nil {
+				return nil, nil, err
+			}
+			jsonPatch.add(patch, fmt.Sprintf("rewrote image change trigger namespace %v→%v", namespace, k.NewNamespace))
+		}
+		image, ok, _ := unstructured.NestedString(trigger, "imageChangeParams", "lastTriggeredImage")
+		if !ok {
+			continue
+		}
+		if updatedImage, update := k.replaceImage(image); update {
+			patch, err := k.replace(fmt.Sprintf(deploymentConfigTriggerImage, i), image, updatedImage)
+			if err != nil {
+				return nil, nil, err
+			}
+			jsonPatch.add(patch, fmt.Sprintf("rewrote image %v→%v", image, updatedImage))
+		}
+	}
+	return jsonPatch.patch, jsonPatch.reasons, nil
+}
+
+func isWorkload(groupKind schema.GroupKind) bool {
+	switch groupKind {
+	case deploymentGK, replicaSetGK, statefulSetGK, daemonSetGK:
+		return true
+	}
+	return false
+}
+
+// removePodTemplateHash removes the pod-template-hash label from the pod
+// template labels and the selector's matchLabels when present.
+func removePodTemplateHash(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	if _, ok := types.IsPodSpecable(obj); !ok {
+		return nil, nil
+	}
+	jsonPatch := jsonpatch.Patch{}
+	locations := []struct {
+		fields []string
+		path   string
+	}{
+		{[]string{"spec", "template", "metadata", "labels"}, "/spec/template/metadata/labels/"},
+		{[]string{"spec", "selector", "matchLabels"}, "/spec/selector/matchLabels/"},
+	}
+	for _, l := range locations {
+		labels, _, _ := unstructured.NestedMap(obj.Object, l.fields...)
+		if _, ok := labels[podTemplateHashLabel]; !ok {
+			continue
+		}
+		patch, err := removePath(l.path + jsonPointerEscaper.Replace(podTemplateHashLabel))
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	return jsonPatch, nil
+}
+
+// removeJobControllerFields removes the selector and pod template labels the
+// job controller generates, as they reference the uid of the original Job and
+// are regenerated when the Job is created. Jobs with a manualSelector keep
+// them, as the selector is then set by the user and is not regenerated.
+func removeJobControllerFields(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	jsonPatch := jsonpatch.Patch{}
+	if manual, _, _ := unstructured.NestedBool(obj.Object, "spec", "manualSelector"); manual {
+		return jsonPatch, nil
+	}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "selector"); ok {
+		patch, err := removePath("/spec/selector")
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	labels, _, _ := unstructured.NestedMap(obj.Object, "spec", "template", "metadata", "labels")
+	for _, label := range jobControllerLabels {
+		if _, ok := labels[label]; !ok {
+			continue
+		}
+		patch, err := removePath("/spec/template/metadata/labels/" + jsonPointerEscaper.Replace(label))
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	return jsonPatch, nil
+}
+
+func (k KubernetesTransformPlugin) removeSecretData(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	jsonPatch := jsonpatch.Patch{}
+	for _, field := range []string{"data", "stringData"} {
+		data, ok := obj.UnstructuredContent()[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if k.StripSecretData {
+			patch, err := removePath("/" + field)
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch = append(jsonPatch, patch...)
+			continue
+		}
+		for _, key := range k.RemoveSecretKeys {
+			if _, ok := data[key]; !ok {
+				continue
+			}
+			patch, err := removePath(fmt.Sprintf("/%v/%v", field, jsonPointerEscaper.Replace(key)))
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch = append(jsonPatch, patch...)
+		}
+	}
+	return jsonPatch, nil
+}
+
+// updateDockerConfigRegistries renames the registries of the credentials held
+// by kubernetes.io/dockerconfigjson Secrets according to RegistryReplacement,
+// so image pull credentials follow the images. Registries that already have
+// credentials under their new name are left as is.
+func (k KubernetesTransformPlugin) updateDockerConfigRegistries(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	if secretType, _, _ := unstructured.NestedString(obj.Object, "type"); secretType != string(v1.SecretTypeDockerConfigJson) {
+		return nil, nil
+	}
+	// The data removed by StripSecretData and RemoveSecretKeys can not be
+	// rewritten.
+	if k.StripSecretData {
+		return nil, nil
+	}
+	for _, key := range k.RemoveSecretKeys {
+		if key == v1.DockerConfigJsonKey {
+			return nil, nil
+		}
+	}
+	encoded, ok, _ := unstructured.NestedString(obj.Object, "data", v1.DockerConfigJsonKey)
+	if !ok {
+		return nil, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v of secret %v/%v: %v", v1.DockerConfigJsonKey, obj.GetNamespace(), obj.GetName(), err)
+	}
+	config := map[string]interface{}{}
+	if err := json.Unmarshal(decoded, &config); err != nil {
+		return nil, fmt.Errorf("invalid %v of secret %v/%v: %v", v1.DockerConfigJsonKey, obj.GetNamespace(), obj.GetName(), err)
+	}
+	auths, ok := config["auths"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	// Rename in a stable order so the result does not depend on map
+	// iteration when registries are renamed onto each other.
+	registries := make([]string, 0, len(auths))
+	for registry := range auths {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+	renamed := false
+	for _, registry := range registries {
+		replacement, ok := replaceAuthRegistry(k.RegistryReplacement, registry)
+		if !ok {
+			continue
+		}
+		if _, exists := auths[replacement]; exists {
+			continue
+		}
+		auths[replacement] = auths[registry]
+		delete(auths, registry)
+		renamed = true
+	}
+	if !renamed {
+		return nil, nil
+	}
+
+	updated, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return k.replace("/data/"+jsonPointerEscaper.Replace(v1.DockerConfigJsonKey), encoded, base64.StdEncoding.EncodeToString(updated))
+}
+
+// replaceAuthRegistry applies the registry replacements to a key of the auths
+// of a docker config, which is either a registry host or a URL such as
+// "https://quay.io/v1/".
+func replaceAuthRegistry(registryReplacements map[string]string, key string) (string, bool) {
+	scheme := ""
+	if i := strings.Index(key, "://"); i >= 0 {
+		scheme, key = key[:i+3], key[i+3:]
+	}
+	host, rest := key, ""
+	if i := strings.Index(key, "/"); i >= 0 {
+		host, rest = key[:i], key[i:]
+	}
+	replacement, ok := registryReplacements[host]
+	if !ok {
+		return "", false
+	}
+	return scheme + replacement + rest, true
+}
+
+// replaceImage applies RegistryReplacement and ImageArchSuffixMapping to the
+// image, unless DisableImageReplacement is set.
+func (k KubernetesTransformPlugin) replaceImage(image string) (string, bool) {
+	if k.DisableImageReplacement {
+		return "", false
+	}
+	updatedImage, registryUpdate := updateImageRegistry(k.RegistryReplacement, image)
+	if !registryUpdate && k.NormalizeShortImageNames {
+		updatedImage, registryUpdate = updateImageRegistry(k.RegistryReplacement, normalizeImageName(image))
+	}
+	if !registryUpdate {
+		// Only the suffix is replaced, the name stays as written.
+		updatedImage = image
+	}
+	updatedImage, archUpdate := updateImageArchSuffix(k.ImageArchSuffixMapping, updatedImage)
+	return updatedImage, registryUpdate || archUpdate
+}
+
+// updateImageArchSuffix replaces the suffix of the image's tag according to
+// suffixMapping. When several suffixes match, the longest one is replaced.
+func updateImageArchSuffix(suffixMapping map[string]string, image string) (string, bool) {
+	if len(suffixMapping) == 0 || strings.Contains(image, "@") {
+		return image, false
+	}
+	// The tag follows the last ":" after the last "/", a ":" before it
+	// separates the registry host from its port.
+	i := strings.LastIndex(image, ":")
+	if i < 0 || i < strings.LastIndex(image, "/") {
+		return image, false
+	}
+	name, tag := image[:i], image[i+1:]
+	match := ""
+	for suffix := range suffixMapping {
+		if strings.HasSuffix(tag, suffix) && len(suffix) > len(match) {
+			match = suffix
+		}
+	}
+	if match == "" {
+		return image, false
+	}
+	return name + ":" + strings.TrimSuffix(tag, match) + suffixMapping[match], true
+}
+
+// normalizeImageName expands image references without a registry to the
+// docker.io registry, adding the library repository for official images.
+func normalizeImageName(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && isRegistryHost(parts[0]) {
+		return image
+	}
+	if len(parts) == 1 {
+		return "docker.io/library/" + image
+	}
+	return "docker.io/" + image
+}
+
+func updateImageRegistry(registryReplacements map[string]string, oldImageName string) (string, bool) {
+	// Split off the digest of images pinned by digest, it is re-appended to the updated image.
+	imageName, digest := oldImageName, ""
+	if i := strings.Index(oldImageName, "@"); i >= 0 {
+		imageName, digest = oldImageName[:i], oldImageName[i:]
+	}
+	// Break up the image to get the registry URL. Assume all manifests are using
+	// fully qualified image paths, if not ignore. The first component is
+	// matched against the keys as is, so a key like "myregistry" applies even
+	// though docker would take it for a Docker Hub repository.
+	imageParts := strings.Split(imageName, "/")
+	if len(imageParts) < 2 {
+		return "", false
+	}
+	if newRegistry, ok := registryReplacements[imageParts[0]]; ok {
+		return strings.Join(append([]string{newRegistry}, imageParts[1:]...), "/") + digest, true
+	}
+
+	return "", false
+}
+
+// isRegistryHost reports whether the first component of an image name is a
+// registry rather than a Docker Hub repository, i.e. whether the image is not
+// a short name to normalize. Like docker, it is only considered a registry
+// when it contains a "." or ":" or is localhost.
+func isRegistryHost(part string) bool {
+	return strings.ContainsAny(part, ".:") || part == "localhost"
+}
+
+// addAnnotations adds the annotations the object does not already have with
+// the same value, so transforming an already transformed object is a no-op.
+func addAnnotations(annotations, addedAnnotations map[string]string) (jsonpatch.Patch, error) {
+	// Emit the annotations sorted by key so the patch is stable between runs.
+	keys := make([]string, 0, len(addedAnnotations))
+	for key, value := range addedAnnotations {
+		if current, ok := annotations[key]; ok && current == value {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ops := []map[string]interface{}{}
+	for _, key := range keys {
+		ops = append(ops, map[string]interface{}{
+			"op":    "add",
+			"path":  annotationPath(key),
+			"value": addedAnnotations[key],
+		})
+	}
+	return decodeOperations(ops)
+}
+
+// mergeAnnotations sets the annotations of the object to its existing
+// annotations merged with the added ones, less the removed ones, in a single
+// operation, so neither depends on the annotations map existing or on the
+// order of the operations. Nothing is emitted when the annotations are
+// unchanged.
+func (k KubernetesTransformPlugin) mergeAnnotations(obj unstructured.Unstructured, addedAnnotations map[string]string, removedAnnotations []string) (jsonpatch.Patch, error) {
+	_, exists, _ := unstructured.NestedFieldNoCopy(obj.Object, "metadata", "annotations")
+	existing := obj.GetAnnotations()
+	annotations := map[string]string{}
+	for key, value := range existing {
+		annotations[key] = value
+	}
+	for key, value := range addedAnnotations {
+		annotations[key] = value
+	}
+	for _, key := range removedAnnotations {
+		delete(annotations, key)
+	}
+
+	changed := len(annotations) != len(existing)
+	for key, value := range annotations {
+		if current, ok := existing[key]; !ok || current != value {
+			changed = true
+		}
+	}
+	switch {
+	case !changed:
+		return nil, nil
+	case len(annotations) == 0 && k.PruneEmptyAnnotations:
+		return removePath("/metadata/annotations")
+	}
+	op := "add"
+	if exists {
+		op = "replace"
+	}
+	return decodeOperations([]map[string]interface{}{{
+		"op":    op,
+		"path":  "/metadata/annotations",
+		"value": annotations,
+	}})
+}
+
+// kubectlAnnotations are the annotations StripKubectlAnnotations removes.
+var kubectlAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	// Recorded by the deprecated --record flag.
+	"kubernetes.io/change-cause",
+}
+
+// annotationsToRemove returns the RemoveAnnotation keys and, with
+// StripKubectlAnnotations, the kubectlAnnotations, followed by the object's
+// annotations matching RemoveAnnotationsByPrefix, without duplicates.
+func (k KubernetesTransformPlugin) annotationsToRemove(obj unstructured.Unstructured) []string {
+	removed := []string{}
+	seen := map[string]bool{}
+	configured := k.RemoveAnnotation
+	if k.StripKubectlAnnotations {
+		configured = append(append([]string{}, configured...), kubectlAnnotations...)
+	}
+	for _, key := range configured {
+		if !seen[key] {
+			seen[key] = true
+			removed = append(removed, key)
+		}
+	}
+	if len(k.RemoveAnnotationsByPrefix) == 0 {
+		return removed
+	}
+
+	keep := map[string]bool{}
+	for _, key := range k.KeepAnnotations {
+		keep[key] = true
+	}
+	matched := []string{}
+	for key := range obj.GetAnnotations() {
+		if seen[key] || keep[key] {
+			continue
+		}
+		for _, prefix := range k.RemoveAnnotationsByPrefix {
+			if strings.HasPrefix(key, prefix) {
+				matched = append(matched, key)
+				break
+			}
+		}
+	}
+	sort.Strings(matched)
+	return append(removed, matched...)
+}
+
+// removeAnnotations removes the given annotations that are present on the object.
+func removeAnnotations(annotations map[string]string, removedAnnotations []string) (jsonpatch.Patch, error) {
+	ops := []map[string]interface{}{}
+	for _, key := range removedAnnotations {
+		if _, ok := annotations[key]; !ok {
+			continue
+		}
+		ops = append(ops, map[string]interface{}{
+			"op":   "remove",
+			"path": annotationPath(key),
+		})
+	}
+	return decodeOperations(ops)
+}
+
+// expandAnnotations replaces the placeholders in the annotation values with
+// the fields of the object.
+func expandAnnotations(obj unstructured.Unstructured, annotations map[string]string) map[string]string {
+	placeholders := strings.NewReplacer(
+		"%NAMESPACE%", obj.GetNamespace(),
+		"%NAME%", obj.GetName(),
+		"%KIND%", obj.GetKind(),
+	)
+	expanded := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		expanded[key] = placeholders.Replace(value)
+	}
+	return expanded
+}
+
+func annotationPath(key string) string {
+	return "/metadata/annotations/" + jsonPointerEscaper.Replace(key)
+}
+
+// decodeOperations marshals the operations and decodes them into a patch, so
+// values are always properly escaped.
+func decodeOperations(ops []map[string]interface{}) (jsonpatch.Patch, error) {
+	patchJSON, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.DecodePatch(patchJSON)
+}
+
+// replaceContainerImages rewrites the containers' images. The
+// patch paths are built from pathFormat and the index of each container in
+// the given slice, so it must be the unmodified list from the object.
+func (k KubernetesTransformPlugin) replaceContainerImages(jsonPatch *patchBuilder, containers []v1.Container, pathFormat string) error {
+	for i, container := range containers {
+		if k.RequireRegistryMatch && !k.DisableImageReplacement && !k.matchesRegistry(container.Image) {
+			jsonPatch.unmatchedImages = appendUnique(jsonPatch.unmatchedImages, container.Image)
+		}
+		updatedImage, update := k.replaceImage(container.Image)
+		if !update {
+			continue
+		}
+		jp, err := k.replace(fmt.Sprintf(pathFormat, i), container.Image, updatedImage)
+		if err != nil {
+			return err
+		}
+		jsonPatch.add(jp, fmt.Sprintf("rewrote image %v→%v", container.Image, updatedImage))
+	}
+	return nil
+}
+
+// matchesRegistry reports whether the registry of the image is a key or a
+// value of RegistryReplacement.
+func (k KubernetesTransformPlugin) matchesRegistry(image string) bool {
+	if _, ok := updateImageRegistry(k.RegistryReplacement, image); ok {
+		return true
+	}
+	if k.NormalizeShortImageNames {
+		image = normalizeImageName(image)
+		if _, ok := updateImageRegistry(k.RegistryReplacement, image); ok {
+			return true
+		}
+	}
+	for _, replacement := range k.RegistryReplacement {
+		if strings.HasPrefix(image, replacement+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// replaceAnnotationImages rewrites the images referenced by
+// the ImageAnnotations, pathPrefix is the path of the annotations map.
+func (k KubernetesTransformPlugin) replaceAnnotationImages(jsonPatch *patchBuilder, annotations map[string]string, pathPrefix string) error {
+	for _, key := range k.ImageAnnotations {
+		image, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		updatedImage, update := k.replaceImage(image)
+		if !update {
+			continue
+		}
+		jp, err := k.replace(pathPrefix+jsonPointerEscaper.Replace(key), image, updatedImage)
+		if err != nil {
+			return err
+		}
+		jsonPatch.add(jp, fmt.Sprintf("rewrote image %v→%v in annotation %v", image, updatedImage, key))
+	}
+	return nil
+}
+
+// replaceRegisteredImages rewrites the images found at the paths registered
+// for the kind of the object with types.RegisterImagePath.
+func (k KubernetesTransformPlugin) replaceRegisteredImages(jsonPatch *patchBuilder, obj unstructured.Unstructured) error {
+	replace := func(value interface{}, path string) error {
+		image, ok := value.(string)
+		if !ok {
+			return nil
+		}
+		updatedImage, update := k.replaceImage(image)
+		if !update {
+			return nil
+		}
+		jp, err := k.replace(path, image, updatedImage)
+		if err != nil {
+			return err
+		}
+		jsonPatch.add(jp, fmt.Sprintf("rewrote image %v→%v", image, updatedImage))
+		return nil
+	}
+
+	for _, path := range types.ImagePaths(obj.GroupVersionKind().GroupKind()) {
+		value, ok := types.NestedPointer(obj.Object, path)
+		if !ok {
+			continue
+		}
+		images, ok := value.([]interface{})
+		if !ok {
+			if err := replace(value, path); err != nil {
+				return err
+			}
+			continue
+		}
+		for i, image := range images {
+			if err := replace(image, fmt.Sprintf("%v/%v", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeDeprecatedServiceAccount removes spec.serviceAccount only when it
+// matches spec.serviceAccountName, a pod that only sets the deprecated field
+// is left untouched so the service account is not lost.
+func removeDeprecatedServiceAccount(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	serviceAccount, ok, _ := unstructured.NestedString(obj.Object, "spec", "serviceAccount")
+	if !ok {
+		return nil, nil
+	}
+	serviceAccountName, _, _ := unstructured.NestedString(obj.Object, "spec", "serviceAccountName")
+	if serviceAccount != serviceAccountName {
+		return nil, nil
+	}
+	return removePath("/spec/serviceAccount")
+}
+
+// updateStorageClasses rewrites the storage classes according to
+// StorageClassMapping.
+func (k KubernetesTransformPlugin) updateStorageClasses(obj unstructured.Unstructured) (jsonpatch.Patch, []string, error) {
+	jsonPatch := &patchBuilder{}
+	update := func(spec map[string]interface{}, path string) error {
+		storageClass, ok, _ := unstructured.NestedString(spec, "storageClassName")
+		if !ok {
+			return nil
+		}
+		target, ok := k.StorageClassMapping[storageClass]
+		if !ok || target == storageClass {
+			return nil
+		}
+		if target == "" {
+			patch, err := removePath(path)
+			if err != nil {
+				return err
+			}
+			jsonPatch.add(patch, fmt.Sprintf("removed storage class %v to use the default storage class", storageClass))
+			return nil
+		}
+		patch, err := k.replace(path, storageClass, target)
+		if err != nil {
+			return err
+		}
+		jsonPatch.add(patch, fmt.Sprintf("rewrote storage class %v→%v", storageClass, target))
+		return nil
+	}
+
+	switch obj.GetObjectKind().GroupVersionKind().GroupKind() {
+	case pvcGK, pvGK:
+		spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+		if err := update(spec, "/spec/storageClassName"); err != nil {
+			return nil, nil, err
+		}
+	case statefulSetGK:
+		templates, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+		for i, t := range templates {
+			template, ok := t.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			spec, _, _ := unstructured.NestedMap(template, "spec")
+			if err := update(spec, fmt.Sprintf("/spec/volumeClaimTemplates/%v/spec/storageClassName", i)); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return jsonPatch.patch, jsonPatch.reasons, nil
+}
+
+// updateIngressClass rewrites the ingress class of an Ingress according to
+// IngressClassMapping.
+func (k KubernetesTransformPlugin) updateIngressClass(obj unstructured.Unstructured) (jsonpatch.Patch, []string, error) {
+	jsonPatch := &patchBuilder{}
+	if ingressClass, ok, _ := unstructured.NestedString(obj.Object, "spec", "ingressClassName"); ok {
+		if replacement, ok := k.IngressClassMapping[ingressClass]; ok && replacement != ingressClass {
+			patch, err := k.replace("/spec/ingressClassName", ingressClass, replacement)
+			if err != nil {
+				return nil, nil, err
+			}
+			jsonPatch.add(patch, fmt.Sprintf("rewrote ingress class %v→%v", ingressClass, replacement))
+		}
+	}
+	if ingressClass, ok := obj.GetAnnotations()[ingressClassAnnotation]; ok {
+		if replacement, ok := k.IngressClassMapping[ingressClass]; ok && replacement != ingressClass {
+			patch, err := k.replace(annotationPath(ingressClassAnnotation), ingressClass, replacement)
+			if err != nil {
+				return nil, nil, err
+			}
+			jsonPatch.add(patch, fmt.Sprintf("rewrote ingress class annotation %v→%v", ingressClass, replacement))
+		}
+	}
+	return jsonPatch.patch, jsonPatch.reasons, nil
+}
+
+// updateHostDomains rewrites the hosts of an Ingress or Route according to
+// HostDomainMapping.
+func (k KubernetesTransformPlugin) updateHostDomains(obj unstructured.Unstructured) (jsonpatch.Patch, []string, error) {
+	jsonPatch := &patchBuilder{}
+	update := func(host interface{}, path string) error {
+		h, ok := host.(string)
+		if !ok {
+			return nil
+		}
+		replacement, ok := k.replaceHostDomain(h)
+		if !ok {
+			return nil
+		}
+		patch, err := k.replace(path, h, replacement)
+		if err != nil {
+			return err
+		}
+		jsonPatch.add(patch, fmt.Sprintf("rewrote host %v→%v", h, replacement))
+		return nil
+	}
+
+	if obj.GetObjectKind().GroupVersionKind().GroupKind() == routeGK {
+		host, _, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "host")
+		if err := update(host, "/spec/host"); err != nil {
+			return nil, nil, err
+		}
+		return jsonPatch.patch, jsonPatch.reasons, nil
+	}
+	rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+	for i, r := range rules {
+		rule, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := update(rule["host"], fmt.Sprintf("/spec/rules/%v/host", i)); err != nil {
+			return nil, nil, err
+		}
+	}
+	tls, _, _ := unstructured.NestedSlice(obj.Object, "spec", "tls")
+	for i, t := range tls {
+		entry, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		hosts, _, _ := unstructured.NestedSlice(entry, "hosts")
+		for j, host := range hosts {
+			if err := update(host, fmt.Sprintf("/spec/tls/%v/hosts/%v", i, j)); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return jsonPatch.patch, jsonPatch.reasons, nil
+}
+
+// replaceHostDomain returns the host moved to the replacement of the longest
+// HostDomainMapping domain it is in, if any. A leading "*." of the domains is
+// ignored so wildcard domains can be given as is.
+func (k KubernetesTransformPlugin) replaceHostDomain(host string) (string, bool) {
+	matched, replacement := "", ""
+	for domain, r := range k.HostDomainMapping {
+		domain = strings.TrimPrefix(domain, "*.")
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			continue
+		}
+		if len(domain) > len(matched) {
+			matched, replacement = domain, strings.TrimPrefix(r, "*.")
+		}
+	}
+	if matched == "" || matched == replacement {
+		return "", false
+	}
+	return strings.TrimSuffix(host, matched) + replacement, true
+}
+
+// podSpec returns the pod spec of Pods and pod specable objects along with
+// its path, or nil for other objects.
+func podSpec(obj unstructured.Unstructured) (map[string]interface{}, string) {
+	if podGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
+		spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+		return spec, "/spec"
+	}
+	if _, ok := types.IsPodSpecable(obj); ok {
+		template, templatePath, _ := types.NestedPodTemplate(obj)
+		spec, _, _ := unstructured.NestedMap(template, "spec")
+		return spec, templatePath + "/spec"
+	}
+	return nil, ""
+}
+
+// removeContainerEnv removes the env entries with one of the names from the
+// containers and init containers of the pod spec. The entries of each env
+// array are removed from the last to the first, so the index of the entries
+// still to be removed is not shifted by the previous operations.
+func removeContainerEnv(spec map[string]interface{}, specPath string, names []string) (jsonpatch.Patch, error) {
+	removed := map[string]bool{}
+	for _, name := range names {
+		removed[name] = true
+	}
+	jsonPatch := jsonpatch.Patch{}
+	for _, field := range []string{"containers", "initContainers"} {
+		containers, _, _ := unstructured.NestedSlice(spec, field)
+		for i, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			env, _, _ := unstructured.NestedSlice(container, "env")
+			for j := len(env) - 1; j >= 0; j-- {
+				envVar, ok := env[j].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if name, _ := envVar["name"].(string); !removed[name] {
+					continue
+				}
+				patch, err := removePath(fmt.Sprintf("%v/%v/%v/env/%v", specPath, field, i, j))
+				if err != nil {
+					return nil, err
+				}
+				jsonPatch = append(jsonPatch, patch...)
+			}
+		}
+	}
+	return jsonPatch, nil
+}
+
+// isServiceAccountTokenVolume reports whether the volume name is the one
+// given to the service account token volumes injected by Kubernetes.
+func isServiceAccountTokenVolume(name string) bool {
+	return strings.HasPrefix(name, "kube-api-access-") || strings.HasPrefix(name, "default-token-")
+}
+
+// removeServiceAccountTokenVolumes removes the service account token volumes
+// of the pod spec and their volumeMounts in the containers and init
+// containers. Like in removeContainerEnv the entries are removed from the
+// last to the first.
+func removeServiceAccountTokenVolumes(spec map[string]interface{}, specPath string) (jsonpatch.Patch, error) {
+	jsonPatch := jsonpatch.Patch{}
+	for _, field := range []string{"containers", "initContainers"} {
+		containers, _, _ := unstructured.NestedSlice(spec, field)
+		for i, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			mounts, _, _ := unstructured.NestedSlice(container, "volumeMounts")
+			for j := len(mounts) - 1; j >= 0; j-- {
+				mount, ok := mounts[j].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if name, _ := mount["name"].(string); !isServiceAccountTokenVolume(name) {
+					continue
+				}
+				patch, err := removePath(fmt.Sprintf("%v/%v/%v/volumeMounts/%v", specPath, field, i, j))
+				if err != nil {
+					return nil, err
+				}
+				jsonPatch = append(jsonPatch, patch...)
+			}
+		}
+	}
+	volumes, _, _ := unstructured.NestedSlice(spec, "volumes")
+	for i := len(volumes) - 1; i >= 0; i-- {
+		volume, ok := volumes[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, _ := volume["name"].(string); !isServiceAccountTokenVolume(name) {
+			continue
+		}
+		patch, err := removePath(fmt.Sprintf("%v/volumes/%v", specPath, i))
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	return jsonPatch, nil
+}
+
+// setImagePullPolicy sets the imagePullPolicy of the containers and init
+// containers of the pod spec to SetImagePullPolicy, where it differs.
+func (k KubernetesTransformPlugin) setImagePullPolicy(spec map[string]interface{}, specPath string) (jsonpatch.Patch, error) {
+	jsonPatch := jsonpatch.Patch{}
+	for _, field := range []string{"containers", "initContainers"} {
+		containers, _, _ := unstructured.NestedSlice(spec, field)
+		for i, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			path := fmt.Sprintf("%v/%v/%v/imagePullPolicy", specPath, field, i)
+			policy, ok := container["imagePullPolicy"]
+			if ok && policy == k.SetImagePullPolicy {
+				continue
+			}
+			var patch jsonpatch.Patch
+			var err error
+			if ok {
+				patch, err = k.replace(path, policy, k.SetImagePullPolicy)
+			} else {
+				patch, err = decodeOperations([]map[string]interface{}{{"op": "add", "path": path, "value": k.SetImagePullPolicy}})
+			}
+			if err != nil {
+				return nil, err
+			}
+			jsonPatch = append(jsonPatch, patch...)
+		}
+	}
+	return jsonPatch, nil
+}
+
+// validateResourceQuantities checks that the quantities of the override
+// parse.
+func validateResourceQuantities(override ContainerResourceOverride) error {
+	for field, quantities := range map[string]map[string]string{"requests": override.Requests, "limits": override.Limits} {
+		for name, quantity := range quantities {
+			if name == "" {
+				return fmt.Errorf("invalid ResourceOverride for container %q: resource names must not be empty", override.Container)
+			}
+			if _, err := resource.ParseQuantity(quantity); err != nil {
+				return fmt.Errorf("invalid ResourceOverride for container %q: %v %v quantity %q: %v", override.Container, field, name, quantity, err)
+			}
+		}
+	}
+	return nil
+}
+
+// overrideResources sets the requests and limits of the containers and init
+// containers of the pod spec according to ResourceOverride, where they
+// differ.
+func (k KubernetesTransformPlugin) overrideResources(spec map[string]interface{}, specPath string) (jsonpatch.Patch, error) {
+	for _, override := range k.ResourceOverride {
+		if err := validateResourceQuantities(override); err != nil {
+			return nil, err
+		}
+	}
+	jsonPatch := jsonpatch.Patch{}
+	for _, field := range []string{"containers", "initContainers"} {
+		containers, _, _ := unstructured.NestedSlice(spec, field)
+		for i, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := container["name"].(string)
+			resources, hasResources, _ := unstructured.NestedMap(container, "resources")
+			resourcesPath := fmt.Sprintf("%v/%v/%v/resources", specPath, field, i)
+			for _, kind := range []string{"requests", "limits"} {
+				desired := k.resourceOverrides(name, kind)
+				if len(desired) == 0 {
+					continue
+				}
+				current, ok, _ := unstructured.NestedMap(resources, kind)
+				if !ok {
+					// Add the whole map, creating resources first if needed.
+					path, value := resourcesPath+"/"+kind, interface{}(desired)
+					if !hasResources {
+						path, value = resourcesPath, map[string]interface{}{kind: desired}
+						hasResources = true
+						resources = map[string]interface{}{}
+					}
+					patch, err := decodeOperations([]map[string]interface{}{{"op": "add", "path": path, "value": value}})
+					if err != nil {
+						return nil, err
+					}
+					jsonPatch = append(jsonPatch, patch...)
+					continue
+				}
+				names := make([]string, 0, len(desired))
+				for name := range desired {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					path := resourcesPath + "/" + kind + "/" + jsonPointerEscaper.Replace(name)
+					value, exists := current[name]
+					if exists && value == desired[name] {
+						continue
+					}
+					var patch jsonpatch.Patch
+					var err error
+					if exists {
+						patch, err = k.replace(path, value, desired[name])
+					} else {
+						patch, err = decodeOperations([]map[string]interface{}{{"op": "add", "path": path, "value": desired[name]}})
+					}
+					if err != nil {
+						return nil, err
+					}
+					jsonPatch = append(jsonPatch, patch...)
+				}
+			}
+		}
+	}
+	return jsonPatch, nil
+}
+
+// resourceOverrides returns the requests or limits ResourceOverride sets for
+// the named container, the "*" overrides overlaid with the ones naming it.
+func (k KubernetesTransformPlugin) resourceOverrides(container, kind string) map[string]interface{} {
+	overrides := map[string]interface{}{}
+	for _, wildcard := range []bool{true, false} {
+		for _, override := range k.ResourceOverride {
+			if (override.Container == "*") != wildcard || (!wildcard && override.Container != container) {
+				continue
+			}
+			quantities := override.Requests
+			if kind == "limits" {
+				quantities = override.Limits
+			}
+			for name, quantity := range quantities {
+				overrides[name] = quantity
+			}
+		}
+	}
+	return overrides
+}
+
+// removeHostNetworking removes the host namespaces and host ports of the pod
+// spec found at specPath.
+func removeHostNetworking(spec map[string]interface{}, specPath string) (jsonpatch.Patch, error) {
+	jsonPatch := jsonpatch.Patch{}
+	for _, field := range []string{"hostNetwork", "hostPID", "hostIPC"} {
+		if _, ok := spec[field]; !ok {
+			continue
+		}
+		patch, err := removePath(specPath + "/" + field)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	for _, field := range []string{"containers", "initContainers"} {
+		containers, _, _ := unstructured.NestedSlice(spec, field)
+		for i, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			ports, _, _ := unstructured.NestedSlice(container, "ports")
+			for j, p := range ports {
+				port, ok := p.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if _, ok := port["hostPort"]; !ok {
+					continue
+				}
+				patch, err := removePath(fmt.Sprintf("%v/%v/%v/ports/%v/hostPort", specPath, field, i, j))
+				if err != nil {
+					return nil, err
+				}
+				jsonPatch = append(jsonPatch, patch...)
+			}
+		}
+	}
+	return jsonPatch, nil
+}
+
+// removeStatefulSetStatus removes the status of a StatefulSet and of its
+// volumeClaimTemplates.
+func removeStatefulSetStatus(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	jsonPatch := jsonpatch.Patch{}
+	templates, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+	for i, t := range templates {
+		template, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := template["status"]; !ok {
+			continue
+		}
+		patch, err := removePath(fmt.Sprintf("/spec/volumeClaimTemplates/%v/status", i))
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "status"); ok {
+		patch, err := removePath("/status")
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	return jsonPatch, nil
+}
+
+// deploymentDefaults are the defaults of apps/v1 Deployment spec fields that
+// NormalizeDeploymentDefaults removes.
+var deploymentDefaults = map[string]int64{
+	"revisionHistoryLimit":    10,
+	"progressDeadlineSeconds": 600,
+}
+
+// removeDeploymentDefaults removes the deploymentDefaults fields present on
+// the Deployment with their default value.
+func removeDeploymentDefaults(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	fields := make([]string, 0, len(deploymentDefaults))
+	for field := range deploymentDefaults {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	jsonPatch := jsonpatch.Patch{}
+	for _, field := range fields {
+		value, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", field)
+		if !ok || !isInteger(value, deploymentDefaults[field]) {
+			continue
+		}
+		patch, err := removePath("/spec/" + field)
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	return jsonPatch, nil
+}
+
+// isInteger reports whether the unstructured value is the integer n.
+func isInteger(value interface{}, n int64) bool {
+	switch v := value.(type) {
+	case int64:
+		return v == n
+	case int:
+		return int64(v) == n
+	case float64:
+		return v == float64(n)
+	}
+	return false
+}
+
+// pvcBindingAnnotations are set by the persistent volume controller once a
+// claim is bound.
+var pvcBindingAnnotations = []string{
+	"pv.kubernetes.io/bind-completed",
+	"pv.kubernetes.io/bound-by-controller",
+}
+
+// pvcBindingAnnotationsToRemove returns the pvcBindingAnnotations that are
+// removed from claims transformed inline, less the ones already among the
+// removed annotations, so that each annotation is removed once.
+func (k KubernetesTransformPlugin) pvcBindingAnnotationsToRemove(obj unstructured.Unstructured, removedAnnotations []string) []string {
+	if obj.GetObjectKind().GroupVersionKind().GroupKind() != pvcGK || !k.TransformPVCsInline {
+		return nil
+	}
+	removed := map[string]bool{}
+	for _, key := range removedAnnotations {
+		removed[key] = true
+	}
+	bindingAnnotations := []string{}
+	for _, key := range pvcBindingAnnotations {
+		if !removed[key] {
+			bindingAnnotations = append(bindingAnnotations, key)
+		}
+	}
+	return bindingAnnotations
+}
+
+// removePVCBinding removes the volume a PersistentVolumeClaim is bound to and
+// the status. The annotations recording the binding are removed along with
+// the configured annotations, see pvcBindingAnnotationsToRemove.
+func removePVCBinding(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	jsonPatch := jsonpatch.Patch{}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "volumeName"); ok {
+		patch, err := removePath("/spec/volumeName")
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "status"); ok {
+		patch, err := removePath("/status")
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	return jsonPatch, nil
+}
+
+// updatePVCDataSource renames the objects referenced by the dataSource and
+// dataSourceRef of a PersistentVolumeClaim according to
+// PVCDataSourceMapping, and removes the references it does not map.
+func (k KubernetesTransformPlugin) updatePVCDataSource(obj unstructured.Unstructured) (jsonpatch.Patch, []string, error) {
+	jsonPatch := &patchBuilder{}
+	for _, field := range []string{"dataSource", "dataSourceRef"} {
+		dataSource, ok, _ := unstructured.NestedMap(obj.Object, "spec", field)
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(dataSource, "name")
+		kind, _, _ := unstructured.NestedString(dataSource, "kind")
+		target, ok := k.PVCDataSourceMapping[name]
+		if !ok {
+			patch, err := removePath("/spec/" + field)
+			if err != nil {
+				return nil, nil, err
+			}
+			jsonPatch.add(patch, fmt.Sprintf("removed %v referencing %v %v of the source cluster", field, kind, name))
+			continue
+		}
+		if target == name {
+			continue
+		}
+		patch, err := k.replace(fmt.Sprintf("/spec/%v/name", field), name, target)
+		if err != nil {
+			return nil, nil, err
+		}
+		jsonPatch.add(patch, fmt.Sprintf("rewrote %v %v %v→%v", field, kind, name, target))
+	}
+	return jsonPatch.patch, jsonPatch.reasons, nil
+}
+
+// removePodRuntimeFields removes the status of a Pod and its spec.overhead,
+// which the RuntimeClass admission controller rejects when set on creation.
+func removePodRuntimeFields(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	jsonPatch := jsonpatch.Patch{}
+	for _, fields := range [][]string{{"spec", "overhead"}, {"status"}} {
+		if _, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, fields...); !ok {
+			continue
+		}
+		patch, err := removePath("/" + strings.Join(fields, "/"))
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	return jsonPatch, nil
+}
+
+func removePodSelectedNode() (jsonpatch.Patch, error) {
+	patch, err := jsonpatch.DecodePatch([]byte(podSelectedNode))
+	if err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+func updateNamespace(newNamespace string) (jsonpatch.Patch, error) {
+	patchJSON := fmt.Sprintf(updateNamespaceString, newNamespace)
+
+	patch, err := jsonpatch.DecodePatch([]byte(patchJSON))
+	if err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+func updateRoleBindingSVCACCTNamespace(newNamespace string, numberOfSubjects int) (jsonpatch.Patch, error) {
+	patchJSON := "["
+	for i := 0; i < numberOfSubjects; i++ {
+		if i != 0 {
+			patchJSON = fmt.Sprintf("%v,", patchJSON)
+		}
+		patchJSON = fmt.Sprintf(updateRoleBindingSVCACCTNamspacestring, patchJSON, i, newNamespace)
+	}
+
+	patch, err := jsonpatch.DecodePatch([]byte(patchJSON))
+	if err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+// removeNodePorts removes the nodePorts of the Service's ports that are
+// outside of NodePortRange, or all of them when no range is set.
+func (k KubernetesTransformPlugin) removeNodePorts(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	var portRange *utilnet.PortRange
+	if k.NodePortRange != "" {
+		var err error
+		portRange, err = utilnet.ParsePortRange(k.NodePortRange)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ports, _, _ := unstructured.NestedSlice(obj.Object, "spec", "ports")
+	jsonPatch := jsonpatch.Patch{}
+	for i, p := range ports {
+		port, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		nodePort, ok, _ := unstructured.NestedInt64(port, "nodePort")
+		if !ok {
+			continue
+		}
+		if portRange != nil && portRange.Contains(int(nodePort)) {
+			continue
+		}
+		patch, err := removePath(fmt.Sprintf("/spec/ports/%v/nodePort", i))
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	return jsonPatch, nil
+}
+
+// removeLoadBalancerFields removes the ingress status and the pinned
+// loadBalancerIP of LoadBalancer services, as the addresses are only valid on
+// the source cluster.
+func removeLoadBalancerFields(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+	if serviceType != "LoadBalancer" {
+		return nil, nil
+	}
+	jsonPatch := jsonpatch.Patch{}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "loadBalancerIP"); ok {
+		patch, err := removePath("/spec/loadBalancerIP")
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "status", "loadBalancer"); ok {
+		patch, err := removePath("/status/loadBalancer")
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	return jsonPatch, nil
+}
+
+// removeServiceClusterIPs removes the clusterIP and clusterIPs allocated on
+// the source cluster. Both are removed together, a Service keeping clusterIPs
+// without clusterIP is invalid. ExternalName services have no cluster IP
+// semantics and are left untouched, and absent fields are skipped since
+// removing an absent key fails the patch. Headless services keep their "None"
+// cluster IPs, removing them would turn them into regular services.
+func removeServiceClusterIPs(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+	if serviceType == "ExternalName" {
+		return nil, nil
+	}
+	clusterIP, hasClusterIP, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "clusterIP")
+	if clusterIP == "None" {
+		return nil, nil
+	}
+	clusterIPs, hasClusterIPs, _ := unstructured.NestedStringSlice(obj.Object, "spec", "clusterIPs")
+	if len(clusterIPs) > 0 && clusterIPs[0] == "None" {
+		return nil, nil
+	}
+
+	jsonPatch := jsonpatch.Patch{}
+	if hasClusterIP {
+		patch, err := jsonpatch.DecodePatch([]byte(updateClusterIP))
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	if hasClusterIPs {
+		patch, err := removePath("/spec/clusterIPs")
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patch...)
+	}
+	return jsonPatch, nil
+}
+
+func removeFinalizers(finalizers, removedFinalizers []string) (jsonpatch.Patch, error) {
+	if len(removedFinalizers) == 0 {
+		return jsonpatch.DecodePatch([]byte(removeFinalizersString))
+	}
+
+	remove := map[string]bool{}
+	for _, f := range removedFinalizers {
+		remove[f] = true
+	}
+	kept := []string{}
+	for _, f := range finalizers {
+		if !remove[f] {
+			kept = append(kept, f)
+		}
+	}
+	if len(kept) == len(finalizers) {
+		return jsonpatch.Patch{}, nil
+	}
+	if len(kept) == 0 {
+		return jsonpatch.DecodePatch([]byte(removeFinalizersString))
+	}
+
+	value, err := json.Marshal(kept)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.DecodePatch([]byte(fmt.Sprintf(updateFinalizersString, value)))
+	if err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+func removePath(path string) (jsonpatch.Patch, error) {
+	patch, err := jsonpatch.DecodePatch([]byte(fmt.Sprintf(removePathString, path)))
+	if err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+// replace replaces the value at path, which was original when the patch was
+// computed. With SafeReplace the replacement is preceded by a test operation
+// asserting the original value.
+func (k KubernetesTransformPlugin) replace(path string, original, value interface{}) (jsonpatch.Patch, error) {
+	patch, err := replacePath(path, value)
+	if err != nil || !k.SafeReplace {
+		return patch, err
+	}
+	test, err := testPath(path, original)
+	if err != nil {
+		return nil, err
+	}
+	return append(test, patch...), nil
+}
+
+func replacePath(path string, value interface{}) (jsonpatch.Patch, error) {
+	v, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.DecodePatch([]byte(fmt.Sprintf(replacePathString, path, v)))
+	if err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+func testPath(path string, value interface{}) (jsonpatch.Patch, error) {
+	v, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.DecodePatch([]byte(fmt.Sprintf(testPathString, path, v)))
 	if err != nil {
 		return nil, err
 	}
@@ -1,15 +1,23 @@
 package kubernetes_test
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	transform "github.com/konveyor/crane-lib/transform"
 	internaljsonpatch "github.com/konveyor/crane-lib/transform/internal/jsonpatch"
 	"github.com/konveyor/crane-lib/transform/kubernetes"
+	"github.com/konveyor/crane-lib/transform/types"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func TestRun(t *testing.T) {
@@ -179,6 +187,9 @@ func TestRun(t *testing.T) {
 				Object: map[string]interface{}{
 					"kind":       "Service",
 					"apiVersion": "v1",
+					"spec": map[string]interface{}{
+						"clusterIP": "172.30.12.4",
+					},
 				},
 			},
 			Response: transform.PluginResponse{
@@ -222,3 +233,3700 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func checkPatches(t *testing.T, actual jsonpatch.Patch, expected string) {
+	t.Helper()
+	if len(expected) == 0 {
+		if len(actual) != 0 {
+			t.Errorf("Expected no patches. Actual: %#v", actual)
+		}
+		return
+	}
+	expectPatch, err := jsonpatch.DecodePatch([]byte(expected))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := internaljsonpatch.Equal(actual, expectPatch)
+	if !ok || err != nil {
+		t.Errorf("Invalid patches. Actual: %#v, Expected: %#v", actual, expectPatch)
+	}
+}
+
+// applyPatches applies the patches to the object as is and returns the
+// patched object.
+func applyPatches(t *testing.T, obj *unstructured.Unstructured, patches jsonpatch.Patch) map[string]interface{} {
+	t.Helper()
+	doc, err := obj.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err = patches.Apply(doc)
+	if err != nil {
+		t.Fatalf("patches do not apply: %v", err)
+	}
+	u := unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(doc); err != nil {
+		t.Fatal(err)
+	}
+	return u.Object
+}
+
+// runPlugin runs the plugin against a copy of the object, checks that it
+// returns the expected patches and that they apply to the object, and returns
+// the response along with the patched object. Like the Runner, the patches are
+// applied to objects without annotations with an empty annotations map added.
+func runPlugin(t *testing.T, p transform.Plugin, obj *unstructured.Unstructured, expected string) (transform.PluginResponse, map[string]interface{}) {
+	t.Helper()
+	resp, err := p.Run(obj.DeepCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPatches(t, resp.Patches, expected)
+	patchable := obj.DeepCopy()
+	if len(patchable.GetAnnotations()) == 0 {
+		patchable.SetAnnotations(map[string]string{})
+	}
+	return resp, applyPatches(t, patchable, resp.Patches)
+}
+
+// pluginCase is a case of the table driven tests of the plugin options:
+// Plugin is run against Object and must return the PatchResponseJson
+// patches.
+type pluginCase struct {
+	Name              string
+	Plugin            kubernetes.KubernetesTransformPlugin
+	Object            *unstructured.Unstructured
+	PatchResponseJson string
+}
+
+func runPluginCases(t *testing.T, cases []pluginCase) {
+	t.Helper()
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			runPlugin(t, &c.Plugin, c.Object, c.PatchResponseJson)
+		})
+	}
+}
+
+// newObject returns an object of the kind with the given top level fields,
+// such as metadata and spec.
+func newObject(apiVersion, kind string, fields map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       kind,
+			"apiVersion": apiVersion,
+		},
+	}
+	for field, value := range fields {
+		u.Object[field] = value
+	}
+	return u
+}
+
+// annotatedObject returns a named object of the kind with the annotations,
+// which are left out when nil.
+func annotatedObject(apiVersion, kind, name string, annotations map[string]interface{}) *unstructured.Unstructured {
+	metadata := map[string]interface{}{"name": name}
+	if annotations != nil {
+		metadata["annotations"] = annotations
+	}
+	return newObject(apiVersion, kind, map[string]interface{}{"metadata": metadata})
+}
+
+func TestRunRemoveFinalizers(t *testing.T) {
+	object := func(finalizers ...interface{}) *unstructured.Unstructured {
+		metadata := map[string]interface{}{"name": "test"}
+		if len(finalizers) > 0 {
+			metadata["finalizers"] = finalizers
+		}
+		return newObject("v1", "PersistentVolume", map[string]interface{}{
+			"metadata": metadata,
+		})
+	}
+
+	cases := []pluginCase{
+		{
+			Name:              "RemoveAllFinalizers",
+			Plugin:            kubernetes.KubernetesTransformPlugin{RemoveFinalizers: true},
+			Object:            object("kubernetes.io/pv-protection", "example.com/cleanup"),
+			PatchResponseJson: `[{"op": "remove", "path": "/metadata/finalizers"}]`,
+		},
+		{
+			Name:              "RemoveNamedFinalizers",
+			Plugin:            kubernetes.KubernetesTransformPlugin{RemoveFinalizers: true, RemoveFinalizerNames: []string{"example.com/cleanup"}},
+			Object:            object("kubernetes.io/pv-protection", "example.com/cleanup"),
+			PatchResponseJson: `[{"op": "replace", "path": "/metadata/finalizers", "value": ["kubernetes.io/pv-protection"]}]`,
+		},
+		{
+			Name:              "RemoveEveryNamedFinalizer",
+			Plugin:            kubernetes.KubernetesTransformPlugin{RemoveFinalizers: true, RemoveFinalizerNames: []string{"example.com/cleanup"}},
+			Object:            object("example.com/cleanup"),
+			PatchResponseJson: `[{"op": "remove", "path": "/metadata/finalizers"}]`,
+		},
+		{
+			Name:   "NamedFinalizerNotPresent",
+			Plugin: kubernetes.KubernetesTransformPlugin{RemoveFinalizers: true, RemoveFinalizerNames: []string{"example.com/cleanup"}},
+			Object: object("kubernetes.io/pv-protection"),
+		},
+		{
+			Name:   "NoFinalizers",
+			Plugin: kubernetes.KubernetesTransformPlugin{RemoveFinalizers: true},
+			Object: object(),
+		},
+		{
+			Name:   "RemoveFinalizersNotSet",
+			Object: object("kubernetes.io/pv-protection"),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunSecretData(t *testing.T) {
+	secret := func() *unstructured.Unstructured {
+		return newObject("v1", "Secret", map[string]interface{}{
+			"data": map[string]interface{}{
+				"token":      "dG9rZW4=",
+				"ca.crt":     "Y2E=",
+				"tls/key~1":  "a2V5",
+				"keep-me":    "a2VlcA==",
+				"other.conf": "b3RoZXI=",
+			},
+			"stringData": map[string]interface{}{
+				"token": "plain",
+			},
+		})
+	}
+
+	cases := []pluginCase{
+		{
+			Name:              "StripSecretData",
+			Plugin:            kubernetes.KubernetesTransformPlugin{StripSecretData: true},
+			Object:            secret(),
+			PatchResponseJson: `[{"op": "remove", "path": "/data"}, {"op": "remove", "path": "/stringData"}]`,
+		},
+		{
+			Name:   "RemoveSecretKeys",
+			Plugin: kubernetes.KubernetesTransformPlugin{RemoveSecretKeys: []string{"token", "ca.crt", "tls/key~1", "missing"}},
+			Object: secret(),
+			PatchResponseJson: `[{"op": "remove", "path": "/data/token"}, {"op": "remove", "path": "/data/ca.crt"},
+{"op": "remove", "path": "/data/tls~1key~01"}, {"op": "remove", "path": "/stringData/token"}]`,
+		},
+		{
+			Name:   "DefaultUntouched",
+			Object: secret(),
+		},
+		{
+			Name:   "NonSecretUntouched",
+			Plugin: kubernetes.KubernetesTransformPlugin{StripSecretData: true, RemoveSecretKeys: []string{"token"}},
+			Object: newObject("v1", "ConfigMap", map[string]interface{}{
+				"data": map[string]interface{}{
+					"token": "plain",
+				},
+			}),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunDockerConfigRegistries(t *testing.T) {
+	dockerConfig := `{"auths": {"quay.io": {"auth": "dXNlcjpwYXNz"}, "https://docker.io/v1/": {"auth": "b3RoZXI6cGFzcw=="}, "ghcr.io": {"auth": "Z2g6cGFzcw=="}}}`
+	secret := func(secretType string) *unstructured.Unstructured {
+		return newObject("v1", "Secret", map[string]interface{}{
+			"type": secretType,
+			"data": map[string]interface{}{
+				".dockerconfigjson": base64.StdEncoding.EncodeToString([]byte(dockerConfig)),
+			},
+		})
+	}
+	var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+		RegistryReplacement: map[string]string{
+			"quay.io":   "registry.example.com",
+			"docker.io": "mirror.example.com",
+		},
+	}
+
+	obj := secret("kubernetes.io/dockerconfigjson")
+	resp, err := p.Run(obj.DeepCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Patches) != 1 {
+		t.Fatalf("expected a single patch, got %v", resp.Patches)
+	}
+	applyPatches(t, obj, resp.Patches)
+	if path, _ := resp.Patches[0].Path(); path != "/data/.dockerconfigjson" {
+		t.Errorf("unexpected path %v", path)
+	}
+	value, err := resp.Patches[0].ValueInterface()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value.(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := map[string]map[string]interface{}{}
+	if err := json.Unmarshal(decoded, &config); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"registry.example.com":           map[string]interface{}{"auth": "dXNlcjpwYXNz"},
+		"https://mirror.example.com/v1/": map[string]interface{}{"auth": "b3RoZXI6cGFzcw=="},
+		"ghcr.io":                        map[string]interface{}{"auth": "Z2g6cGFzcw=="},
+	}
+	if !reflect.DeepEqual(config["auths"], expected) {
+		t.Errorf("unexpected auths %v, want %v", config["auths"], expected)
+	}
+
+	// Other secret types are left alone.
+	runPlugin(t, p, secret("Opaque"), "")
+}
+
+func TestRunRemoveOwnerReferences(t *testing.T) {
+	replicaSet := newObject("apps/v1", "ReplicaSet", map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": "test",
+			"ownerReferences": []interface{}{
+				map[string]interface{}{
+					"apiVersion": "apps/v1",
+					"kind":       "Deployment",
+					"name":       "test",
+					"uid":        "3a5f4d8e-2b1c-4e5f-9a8b-7c6d5e4f3a2b",
+				},
+			},
+		},
+	})
+
+	cases := []pluginCase{
+		{
+			Name:              "RemoveOwnerReferences",
+			Plugin:            kubernetes.KubernetesTransformPlugin{RemoveOwnerReferences: true},
+			Object:            replicaSet,
+			PatchResponseJson: `[{"op": "remove", "path": "/metadata/ownerReferences"}]`,
+		},
+		{
+			Name:   "NoOwnerReferences",
+			Plugin: kubernetes.KubernetesTransformPlugin{RemoveOwnerReferences: true},
+			Object: &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ReplicaSet", "apiVersion": "apps/v1"}},
+		},
+		{
+			Name:   "RemoveOwnerReferencesNotSet",
+			Object: replicaSet,
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunJob(t *testing.T) {
+	cases := []pluginCase{
+		{
+			Name: "JobWithGeneratedSelector",
+			Object: newObject("batch/v1", "Job", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"selector": map[string]interface{}{
+						"matchLabels": map[string]interface{}{
+							"controller-uid": "8d5a7a8e-6b1f-4c1e-9d3a-2f0b5c7e9a11",
+						},
+					},
+					"template": map[string]interface{}{
+						"metadata": map[string]interface{}{
+							"labels": map[string]interface{}{
+								"controller-uid":                     "8d5a7a8e-6b1f-4c1e-9d3a-2f0b5c7e9a11",
+								"batch.kubernetes.io/controller-uid": "8d5a7a8e-6b1f-4c1e-9d3a-2f0b5c7e9a11",
+								"job-name":                           "test",
+							},
+						},
+					},
+				},
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/selector"},
+{"op": "remove", "path": "/spec/template/metadata/labels/controller-uid"},
+{"op": "remove", "path": "/spec/template/metadata/labels/batch.kubernetes.io~1controller-uid"}]`,
+		},
+		{
+			Name: "JobWithManualSelector",
+			Object: newObject("batch/v1", "Job", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"manualSelector": true,
+					"selector": map[string]interface{}{
+						"matchLabels": map[string]interface{}{
+							"controller-uid": "batch-7",
+						},
+					},
+					"template": map[string]interface{}{
+						"metadata": map[string]interface{}{
+							"labels": map[string]interface{}{
+								"controller-uid": "batch-7",
+							},
+						},
+					},
+				},
+			}),
+		},
+		{
+			Name: "JobWithoutGeneratedFields",
+			Object: newObject("batch/v1", "Job", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"metadata": map[string]interface{}{
+							"labels": map[string]interface{}{
+								"app": "test",
+							},
+						},
+					},
+				},
+			}),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func deploymentWithImages(images ...string) *unstructured.Unstructured {
+	containers := []interface{}{}
+	for _, image := range images {
+		containers = append(containers, map[string]interface{}{"image": image})
+	}
+	return newObject("apps/v1", "Deployment", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": containers,
+				},
+			},
+		},
+	})
+}
+
+func TestRunImageDigest(t *testing.T) {
+	cases := []pluginCase{
+		{
+			Name: "DigestPinnedImage",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{
+					"registry.internal": "registry.example.com",
+				},
+			},
+			Object:            deploymentWithImages("registry.internal/team/app@sha256:0f2e8d3b5c5e4e6f8a9b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f"),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "registry.example.com/team/app@sha256:0f2e8d3b5c5e4e6f8a9b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f"}]`,
+		},
+		{
+			Name: "DigestPinnedImageNotMatched",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{
+					"registry.internal": "registry.example.com",
+				},
+			},
+			Object: deploymentWithImages("registry.other/team/app@sha256:0f2e8d3b5c5e4e6f8a9b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f"),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunImageRegistryWithPort(t *testing.T) {
+	cases := []pluginCase{
+		{
+			Name: "HostAndPortKey",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{
+					"docker-registry.default.svc:5000": "image-registry.openshift-image-registry.svc:5000",
+				},
+			},
+			Object:            deploymentWithImages("docker-registry.default.svc:5000/ns/app:tag"),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "image-registry.openshift-image-registry.svc:5000/ns/app:tag"}]`,
+		},
+		{
+			Name: "HostAndPortKeyNestedRepository",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{
+					"docker-registry.default.svc:5000": "image-registry.openshift-image-registry.svc:5000",
+				},
+			},
+			Object:            deploymentWithImages("docker-registry.default.svc:5000/ns/app/sub:tag"),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "image-registry.openshift-image-registry.svc:5000/ns/app/sub:tag"}]`,
+		},
+		{
+			Name: "HostAndPortKeyRepositoryWithoutNamespace",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{
+					"docker-registry.default.svc:5000": "image-registry.openshift-image-registry.svc:5000",
+				},
+			},
+			Object:            deploymentWithImages("docker-registry.default.svc:5000/app:tag"),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "image-registry.openshift-image-registry.svc:5000/app:tag"}]`,
+		},
+		{
+			Name: "LocalhostRepositoryWithoutNamespace",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{
+					"localhost": "registry.example.com",
+				},
+			},
+			Object:            deploymentWithImages("localhost/app:tag"),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "registry.example.com/app:tag"}]`,
+		},
+		{
+			Name: "KeyWithoutDotOrPort",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{
+					"myregistry": "new.example.com",
+				},
+			},
+			Object:            deploymentWithImages("myregistry/ns/app:1"),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "new.example.com/ns/app:1"}]`,
+		},
+		{
+			Name: "KeyWithoutDotOrPortNormalizingShortNames",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{
+					"myregistry": "new.example.com",
+					"docker.io":  "mirror.example.com",
+				},
+				NormalizeShortImageNames: true,
+			},
+			Object:            deploymentWithImages("myregistry/ns/app:1", "team/app:1"),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "new.example.com/ns/app:1"}, {"op": "replace", "path": "/spec/template/spec/containers/1/image", "value": "mirror.example.com/team/app:1"}]`,
+		},
+		{
+			Name: "DifferentPort",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{
+					"docker-registry.default.svc:5000": "image-registry.openshift-image-registry.svc:5000",
+				},
+			},
+			Object: deploymentWithImages("docker-registry.default.svc:5001/ns/app:tag"),
+		},
+		{
+			Name: "HostOnlyKey",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{
+					"docker-registry.default.svc": "image-registry.openshift-image-registry.svc",
+				},
+			},
+			Object: deploymentWithImages("docker-registry.default.svc:5000/ns/app:tag"),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestNewKubernetesTransformPlugin(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Plugin      kubernetes.KubernetesTransformPlugin
+		ShouldError bool
+	}{
+		{
+			Name: "ZeroValue",
+		},
+		{
+			Name: "ValidOptions",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				AddedAnnotations:    map[string]string{"konveyor.io/migrated": "true"},
+				RegistryReplacement: map[string]string{"quay.io": "registry.example.com:5000"},
+				NewNamespace:        "destination",
+				RemoveAnnotation:    []string{"kubectl.kubernetes.io/last-applied-configuration"},
+			},
+		},
+		{
+			Name:        "InvalidNamespace",
+			Plugin:      kubernetes.KubernetesTransformPlugin{NewNamespace: "Not_A_Namespace"},
+			ShouldError: true,
+		},
+		{
+			Name:        "InvalidSourceNamespace",
+			Plugin:      kubernetes.KubernetesTransformPlugin{NewNamespace: "destination", SourceNamespace: "Not_A_Namespace"},
+			ShouldError: true,
+		},
+		{
+			Name:        "EmptyRegistryReplacementValue",
+			Plugin:      kubernetes.KubernetesTransformPlugin{RegistryReplacement: map[string]string{"quay.io": ""}},
+			ShouldError: true,
+		},
+		{
+			Name:        "EmptyRegistryReplacementKey",
+			Plugin:      kubernetes.KubernetesTransformPlugin{RegistryReplacement: map[string]string{"": "quay.io"}},
+			ShouldError: true,
+		},
+		{
+			Name:        "EmptyImageArchSuffix",
+			Plugin:      kubernetes.KubernetesTransformPlugin{ImageArchSuffixMapping: map[string]string{"": "-arm64"}},
+			ShouldError: true,
+		},
+		{
+			Name:        "InvalidAddedAnnotationKey",
+			Plugin:      kubernetes.KubernetesTransformPlugin{AddedAnnotations: map[string]string{"not valid": "value"}},
+			ShouldError: true,
+		},
+		{
+			Name: "AddedAnnotationsWithinSizeLimit",
+			Plugin: kubernetes.KubernetesTransformPlugin{AddedAnnotations: map[string]string{
+				"example.com/config": strings.Repeat("x", 128*1024),
+			}},
+		},
+		{
+			Name:        "InvalidRemoveAnnotationKey",
+			Plugin:      kubernetes.KubernetesTransformPlugin{RemoveAnnotation: []string{"/invalid"}},
+			ShouldError: true,
+		},
+		{
+			Name:        "InvalidNodePortRange",
+			Plugin:      kubernetes.KubernetesTransformPlugin{NodePortRange: "32767-30000"},
+			ShouldError: true,
+		},
+		{
+			Name:        "InvalidLabelSelector",
+			Plugin:      kubernetes.KubernetesTransformPlugin{LabelSelector: "team in (payments"},
+			ShouldError: true,
+		},
+		{
+			Name:        "EmptyStorageClassMappingSource",
+			Plugin:      kubernetes.KubernetesTransformPlugin{StorageClassMapping: map[string]string{"": "gp3"}},
+			ShouldError: true,
+		},
+		{
+			Name:   "ValidAPIVersionMapping",
+			Plugin: kubernetes.KubernetesTransformPlugin{APIVersionMapping: map[string]string{"Deployment.v1beta1.extensions": "apps/v1"}},
+		},
+		{
+			Name:        "APIVersionMappingWithoutVersion",
+			Plugin:      kubernetes.KubernetesTransformPlugin{APIVersionMapping: map[string]string{"Deployment": "apps/v1"}},
+			ShouldError: true,
+		},
+		{
+			Name:        "InvalidAPIVersionMappingTarget",
+			Plugin:      kubernetes.KubernetesTransformPlugin{APIVersionMapping: map[string]string{"Deployment.v1beta1.extensions": "apps/v1/beta"}},
+			ShouldError: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			p, err := kubernetes.NewKubernetesTransformPlugin(c.Plugin)
+			if (err != nil) != c.ShouldError {
+				t.Fatalf("NewKubernetesTransformPlugin() error = %v, ShouldError %v", err, c.ShouldError)
+			}
+			if err == nil && p == nil {
+				t.Error("expected a plugin to be returned")
+			}
+		})
+	}
+}
+
+func TestValidateAnnotationsSize(t *testing.T) {
+	k := kubernetes.KubernetesTransformPlugin{AddedAnnotations: map[string]string{
+		"example.com/migrated":     "true",
+		"example.com/large-config": strings.Repeat("x", 200*1024),
+		"example.com/other-config": strings.Repeat("x", 100*1024),
+	}}
+	err := k.Validate()
+	if err == nil {
+		t.Fatal("expected oversized annotations to be rejected")
+	}
+	if !strings.Contains(err.Error(), `"example.com/large-config"`) {
+		t.Errorf("expected the error to name the largest annotation, got %v", err)
+	}
+}
+
+func TestRunExplain(t *testing.T) {
+	cases := []struct {
+		Name                string
+		Object              *unstructured.Unstructured
+		RegistryReplacement map[string]string
+		Path                string
+		Reason              string
+	}{
+		{
+			Name: "ServiceClusterIP",
+			Object: newObject("v1", "Service", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"clusterIP": "172.30.12.4",
+				},
+			}),
+			Path:   "/spec/clusterIP",
+			Reason: "removed clusterIP so it is allocated on the destination cluster",
+		},
+		{
+			Name:   "ImageRewrite",
+			Object: deploymentWithImages("docker.io/library/nginx:latest"),
+			RegistryReplacement: map[string]string{
+				"docker.io": "quay.io",
+			},
+			Path:   "/spec/template/spec/containers/0/image",
+			Reason: "rewrote image docker.io/library/nginx:latest→quay.io/library/nginx:latest",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := transform.Runner{}
+			ops, _, err := runner.RunExplain(*c.Object, []transform.Plugin{
+				&kubernetes.KubernetesTransformPlugin{RegistryReplacement: c.RegistryReplacement},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ops) != 1 {
+				t.Fatalf("expected one operation, got: %#v", ops)
+			}
+			path, err := ops[0].Operation.Path()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != c.Path {
+				t.Errorf("Invalid path. Actual: %v, Expected: %v", path, c.Path)
+			}
+			if ops[0].Reason != c.Reason {
+				t.Errorf("Invalid reason. Actual: %v, Expected: %v", ops[0].Reason, c.Reason)
+			}
+		})
+	}
+}
+
+func TestRunRemovePodTemplateHash(t *testing.T) {
+	workload := func(kind string) *unstructured.Unstructured {
+		return newObject("apps/v1", kind, map[string]interface{}{
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{
+						"app":               "test",
+						"pod-template-hash": "5d59d67564",
+					},
+				},
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"labels": map[string]interface{}{
+							"app":               "test",
+							"pod-template-hash": "5d59d67564",
+						},
+					},
+				},
+			},
+		})
+	}
+	removed := `[{"op": "remove", "path": "/spec/template/metadata/labels/pod-template-hash"},
+{"op": "remove", "path": "/spec/selector/matchLabels/pod-template-hash"}]`
+
+	cases := []pluginCase{
+		{
+			Name:              "Deployment",
+			Plugin:            kubernetes.KubernetesTransformPlugin{RemovePodTemplateHash: true},
+			Object:            workload("Deployment"),
+			PatchResponseJson: removed,
+		},
+		{
+			Name:              "ReplicaSet",
+			Plugin:            kubernetes.KubernetesTransformPlugin{RemovePodTemplateHash: true},
+			Object:            workload("ReplicaSet"),
+			PatchResponseJson: removed,
+		},
+		{
+			Name:              "StatefulSet",
+			Plugin:            kubernetes.KubernetesTransformPlugin{RemovePodTemplateHash: true},
+			Object:            workload("StatefulSet"),
+			PatchResponseJson: removed,
+		},
+		{
+			Name:              "DaemonSet",
+			Plugin:            kubernetes.KubernetesTransformPlugin{RemovePodTemplateHash: true},
+			Object:            workload("DaemonSet"),
+			PatchResponseJson: removed,
+		},
+		{
+			Name:   "NotRequested",
+			Object: workload("Deployment"),
+		},
+		{
+			Name:   "NoHashLabel",
+			Plugin: kubernetes.KubernetesTransformPlugin{RemovePodTemplateHash: true},
+			Object: newObject("apps/v1", "Deployment", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"metadata": map[string]interface{}{
+							"labels": map[string]interface{}{"app": "test"},
+						},
+					},
+				},
+			}),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunLoadBalancerService(t *testing.T) {
+	service := func(serviceType string) *unstructured.Unstructured {
+		return newObject("v1", "Service", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"type":           serviceType,
+				"clusterIP":      "172.30.12.4",
+				"loadBalancerIP": "203.0.113.10",
+			},
+			"status": map[string]interface{}{
+				"loadBalancer": map[string]interface{}{
+					"ingress": []interface{}{
+						map[string]interface{}{"ip": "203.0.113.10"},
+					},
+				},
+			},
+		})
+	}
+
+	cases := []pluginCase{
+		{
+			Name:   "LoadBalancerService",
+			Object: service("LoadBalancer"),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/clusterIP"}, {"op": "remove", "path": "/spec/loadBalancerIP"},
+{"op": "remove", "path": "/status/loadBalancer"}]`,
+		},
+		{
+			Name: "LoadBalancerServiceWithoutStatus",
+			Object: newObject("v1", "Service", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"type":      "LoadBalancer",
+					"clusterIP": "172.30.12.4",
+				},
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/clusterIP"}]`,
+		},
+		{
+			Name:              "ClusterIPService",
+			Object:            service("ClusterIP"),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/clusterIP"}]`,
+		},
+		{
+			Name: "ClusterIPServiceWithoutClusterIP",
+			Object: newObject("v1", "Service", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"type": "ClusterIP",
+				},
+			}),
+		},
+		{
+			Name:   "ServiceWithoutSpec",
+			Object: newObject("v1", "Service", nil),
+		},
+		{
+			Name: "DualStackService",
+			Object: newObject("v1", "Service", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"type":       "ClusterIP",
+					"clusterIP":  "172.30.12.4",
+					"clusterIPs": []interface{}{"172.30.12.4", "fd00::1234"},
+				},
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/clusterIP"}, {"op": "remove", "path": "/spec/clusterIPs"}]`,
+		},
+		{
+			Name: "HeadlessServiceWithClusterIPs",
+			Object: newObject("v1", "Service", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"clusterIP":  "None",
+					"clusterIPs": []interface{}{"None"},
+				},
+			}),
+		},
+		{
+			Name: "HeadlessService",
+			Object: newObject("v1", "Service", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"type":      "ClusterIP",
+					"clusterIP": "None",
+				},
+			}),
+		},
+		{
+			Name: "ExternalNameService",
+			Object: newObject("v1", "Service", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"type":         "ExternalName",
+					"externalName": "db.example.com",
+					"externalIPs":  []interface{}{"203.0.113.20"},
+				},
+			}),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunWhiteOutReason(t *testing.T) {
+	cases := []struct {
+		Name           string
+		Kind           string
+		APIVersion     string
+		WhiteOutReason string
+	}{
+		{
+			Name:           "Endpoints",
+			Kind:           "Endpoints",
+			APIVersion:     "v1",
+			WhiteOutReason: "Endpoints auto-generated",
+		},
+		{
+			Name:           "EndpointSlice",
+			Kind:           "EndpointSlice",
+			APIVersion:     "discovery.k8s.io/v1",
+			WhiteOutReason: "EndpointSlice auto-generated",
+		},
+		{
+			Name:           "PersistentVolumeClaim",
+			Kind:           "PersistentVolumeClaim",
+			APIVersion:     "v1",
+			WhiteOutReason: "PVC handled separately",
+		},
+		{
+			Name:       "ConfigMap",
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			object := unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind":       c.Kind,
+					"apiVersion": c.APIVersion,
+				},
+			}
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{}
+			resp, err := p.Run(&object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.WhiteOutReason != c.WhiteOutReason {
+				t.Errorf("Invalid whiteout reason. Actual: %v, Expected: %v", resp.WhiteOutReason, c.WhiteOutReason)
+			}
+
+			runner := transform.Runner{}
+			results, err := runner.RunAll([]unstructured.Unstructured{object}, []transform.Plugin{p})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[0].WhiteOutReason != c.WhiteOutReason {
+				t.Errorf("Invalid runner whiteout reason. Actual: %v, Expected: %v", results[0].WhiteOutReason, c.WhiteOutReason)
+			}
+		})
+	}
+}
+
+func TestRunRemoveDeprecatedServiceAccount(t *testing.T) {
+	pod := func(spec map[string]interface{}) *unstructured.Unstructured {
+		spec["nodeName"] = "node-1"
+		return newObject("v1", "Pod", map[string]interface{}{
+			"spec": spec,
+		})
+	}
+
+	cases := []pluginCase{
+		{
+			Name:   "BothFieldsSet",
+			Plugin: kubernetes.KubernetesTransformPlugin{RemoveDeprecatedServiceAccount: true},
+			Object: pod(map[string]interface{}{
+				"serviceAccount":     "builder",
+				"serviceAccountName": "builder",
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"}, {"op": "remove", "path": "/spec/serviceAccount"}]`,
+		},
+		{
+			Name:   "OnlyDeprecatedFieldSet",
+			Plugin: kubernetes.KubernetesTransformPlugin{RemoveDeprecatedServiceAccount: true},
+			Object: pod(map[string]interface{}{
+				"serviceAccount": "builder",
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"}]`,
+		},
+		{
+			Name:   "FieldsDiffer",
+			Plugin: kubernetes.KubernetesTransformPlugin{RemoveDeprecatedServiceAccount: true},
+			Object: pod(map[string]interface{}{
+				"serviceAccount":     "builder",
+				"serviceAccountName": "deployer",
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"}]`,
+		},
+		{
+			Name: "NotRequested",
+			Object: pod(map[string]interface{}{
+				"serviceAccount":     "builder",
+				"serviceAccountName": "builder",
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"}]`,
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunDeploymentConfig(t *testing.T) {
+	deploymentConfig := func(group string) *unstructured.Unstructured {
+		return newObject(group+"/v1", "DeploymentConfig", map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":      "frontend",
+				"namespace": "source",
+			},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name":  "frontend",
+								"image": "docker-registry.default.svc:5000/source/frontend@sha256:0f2e8d3b5c5e4e6f8a9b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f",
+							},
+						},
+					},
+				},
+				"triggers": []interface{}{
+					map[string]interface{}{
+						"type": "ConfigChange",
+					},
+					map[string]interface{}{
+						"type": "ImageChange",
+						"imageChangeParams": map[string]interface{}{
+							"containerNames": []interface{}{"frontend"},
+							"from": map[string]interface{}{
+								"kind":      "ImageStreamTag",
+								"name":      "frontend:latest",
+								"namespace": "source",
+							},
+							"lastTriggeredImage": "docker-registry.default.svc:5000/source/frontend@sha256:0f2e8d3b5c5e4e6f8a9b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f",
+						},
+					},
+					map[string]interface{}{
+						"type": "ImageChange",
+						"imageChangeParams": map[string]interface{}{
+							"from": map[string]interface{}{
+								"kind":      "ImageStreamTag",
+								"name":      "nodejs:latest",
+								"namespace": "openshift",
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+
+	cases := []struct {
+		Name              string
+		Object            *unstructured.Unstructured
+		PatchResponseJson string
+	}{
+		{
+			Name:   "DeploymentConfig",
+			Object: deploymentConfig("apps.openshift.io"),
+			PatchResponseJson: `[
+{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "image-registry.openshift-image-registry.svc:5000/source/frontend@sha256:0f2e8d3b5c5e4e6f8a9b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f"},
+{"op": "replace", "path": "/spec/triggers/1/imageChangeParams/from/namespace", "value": "destination"},
+{"op": "replace", "path": "/spec/triggers/1/imageChangeParams/lastTriggeredImage", "value": "image-registry.openshift-image-registry.svc:5000/source/frontend@sha256:0f2e8d3b5c5e4e6f8a9b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f"}]`,
+		},
+		{
+			Name:   "OtherGroupTriggersUntouched",
+			Object: deploymentConfig("example.com"),
+			PatchResponseJson: `[
+{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "image-registry.openshift-image-registry.svc:5000/source/frontend@sha256:0f2e8d3b5c5e4e6f8a9b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				NewNamespace: "destination",
+				RegistryReplacement: map[string]string{
+					"docker-registry.default.svc:5000": "image-registry.openshift-image-registry.svc:5000",
+				},
+			}
+			runPlugin(t, p, c.Object, c.PatchResponseJson)
+		})
+	}
+}
+
+func TestRunAnnotationOrderIsDeterministic(t *testing.T) {
+	object := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "ConfigMap",
+			"apiVersion": "v1",
+		},
+	}
+	plugins := []transform.Plugin{
+		&kubernetes.KubernetesTransformPlugin{
+			AddedAnnotations: map[string]string{
+				"e.example.com-five":  "5",
+				"a.example.com-one":   "1",
+				"d.example.com-four":  "4",
+				"b.example.com-two":   "2",
+				"c.example.com-three": "3",
+			},
+		},
+	}
+	expected := `[{"op":"add","path":"/metadata/annotations/a.example.com-one","value":"1"},` +
+		`{"op":"add","path":"/metadata/annotations/b.example.com-two","value":"2"},` +
+		`{"op":"add","path":"/metadata/annotations/c.example.com-three","value":"3"},` +
+		`{"op":"add","path":"/metadata/annotations/d.example.com-four","value":"4"},` +
+		`{"op":"add","path":"/metadata/annotations/e.example.com-five","value":"5"}]`
+
+	runner := transform.Runner{}
+	for i := 0; i < 20; i++ {
+		patches, _, err := runner.Run(object, plugins)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(patches) != expected {
+			t.Fatalf("run %v produced different patches. Actual: %s, Expected: %s", i, patches, expected)
+		}
+	}
+}
+
+func TestRunAnnotationEscaping(t *testing.T) {
+	cases := []struct {
+		Name             string
+		Object           *unstructured.Unstructured
+		AddedAnnotations map[string]string
+		RemoveAnnotation []string
+		Expected         map[string]string
+	}{
+		{
+			Name: "SpecialCharacterValues",
+			Object: newObject("v1", "ConfigMap", map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{},
+				},
+			}),
+			AddedAnnotations: map[string]string{
+				"example.com/quotes":    `say "hello"`,
+				"example.com/newlines":  "line one\nline two",
+				"example.com/backslash": `C:\path\to\file`,
+				"example.com/unicode":   "migrated ✓",
+			},
+			Expected: map[string]string{
+				"example.com/quotes":    `say "hello"`,
+				"example.com/newlines":  "line one\nline two",
+				"example.com/backslash": `C:\path\to\file`,
+				"example.com/unicode":   "migrated ✓",
+			},
+		},
+		{
+			Name: "RemoveAnnotations",
+			Object: newObject("v1", "ConfigMap", map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{
+						"kubectl.kubernetes.io/last-applied-configuration": "{}",
+						"example.com/keep": "true",
+					},
+				},
+			}),
+			RemoveAnnotation: []string{"kubectl.kubernetes.io/last-applied-configuration", "example.com/missing"},
+			Expected: map[string]string{
+				"example.com/keep": "true",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				AddedAnnotations: c.AddedAnnotations,
+				RemoveAnnotation: c.RemoveAnnotation,
+			}
+			resp, err := p.Run(c.Object.DeepCopy())
+			if err != nil {
+				t.Fatal(err)
+			}
+			u := unstructured.Unstructured{Object: applyPatches(t, c.Object, resp.Patches)}
+			if !reflect.DeepEqual(u.GetAnnotations(), c.Expected) {
+				t.Errorf("Invalid annotations. Actual: %#v, Expected: %#v", u.GetAnnotations(), c.Expected)
+			}
+		})
+	}
+}
+
+func TestRunClearImmutable(t *testing.T) {
+	object := func(kind string, immutable bool) *unstructured.Unstructured {
+		u := newObject("v1", kind, map[string]interface{}{
+			"data": map[string]interface{}{
+				"key": "value",
+			},
+		})
+		if immutable {
+			u.Object["immutable"] = true
+		}
+		return u
+	}
+
+	cases := []pluginCase{
+		{
+			Name:              "ImmutableConfigMap",
+			Plugin:            kubernetes.KubernetesTransformPlugin{ClearImmutable: true},
+			Object:            object("ConfigMap", true),
+			PatchResponseJson: `[{"op": "remove", "path": "/immutable"}]`,
+		},
+		{
+			Name:              "ImmutableSecret",
+			Plugin:            kubernetes.KubernetesTransformPlugin{ClearImmutable: true},
+			Object:            object("Secret", true),
+			PatchResponseJson: `[{"op": "remove", "path": "/immutable"}]`,
+		},
+		{
+			Name:   "MutableConfigMap",
+			Plugin: kubernetes.KubernetesTransformPlugin{ClearImmutable: true},
+			Object: object("ConfigMap", false),
+		},
+		{
+			Name:   "OtherKind",
+			Plugin: kubernetes.KubernetesTransformPlugin{ClearImmutable: true},
+			Object: object("Example", true),
+		},
+		{
+			Name:   "NotRequested",
+			Object: object("ConfigMap", true),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunNormalizeShortImageNames(t *testing.T) {
+	cases := []struct {
+		Name                     string
+		Image                    string
+		NormalizeShortImageNames bool
+		PatchResponseJson        string
+	}{
+		{
+			Name:                     "BareName",
+			Image:                    "nginx:latest",
+			NormalizeShortImageNames: true,
+			PatchResponseJson:        `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "myregistry.io/library/nginx:latest"}]`,
+		},
+		{
+			Name:                     "LibraryName",
+			Image:                    "library/nginx",
+			NormalizeShortImageNames: true,
+			PatchResponseJson:        `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "myregistry.io/library/nginx"}]`,
+		},
+		{
+			Name:                     "UserRepository",
+			Image:                    "user/repo:1.0",
+			NormalizeShortImageNames: true,
+			PatchResponseJson:        `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "myregistry.io/user/repo:1.0"}]`,
+		},
+		{
+			Name:                     "FullyQualified",
+			Image:                    "docker.io/user/repo:1.0",
+			NormalizeShortImageNames: true,
+			PatchResponseJson:        `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "myregistry.io/user/repo:1.0"}]`,
+		},
+		{
+			Name:                     "OtherRegistry",
+			Image:                    "localhost:5000/repo",
+			NormalizeShortImageNames: true,
+		},
+		{
+			Name:  "BareNameNotNormalized",
+			Image: "nginx:latest",
+		},
+		{
+			Name:  "UserRepositoryNotNormalized",
+			Image: "user/repo:1.0",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement:      map[string]string{"docker.io": "myregistry.io"},
+				NormalizeShortImageNames: c.NormalizeShortImageNames,
+			}
+			runPlugin(t, p, deploymentWithImages(c.Image), c.PatchResponseJson)
+		})
+	}
+}
+
+func TestRunConsolidateAnnotations(t *testing.T) {
+	added := map[string]string{
+		"example.com/migrated": "true",
+		"example.com/source":   "cluster-a",
+	}
+
+	cases := []struct {
+		Name              string
+		Annotations       map[string]interface{}
+		PatchResponseJson string
+	}{
+		{
+			Name:              "NoExistingAnnotations",
+			PatchResponseJson: `[{"op": "add", "path": "/metadata/annotations", "value": {"example.com/migrated": "true", "example.com/source": "cluster-a"}}]`,
+		},
+		{
+			Name: "ExistingAnnotations",
+			Annotations: map[string]interface{}{
+				"example.com/owner":  "team-a",
+				"example.com/source": "unknown",
+			},
+			PatchResponseJson: `[{"op": "replace", "path": "/metadata/annotations", "value": {"example.com/owner": "team-a", "example.com/migrated": "true", "example.com/source": "cluster-a"}}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			object := annotatedObject("v1", "ConfigMap", "test", c.Annotations)
+
+			// The consolidated operations must apply without the annotations
+			// map the Runner adds for per key operations.
+			consolidated, _ := runPlugin(t, &kubernetes.KubernetesTransformPlugin{AddedAnnotations: added, ConsolidateAnnotations: true}, object, c.PatchResponseJson)
+			actual := applyPatches(t, object, consolidated.Patches)
+
+			perKey, err := (&kubernetes.KubernetesTransformPlugin{AddedAnnotations: added}).Run(object.DeepCopy())
+			if err != nil {
+				t.Fatal(err)
+			}
+			perKeyObject := object.DeepCopy()
+			if c.Annotations == nil {
+				perKeyObject.SetAnnotations(map[string]string{})
+			}
+			expected := applyPatches(t, perKeyObject, perKey.Patches)
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("Consolidated result differs from per key result. Actual: %#v, Expected: %#v", actual, expected)
+			}
+		})
+	}
+}
+
+func TestRunConsolidateAnnotationsWithRemovals(t *testing.T) {
+	cases := []struct {
+		Name                  string
+		Annotations           map[string]interface{}
+		RemoveAnnotation      []string
+		PruneEmptyAnnotations bool
+		PatchResponseJson     string
+	}{
+		{
+			Name:              "NoExistingAnnotations",
+			RemoveAnnotation:  []string{"kubectl.kubernetes.io/last-applied-configuration"},
+			PatchResponseJson: `[{"op": "add", "path": "/metadata/annotations", "value": {"example.com/migrated": "true"}}]`,
+		},
+		{
+			Name: "ExistingAnnotations",
+			Annotations: map[string]interface{}{
+				"example.com/owner": "team-a",
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			},
+			RemoveAnnotation:  []string{"kubectl.kubernetes.io/last-applied-configuration"},
+			PatchResponseJson: `[{"op": "replace", "path": "/metadata/annotations", "value": {"example.com/owner": "team-a", "example.com/migrated": "true"}}]`,
+		},
+		{
+			Name: "AddedAndRemoved",
+			Annotations: map[string]interface{}{
+				"example.com/owner": "team-a",
+			},
+			RemoveAnnotation:  []string{"example.com/migrated"},
+			PatchResponseJson: "",
+		},
+		{
+			Name: "RemovedAll",
+			Annotations: map[string]interface{}{
+				"example.com/migrated": "true",
+			},
+			RemoveAnnotation:      []string{"example.com/migrated"},
+			PruneEmptyAnnotations: true,
+			PatchResponseJson:     `[{"op": "remove", "path": "/metadata/annotations"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				AddedAnnotations:       map[string]string{"example.com/migrated": "true"},
+				RemoveAnnotation:       c.RemoveAnnotation,
+				ConsolidateAnnotations: true,
+				PruneEmptyAnnotations:  c.PruneEmptyAnnotations,
+			}
+			runPlugin(t, p, annotatedObject("v1", "ConfigMap", "test", c.Annotations), c.PatchResponseJson)
+		})
+	}
+}
+
+func TestRunWebhookServiceNamespace(t *testing.T) {
+	webhook := func(name string, clientConfig map[string]interface{}) interface{} {
+		return map[string]interface{}{
+			"name":         name,
+			"clientConfig": clientConfig,
+		}
+	}
+	serviceRef := func(namespace string) map[string]interface{} {
+		return map[string]interface{}{
+			"service": map[string]interface{}{
+				"name":      "webhook",
+				"namespace": namespace,
+				"path":      "/validate",
+			},
+		}
+	}
+
+	cases := []pluginCase{
+		{
+			Name:   "CRDConversionWebhook",
+			Plugin: kubernetes.KubernetesTransformPlugin{NewNamespace: "destination", SourceNamespace: "source"},
+			Object: newObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"conversion": map[string]interface{}{
+						"strategy": "Webhook",
+						"webhook": map[string]interface{}{
+							"clientConfig": serviceRef("source"),
+						},
+					},
+				},
+			}),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/conversion/webhook/clientConfig/service/namespace", "value": "destination"}]`,
+		},
+		{
+			Name:   "CRDWithoutConversionWebhook",
+			Plugin: kubernetes.KubernetesTransformPlugin{NewNamespace: "destination", SourceNamespace: "source"},
+			Object: newObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"conversion": map[string]interface{}{"strategy": "None"},
+				},
+			}),
+		},
+		{
+			Name:   "ValidatingWebhookConfiguration",
+			Plugin: kubernetes.KubernetesTransformPlugin{NewNamespace: "destination", SourceNamespace: "source"},
+			Object: newObject("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration", map[string]interface{}{
+				"webhooks": []interface{}{
+					webhook("service.example.com", serviceRef("source")),
+					webhook("url.example.com", map[string]interface{}{"url": "https://example.com/validate"}),
+					webhook("moved.example.com", serviceRef("destination")),
+				},
+			}),
+			PatchResponseJson: `[{"op": "replace", "path": "/webhooks/0/clientConfig/service/namespace", "value": "destination"}]`,
+		},
+		{
+			Name:   "MutatingWebhookConfiguration",
+			Plugin: kubernetes.KubernetesTransformPlugin{NewNamespace: "destination", SourceNamespace: "source"},
+			Object: newObject("admissionregistration.k8s.io/v1", "MutatingWebhookConfiguration", map[string]interface{}{
+				"webhooks": []interface{}{
+					webhook("first.example.com", serviceRef("source")),
+					webhook("second.example.com", serviceRef("source")),
+				},
+			}),
+			PatchResponseJson: `[{"op": "replace", "path": "/webhooks/0/clientConfig/service/namespace", "value": "destination"},
+{"op": "replace", "path": "/webhooks/1/clientConfig/service/namespace", "value": "destination"}]`,
+		},
+		{
+			Name:   "ServiceInAnotherNamespace",
+			Plugin: kubernetes.KubernetesTransformPlugin{NewNamespace: "destination", SourceNamespace: "source"},
+			Object: newObject("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration", map[string]interface{}{
+				"webhooks": []interface{}{
+					webhook("monitoring.example.com", serviceRef("monitoring")),
+					webhook("service.example.com", serviceRef("source")),
+				},
+			}),
+			PatchResponseJson: `[{"op": "replace", "path": "/webhooks/1/clientConfig/service/namespace", "value": "destination"}]`,
+		},
+		{
+			Name:   "CRDConversionWebhookInAnotherNamespace",
+			Plugin: kubernetes.KubernetesTransformPlugin{NewNamespace: "destination", SourceNamespace: "source"},
+			Object: newObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"conversion": map[string]interface{}{
+						"strategy": "Webhook",
+						"webhook": map[string]interface{}{
+							"clientConfig": serviceRef("operators"),
+						},
+					},
+				},
+			}),
+		},
+		{
+			Name:   "NoSourceNamespace",
+			Plugin: kubernetes.KubernetesTransformPlugin{NewNamespace: "destination"},
+			Object: newObject("admissionregistration.k8s.io/v1", "MutatingWebhookConfiguration", map[string]interface{}{
+				"webhooks": []interface{}{
+					webhook("first.example.com", serviceRef("source")),
+				},
+			}),
+		},
+		{
+			Name:   "NoNewNamespace",
+			Plugin: kubernetes.KubernetesTransformPlugin{SourceNamespace: "source"},
+			Object: newObject("admissionregistration.k8s.io/v1", "MutatingWebhookConfiguration", map[string]interface{}{
+				"webhooks": []interface{}{
+					webhook("first.example.com", serviceRef("source")),
+				},
+			}),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunRemoveAnnotationsByPrefix(t *testing.T) {
+	object := func() *unstructured.Unstructured {
+		return newObject("apps/v1", "Deployment", map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]interface{}{
+					"deployment.kubernetes.io/revision":                "3",
+					"kubectl.kubernetes.io/last-applied-configuration": "{}",
+					"kubectl.kubernetes.io/restartedAt":                "2021-06-01T00:00:00Z",
+					"example.com/owner":                                "team-a",
+				},
+			},
+		})
+	}
+
+	cases := []struct {
+		Name                      string
+		RemoveAnnotation          []string
+		RemoveAnnotationsByPrefix []string
+		KeepAnnotations           []string
+		PatchResponseJson         string
+	}{
+		{
+			Name:                      "PrefixMatch",
+			RemoveAnnotationsByPrefix: []string{"kubectl.kubernetes.io/", "deployment.kubernetes.io/"},
+			PatchResponseJson: `[{"op": "remove", "path": "/metadata/annotations/deployment.kubernetes.io~1revision"},
+{"op": "remove", "path": "/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration"},
+{"op": "remove", "path": "/metadata/annotations/kubectl.kubernetes.io~1restartedAt"}]`,
+		},
+		{
+			Name:                      "KeepExemption",
+			RemoveAnnotationsByPrefix: []string{"kubectl.kubernetes.io/"},
+			KeepAnnotations:           []string{"kubectl.kubernetes.io/restartedAt"},
+			PatchResponseJson:         `[{"op": "remove", "path": "/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration"}]`,
+		},
+		{
+			Name:                      "PrefixMatchesNothing",
+			RemoveAnnotationsByPrefix: []string{"openshift.io/"},
+		},
+		{
+			Name:                      "CombinedWithRemoveAnnotation",
+			RemoveAnnotation:          []string{"kubectl.kubernetes.io/last-applied-configuration"},
+			RemoveAnnotationsByPrefix: []string{"kubectl.kubernetes.io/last"},
+			PatchResponseJson:         `[{"op": "remove", "path": "/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				RemoveAnnotation:          c.RemoveAnnotation,
+				RemoveAnnotationsByPrefix: c.RemoveAnnotationsByPrefix,
+				KeepAnnotations:           c.KeepAnnotations,
+			}
+			obj := object()
+			runPlugin(t, p, obj, c.PatchResponseJson)
+		})
+	}
+}
+
+func TestRunStripPodStatus(t *testing.T) {
+	pod := func(withStatus bool) *unstructured.Unstructured {
+		u := newObject("v1", "Pod", map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":      "standalone",
+				"namespace": "test",
+			},
+			"spec": map[string]interface{}{
+				"nodeName":         "node-1",
+				"runtimeClassName": "kata",
+				"overhead": map[string]interface{}{
+					"cpu": "250m",
+				},
+			},
+		})
+		if withStatus {
+			u.Object["status"] = map[string]interface{}{
+				"phase":  "Running",
+				"hostIP": "10.0.0.12",
+				"podIP":  "10.128.0.4",
+			}
+		}
+		return u
+	}
+
+	cases := []struct {
+		Name              string
+		Object            *unstructured.Unstructured
+		StripPodStatus    bool
+		IsWhiteOut        bool
+		PatchResponseJson string
+	}{
+		{
+			Name:           "StripStatus",
+			Object:         pod(true),
+			StripPodStatus: true,
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"}, {"op": "remove", "path": "/spec/overhead"},
+{"op": "remove", "path": "/status"}]`,
+		},
+		{
+			Name:              "StripWithoutStatus",
+			Object:            pod(false),
+			StripPodStatus:    true,
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"}, {"op": "remove", "path": "/spec/overhead"}]`,
+		},
+		{
+			Name:              "NotRequested",
+			Object:            pod(true),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				StripPodStatus: c.StripPodStatus,
+			}
+			resp, _ := runPlugin(t, p, c.Object, c.PatchResponseJson)
+			if resp.IsWhiteOut != c.IsWhiteOut {
+				t.Errorf("Invalid white out determination. Actual: %v, Expected: %v", resp.IsWhiteOut, c.IsWhiteOut)
+			}
+		})
+	}
+}
+
+func TestRunSparseImageReplacement(t *testing.T) {
+	podWithImages := func(images ...string) *unstructured.Unstructured {
+		containers := []interface{}{}
+		for _, image := range images {
+			containers = append(containers, map[string]interface{}{"image": image})
+		}
+		return newObject("v1", "Pod", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"nodeName":       "node-1",
+				"containers":     containers,
+				"initContainers": []interface{}{map[string]interface{}{"image": "quay.io/konveyor/init:latest"}},
+			},
+		})
+	}
+
+	cases := []struct {
+		Name              string
+		Object            *unstructured.Unstructured
+		ContainersPath    []string
+		PatchResponseJson string
+		Images            []interface{}
+	}{
+		{
+			Name:           "DeploymentFirstAndLast",
+			Object:         deploymentWithImages("quay.io/konveyor/app:v1", "docker.io/library/redis:6", "quay.io/konveyor/proxy:v1"),
+			ContainersPath: []string{"spec", "template", "spec", "containers"},
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "registry.example.com/konveyor/app:v1"},
+{"op": "replace", "path": "/spec/template/spec/containers/2/image", "value": "registry.example.com/konveyor/proxy:v1"}]`,
+			Images: []interface{}{"registry.example.com/konveyor/app:v1", "docker.io/library/redis:6", "registry.example.com/konveyor/proxy:v1"},
+		},
+		{
+			Name:           "PodSecondOfThree",
+			Object:         podWithImages("docker.io/library/nginx:1.21", "quay.io/konveyor/app:v1", "docker.io/library/redis:6"),
+			ContainersPath: []string{"spec", "containers"},
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"},
+{"op": "replace", "path": "/spec/containers/1/image", "value": "registry.example.com/konveyor/app:v1"},
+{"op": "replace", "path": "/spec/initContainers/0/image", "value": "registry.example.com/konveyor/init:latest"}]`,
+			Images: []interface{}{"docker.io/library/nginx:1.21", "registry.example.com/konveyor/app:v1", "docker.io/library/redis:6"},
+		},
+		{
+			Name:           "PodFirstAndLast",
+			Object:         podWithImages("quay.io/konveyor/app:v1", "docker.io/library/redis:6", "quay.io/konveyor/proxy:v1"),
+			ContainersPath: []string{"spec", "containers"},
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"},
+{"op": "replace", "path": "/spec/containers/0/image", "value": "registry.example.com/konveyor/app:v1"},
+{"op": "replace", "path": "/spec/containers/2/image", "value": "registry.example.com/konveyor/proxy:v1"},
+{"op": "replace", "path": "/spec/initContainers/0/image", "value": "registry.example.com/konveyor/init:latest"}]`,
+			Images: []interface{}{"registry.example.com/konveyor/app:v1", "docker.io/library/redis:6", "registry.example.com/konveyor/proxy:v1"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{"quay.io": "registry.example.com"},
+			}
+			_, patched := runPlugin(t, p, c.Object, c.PatchResponseJson)
+
+			containers, _, err := unstructured.NestedSlice(patched, c.ContainersPath...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			images := []interface{}{}
+			for _, container := range containers {
+				images = append(images, container.(map[string]interface{})["image"])
+			}
+			if !reflect.DeepEqual(images, c.Images) {
+				t.Errorf("Invalid images. Actual: %v, Expected: %v", images, c.Images)
+			}
+		})
+	}
+}
+
+func TestRunSafeReplace(t *testing.T) {
+	cases := []struct {
+		Name              string
+		SafeReplace       bool
+		ChangedImage      string
+		PatchResponseJson string
+		ShouldFailApply   bool
+	}{
+		{
+			Name:        "TestPasses",
+			SafeReplace: true,
+			PatchResponseJson: `[{"op": "test", "path": "/spec/template/spec/containers/0/image", "value": "quay.io/konveyor/app:v1"},
+{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "registry.example.com/konveyor/app:v1"}]`,
+		},
+		{
+			Name:         "TestFails",
+			SafeReplace:  true,
+			ChangedImage: "quay.io/konveyor/app:v2",
+			PatchResponseJson: `[{"op": "test", "path": "/spec/template/spec/containers/0/image", "value": "quay.io/konveyor/app:v1"},
+{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "registry.example.com/konveyor/app:v1"}]`,
+			ShouldFailApply: true,
+		},
+		{
+			Name:              "NotRequested",
+			ChangedImage:      "quay.io/konveyor/app:v2",
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "registry.example.com/konveyor/app:v1"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{"quay.io": "registry.example.com"},
+				SafeReplace:         c.SafeReplace,
+			}
+			resp, _ := runPlugin(t, p, deploymentWithImages("quay.io/konveyor/app:v1"), c.PatchResponseJson)
+
+			// Apply the patches to the object as it is once it has changed.
+			obj := deploymentWithImages("quay.io/konveyor/app:v1")
+			if c.ChangedImage != "" {
+				obj = deploymentWithImages(c.ChangedImage)
+			}
+			doc, err := obj.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = resp.Patches.Apply(doc)
+			if c.ShouldFailApply != errors.Is(err, jsonpatch.ErrTestFailed) {
+				t.Errorf("unexpected result applying the patches: %v, ShouldFailApply: %v", err, c.ShouldFailApply)
+			}
+			if !c.ShouldFailApply && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRunAPIVersionMapping(t *testing.T) {
+	object := func(apiVersion, kind string) *unstructured.Unstructured {
+		return newObject(apiVersion, kind, map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":      "test",
+				"namespace": "test",
+			},
+		})
+	}
+	mapping := map[string]string{
+		"Deployment.v1beta1.extensions":      "apps/v1",
+		"PodDisruptionBudget.v1beta1.policy": "policy/v1",
+	}
+
+	plugin := kubernetes.KubernetesTransformPlugin{
+		APIVersionMapping: mapping,
+	}
+
+	cases := []pluginCase{
+		{
+			Name:              "ExtensionsDeployment",
+			Plugin:            plugin,
+			Object:            object("extensions/v1beta1", "Deployment"),
+			PatchResponseJson: `[{"op": "replace", "path": "/apiVersion", "value": "apps/v1"}]`,
+		},
+		{
+			Name:              "PodDisruptionBudget",
+			Plugin:            plugin,
+			Object:            object("policy/v1beta1", "PodDisruptionBudget"),
+			PatchResponseJson: `[{"op": "replace", "path": "/apiVersion", "value": "policy/v1"}]`,
+		},
+		{
+			Name:   "CurrentDeployment",
+			Plugin: plugin,
+			Object: object("apps/v1", "Deployment"),
+		},
+		{
+			Name:   "OtherKindInGroup",
+			Plugin: plugin,
+			Object: object("extensions/v1beta1", "Ingress"),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunTransformPVCsInline(t *testing.T) {
+	pvc := func() *unstructured.Unstructured {
+		return newObject("v1", "PersistentVolumeClaim", map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":      "data",
+				"namespace": "test",
+				"annotations": map[string]interface{}{
+					"pv.kubernetes.io/bind-completed":      "yes",
+					"pv.kubernetes.io/bound-by-controller": "yes",
+					"example.com/owner":                    "team-a",
+				},
+			},
+			"spec": map[string]interface{}{
+				"accessModes": []interface{}{"ReadWriteOnce"},
+				"volumeName":  "pvc-0f2e8d3b",
+			},
+			"status": map[string]interface{}{
+				"phase": "Bound",
+			},
+		})
+	}
+
+	cases := []struct {
+		Name                   string
+		TransformPVCsInline    bool
+		RemoveAnnotation       []string
+		ConsolidateAnnotations bool
+		IsWhiteOut             bool
+		PatchResponseJson      string
+	}{
+		{
+			Name:       "DefaultWhiteOut",
+			IsWhiteOut: true,
+		},
+		{
+			Name:                "Inline",
+			TransformPVCsInline: true,
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/volumeName"},
+{"op": "remove", "path": "/metadata/annotations/pv.kubernetes.io~1bind-completed"},
+{"op": "remove", "path": "/metadata/annotations/pv.kubernetes.io~1bound-by-controller"},
+{"op": "remove", "path": "/status"}]`,
+		},
+		{
+			Name:                "BindingAnnotationAlsoConfiguredForRemoval",
+			TransformPVCsInline: true,
+			RemoveAnnotation:    []string{"pv.kubernetes.io/bind-completed"},
+			PatchResponseJson: `[{"op": "remove", "path": "/metadata/annotations/pv.kubernetes.io~1bind-completed"},
+{"op": "remove", "path": "/spec/volumeName"},
+{"op": "remove", "path": "/metadata/annotations/pv.kubernetes.io~1bound-by-controller"},
+{"op": "remove", "path": "/status"}]`,
+		},
+		{
+			Name:                   "BindingAnnotationConfiguredForRemovalConsolidated",
+			TransformPVCsInline:    true,
+			RemoveAnnotation:       []string{"pv.kubernetes.io/bind-completed"},
+			ConsolidateAnnotations: true,
+			PatchResponseJson: `[{"op": "replace", "path": "/metadata/annotations", "value": {"example.com/owner": "team-a"}},
+{"op": "remove", "path": "/spec/volumeName"},
+{"op": "remove", "path": "/status"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				TransformPVCsInline:    c.TransformPVCsInline,
+				RemoveAnnotation:       c.RemoveAnnotation,
+				ConsolidateAnnotations: c.ConsolidateAnnotations,
+			}
+			obj := pvc()
+			resp, patched := runPlugin(t, p, obj, c.PatchResponseJson)
+			if resp.IsWhiteOut != c.IsWhiteOut {
+				t.Errorf("Invalid white out determination. Actual: %v, Expected: %v", resp.IsWhiteOut, c.IsWhiteOut)
+			}
+
+			annotations, _, _ := unstructured.NestedStringMap(patched, "metadata", "annotations")
+			if annotations["example.com/owner"] != "team-a" {
+				t.Errorf("unrelated annotations should be kept, got: %v", annotations)
+			}
+			if c.TransformPVCsInline && len(annotations) != 1 {
+				t.Errorf("binding annotations should be removed, got: %v", annotations)
+			}
+		})
+	}
+}
+
+func TestRunStorageClassMapping(t *testing.T) {
+	volume := func(kind, storageClass string) *unstructured.Unstructured {
+		return newObject("v1", kind, map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name": "data",
+			},
+			"spec": map[string]interface{}{
+				"storageClassName": storageClass,
+			},
+		})
+	}
+	statefulSet := newObject("apps/v1", "StatefulSet", map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": "db",
+		},
+		"spec": map[string]interface{}{
+			"volumeClaimTemplates": []interface{}{
+				map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "data"},
+					"spec":     map[string]interface{}{"storageClassName": "gp2"},
+				},
+				map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "logs"},
+					"spec":     map[string]interface{}{"storageClassName": "standard"},
+				},
+			},
+		},
+	})
+	mapping := map[string]string{
+		"gp2":      "ocs-storagecluster-ceph-rbd",
+		"standard": "",
+	}
+
+	cases := []struct {
+		Name                string
+		Object              *unstructured.Unstructured
+		TransformPVCsInline bool
+		IsWhiteOut          bool
+		PatchResponseJson   string
+	}{
+		{
+			Name:                "PersistentVolumeClaim",
+			Object:              volume("PersistentVolumeClaim", "gp2"),
+			TransformPVCsInline: true,
+			PatchResponseJson:   `[{"op": "replace", "path": "/spec/storageClassName", "value": "ocs-storagecluster-ceph-rbd"}]`,
+		},
+		{
+			Name:       "PersistentVolumeClaimWhitedOut",
+			Object:     volume("PersistentVolumeClaim", "gp2"),
+			IsWhiteOut: true,
+		},
+		{
+			Name:              "PersistentVolumeToDefault",
+			Object:            volume("PersistentVolume", "standard"),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/storageClassName"}]`,
+		},
+		{
+			Name:   "UnmappedStorageClass",
+			Object: volume("PersistentVolume", "local"),
+		},
+		{
+			Name:   "StatefulSet",
+			Object: statefulSet,
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/volumeClaimTemplates/0/spec/storageClassName", "value": "ocs-storagecluster-ceph-rbd"},
+{"op": "remove", "path": "/spec/volumeClaimTemplates/1/spec/storageClassName"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				StorageClassMapping: mapping,
+				TransformPVCsInline: c.TransformPVCsInline,
+			}
+			resp, _ := runPlugin(t, p, c.Object, c.PatchResponseJson)
+			if resp.IsWhiteOut != c.IsWhiteOut {
+				t.Errorf("Invalid white out determination. Actual: %v, Expected: %v", resp.IsWhiteOut, c.IsWhiteOut)
+			}
+		})
+	}
+}
+
+func TestRunAnnotationPlaceholders(t *testing.T) {
+	object := newObject("v1", "ConfigMap", map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      "settings",
+			"namespace": "source",
+		},
+	})
+
+	cases := []struct {
+		Name     string
+		Value    string
+		Expected string
+	}{
+		{
+			Name:     "Namespace",
+			Value:    "%NAMESPACE%",
+			Expected: "source",
+		},
+		{
+			Name:     "Name",
+			Value:    "%NAME%",
+			Expected: "settings",
+		},
+		{
+			Name:     "Kind",
+			Value:    "%KIND%",
+			Expected: "ConfigMap",
+		},
+		{
+			Name:     "Combined",
+			Value:    "%KIND%/%NAMESPACE%/%NAME%",
+			Expected: "ConfigMap/source/settings",
+		},
+		{
+			Name:     "Literal",
+			Value:    "true",
+			Expected: "true",
+		},
+		{
+			Name:     "StrayPercent",
+			Value:    "100% of %NAMESPACE",
+			Expected: "100% of %NAMESPACE",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				AddedAnnotations: map[string]string{"migrated-from": c.Value},
+			}
+			runPlugin(t, p, object, fmt.Sprintf(`[{"op": "add", "path": "/metadata/annotations/migrated-from", "value": %q}]`, c.Expected))
+		})
+	}
+}
+
+func TestRunIngressClassMapping(t *testing.T) {
+	ingress := func(apiVersion, kind, ingressClass string) *unstructured.Unstructured {
+		return newObject(apiVersion, kind, map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name": "frontend",
+				"annotations": map[string]interface{}{
+					"kubernetes.io/ingress.class": ingressClass,
+				},
+			},
+			"spec": map[string]interface{}{
+				"ingressClassName": ingressClass,
+			},
+		})
+	}
+
+	plugin := kubernetes.KubernetesTransformPlugin{
+		IngressClassMapping: map[string]string{"nginx": "openshift-default"},
+	}
+
+	cases := []pluginCase{
+		{
+			Name:   "NetworkingIngress",
+			Plugin: plugin,
+			Object: ingress("networking.k8s.io/v1", "Ingress", "nginx"),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/ingressClassName", "value": "openshift-default"},
+{"op": "replace", "path": "/metadata/annotations/kubernetes.io~1ingress.class", "value": "openshift-default"}]`,
+		},
+		{
+			Name:   "UnmappedClass",
+			Plugin: plugin,
+			Object: ingress("networking.k8s.io/v1", "Ingress", "traefik"),
+		},
+		{
+			Name:   "NotAnIngress",
+			Plugin: plugin,
+			Object: ingress("example.com/v1", "Ingress", "nginx"),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunHostDomainMapping(t *testing.T) {
+	plugin := kubernetes.KubernetesTransformPlugin{
+		HostDomainMapping: map[string]string{"*.apps.old.example.com": "*.apps.new.example.com"},
+	}
+
+	cases := []pluginCase{
+		{
+			Name:   "Ingress",
+			Plugin: plugin,
+			Object: newObject("networking.k8s.io/v1", "Ingress", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"rules": []interface{}{
+						map[string]interface{}{"host": "shop.apps.old.example.com"},
+						map[string]interface{}{"host": "api.example.org"},
+						map[string]interface{}{"host": "*.apps.old.example.com"},
+						map[string]interface{}{"http": map[string]interface{}{}},
+					},
+					"tls": []interface{}{
+						map[string]interface{}{
+							"hosts":      []interface{}{"shop.apps.old.example.com", "api.example.org"},
+							"secretName": "shop-tls",
+						},
+					},
+				},
+			}),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/rules/0/host", "value": "shop.apps.new.example.com"},
+{"op": "replace", "path": "/spec/rules/2/host", "value": "*.apps.new.example.com"},
+{"op": "replace", "path": "/spec/tls/0/hosts/0", "value": "shop.apps.new.example.com"}]`,
+		},
+		{
+			Name:   "Route",
+			Plugin: plugin,
+			Object: newObject("route.openshift.io/v1", "Route", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"host": "shop-payments.apps.old.example.com",
+				},
+			}),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/host", "value": "shop-payments.apps.new.example.com"}]`,
+		},
+		{
+			Name:   "SimilarDomain",
+			Plugin: plugin,
+			Object: newObject("route.openshift.io/v1", "Route", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"host": "shop.myapps.old.example.com",
+				},
+			}),
+		},
+		{
+			Name:   "NotAnIngress",
+			Plugin: plugin,
+			Object: newObject("v1", "Service", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"host": "shop.apps.old.example.com",
+				},
+			}),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunRemoveNodePorts(t *testing.T) {
+	service := func() *unstructured.Unstructured {
+		return newObject("v1", "Service", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"type": "NodePort",
+				"ports": []interface{}{
+					map[string]interface{}{"name": "http", "port": int64(80), "nodePort": int64(30080)},
+					map[string]interface{}{"name": "https", "port": int64(443), "nodePort": int64(40443)},
+					map[string]interface{}{"name": "metrics", "port": int64(9090)},
+				},
+			},
+		})
+	}
+
+	cases := []struct {
+		Name              string
+		RemoveNodePorts   bool
+		NodePortRange     string
+		PatchResponseJson string
+	}{
+		{
+			Name: "Default",
+		},
+		{
+			Name:            "RemoveAll",
+			RemoveNodePorts: true,
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/ports/0/nodePort"},
+{"op": "remove", "path": "/spec/ports/1/nodePort"}]`,
+		},
+		{
+			Name:              "RemoveOutOfRange",
+			RemoveNodePorts:   true,
+			NodePortRange:     "30000-32767",
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/ports/1/nodePort"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				RemoveNodePorts: c.RemoveNodePorts,
+				NodePortRange:   c.NodePortRange,
+			}
+			obj := service()
+			runPlugin(t, p, obj, c.PatchResponseJson)
+		})
+	}
+}
+
+func TestRunImageAnnotations(t *testing.T) {
+	annotations := map[string]interface{}{
+		"sidecar.istio.io/proxyImage": "quay.io/maistra/proxyv2-ubi8:2.1.0",
+		"sidecar.istio.io/inject":     "true",
+	}
+	deployment := deploymentWithImages("docker.io/library/nginx:1.21")
+	if err := unstructured.SetNestedMap(deployment.Object, annotations, "spec", "template", "metadata", "annotations"); err != nil {
+		t.Fatal(err)
+	}
+	pod := newObject("v1", "Pod", map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+		"spec": map[string]interface{}{
+			"nodeName": "node-1",
+		},
+	})
+
+	cases := []struct {
+		Name              string
+		Object            *unstructured.Unstructured
+		ImageAnnotations  []string
+		PatchResponseJson string
+	}{
+		{
+			Name:              "DeploymentTemplate",
+			Object:            deployment,
+			ImageAnnotations:  []string{"sidecar.istio.io/proxyImage"},
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/metadata/annotations/sidecar.istio.io~1proxyImage", "value": "registry.example.com/maistra/proxyv2-ubi8:2.1.0"}]`,
+		},
+		{
+			Name:             "Pod",
+			Object:           pod,
+			ImageAnnotations: []string{"sidecar.istio.io/proxyImage"},
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"},
+{"op": "replace", "path": "/metadata/annotations/sidecar.istio.io~1proxyImage", "value": "registry.example.com/maistra/proxyv2-ubi8:2.1.0"}]`,
+		},
+		{
+			Name:   "NotConfigured",
+			Object: deployment,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement: map[string]string{"quay.io": "registry.example.com"},
+				ImageAnnotations:    c.ImageAnnotations,
+			}
+			runPlugin(t, p, c.Object, c.PatchResponseJson)
+		})
+	}
+}
+
+func TestRunImageArchSuffixMapping(t *testing.T) {
+	cases := []struct {
+		Name                     string
+		Object                   *unstructured.Unstructured
+		RegistryReplacement      map[string]string
+		NormalizeShortImageNames bool
+		PatchResponseJson        string
+	}{
+		{
+			Name:              "ArchSuffix",
+			Object:            deploymentWithImages("quay.io/app/api:1.4-amd64"),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "quay.io/app/api:1.4-arm64"}]`,
+		},
+		{
+			Name:   "WithoutArchSuffix",
+			Object: deploymentWithImages("quay.io/app/api:1.4", "registry.internal:5000/app/api"),
+		},
+		{
+			Name:   "DigestPinned",
+			Object: deploymentWithImages("quay.io/app/api:1.4-amd64@sha256:0f2e8d3b5c5e4e6f8a9b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f"),
+		},
+		{
+			Name:   "CombinedWithRegistryReplacement",
+			Object: deploymentWithImages("quay.io/app/api:1.4-amd64", "quay.io/app/web:2.0"),
+			RegistryReplacement: map[string]string{
+				"quay.io": "registry.example.com",
+			},
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "registry.example.com/app/api:1.4-arm64"},
+{"op": "replace", "path": "/spec/template/spec/containers/1/image", "value": "registry.example.com/app/web:2.0"}]`,
+		},
+		{
+			Name:                     "ShortNameKeptWhenNormalizing",
+			Object:                   deploymentWithImages("nginx:1-amd64", "team/app:2-amd64"),
+			NormalizeShortImageNames: true,
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "nginx:1-arm64"},
+{"op": "replace", "path": "/spec/template/spec/containers/1/image", "value": "team/app:2-arm64"}]`,
+		},
+		{
+			Name:   "ShortNameNormalizedWithRegistryReplacement",
+			Object: deploymentWithImages("nginx:1-amd64", "quay.io/app/web:2.0-amd64"),
+			RegistryReplacement: map[string]string{
+				"docker.io": "mirror.example.com",
+			},
+			NormalizeShortImageNames: true,
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "mirror.example.com/library/nginx:1-arm64"},
+{"op": "replace", "path": "/spec/template/spec/containers/1/image", "value": "quay.io/app/web:2.0-arm64"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement:      c.RegistryReplacement,
+				ImageArchSuffixMapping:   map[string]string{"-amd64": "-arm64"},
+				NormalizeShortImageNames: c.NormalizeShortImageNames,
+			}
+			runPlugin(t, p, c.Object, c.PatchResponseJson)
+		})
+	}
+}
+
+func TestRunPruneEmptyAnnotations(t *testing.T) {
+	cases := []struct {
+		Name                string
+		Object              *unstructured.Unstructured
+		AddedAnnotations    map[string]string
+		TransformPVCsInline bool
+		IngressClassMapping map[string]string
+		PatchResponseJson   string
+	}{
+		{
+			Name: "LastAnnotationRemoved",
+			Object: annotatedObject("v1", "ConfigMap", "settings", map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/metadata/annotations"}]`,
+		},
+		{
+			Name: "OtherAnnotationsLeft",
+			Object: annotatedObject("v1", "ConfigMap", "settings", map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+				"team": "payments",
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration"}]`,
+		},
+		{
+			Name: "AnnotationsAdded",
+			Object: annotatedObject("v1", "ConfigMap", "settings", map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			}),
+			AddedAnnotations: map[string]string{"migrated": "true"},
+			PatchResponseJson: `[{"op": "add", "path": "/metadata/annotations/migrated", "value": "true"},
+{"op": "remove", "path": "/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration"}]`,
+		},
+		{
+			Name: "LastAnnotationsRemovedWithPVCBinding",
+			Object: annotatedObject("v1", "PersistentVolumeClaim", "data", map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+				"pv.kubernetes.io/bind-completed":                  "yes",
+			}),
+			TransformPVCsInline: true,
+			PatchResponseJson:   `[{"op": "remove", "path": "/metadata/annotations"}]`,
+		},
+		{
+			Name: "AnnotationReplacedByTransform",
+			Object: annotatedObject("networking.k8s.io/v1", "Ingress", "web", map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+				"kubernetes.io/ingress.class":                      "nginx",
+			}),
+			IngressClassMapping: map[string]string{"nginx": "openshift-default"},
+			PatchResponseJson: `[{"op": "remove", "path": "/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration"},
+{"op": "replace", "path": "/metadata/annotations/kubernetes.io~1ingress.class", "value": "openshift-default"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				AddedAnnotations:      c.AddedAnnotations,
+				RemoveAnnotation:      []string{"kubectl.kubernetes.io/last-applied-configuration"},
+				PruneEmptyAnnotations: true,
+				TransformPVCsInline:   c.TransformPVCsInline,
+				IngressClassMapping:   c.IngressClassMapping,
+			}
+			runPlugin(t, p, c.Object, c.PatchResponseJson)
+		})
+	}
+}
+
+func TestRunNormalizeDeploymentDefaults(t *testing.T) {
+	deployment := func(revisionHistoryLimit, progressDeadlineSeconds int64) *unstructured.Unstructured {
+		return newObject("apps/v1", "Deployment", map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name": "frontend",
+			},
+			"spec": map[string]interface{}{
+				"replicas":                int64(2),
+				"revisionHistoryLimit":    revisionHistoryLimit,
+				"progressDeadlineSeconds": progressDeadlineSeconds,
+			},
+		})
+	}
+
+	plugin := kubernetes.KubernetesTransformPlugin{
+		NormalizeDeploymentDefaults: true,
+	}
+
+	cases := []pluginCase{
+		{
+			Name:   "Defaults",
+			Plugin: plugin,
+			Object: deployment(10, 600),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/progressDeadlineSeconds"},
+{"op": "remove", "path": "/spec/revisionHistoryLimit"}]`,
+		},
+		{
+			Name:   "CustomValues",
+			Plugin: plugin,
+			Object: deployment(3, 900),
+		},
+		{
+			Name:              "OneDefault",
+			Plugin:            plugin,
+			Object:            deployment(3, 600),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/progressDeadlineSeconds"}]`,
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunRemoveContainerEnv(t *testing.T) {
+	env := func(names ...string) []interface{} {
+		vars := []interface{}{}
+		for _, name := range names {
+			vars = append(vars, map[string]interface{}{"name": name, "value": "value"})
+		}
+		return vars
+	}
+	podSpec := map[string]interface{}{
+		"containers": []interface{}{
+			map[string]interface{}{
+				"name": "app",
+				"env":  env("LOG_LEVEL", "KUBERNETES_SERVICE_HOST", "API_ENDPOINT", "KUBERNETES_SERVICE_HOST"),
+			},
+			map[string]interface{}{
+				"name": "sidecar",
+				"env":  env("API_ENDPOINT"),
+			},
+			map[string]interface{}{
+				"name": "no-env",
+			},
+		},
+		"initContainers": []interface{}{
+			map[string]interface{}{
+				"name": "init",
+				"env":  env("KUBERNETES_SERVICE_HOST", "LOG_LEVEL"),
+			},
+		},
+	}
+
+	withNodeName := func(spec map[string]interface{}) map[string]interface{} {
+		spec = runtime.DeepCopyJSON(spec)
+		spec["nodeName"] = "node-1"
+		return spec
+	}
+
+	cases := []struct {
+		Name              string
+		Object            *unstructured.Unstructured
+		PatchResponseJson string
+	}{
+		{
+			Name: "Deployment",
+			Object: newObject("apps/v1", "Deployment", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"spec": podSpec,
+					},
+				},
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/template/spec/containers/0/env/3"},
+{"op": "remove", "path": "/spec/template/spec/containers/0/env/2"},
+{"op": "remove", "path": "/spec/template/spec/containers/0/env/1"},
+{"op": "remove", "path": "/spec/template/spec/containers/1/env/0"},
+{"op": "remove", "path": "/spec/template/spec/initContainers/0/env/0"}]`,
+		},
+		{
+			Name: "Pod",
+			Object: newObject("v1", "Pod", map[string]interface{}{
+				"spec": withNodeName(podSpec),
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"},
+{"op": "remove", "path": "/spec/containers/0/env/3"},
+{"op": "remove", "path": "/spec/containers/0/env/2"},
+{"op": "remove", "path": "/spec/containers/0/env/1"},
+{"op": "remove", "path": "/spec/containers/1/env/0"},
+{"op": "remove", "path": "/spec/initContainers/0/env/0"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				RemoveContainerEnv: []string{"KUBERNETES_SERVICE_HOST", "API_ENDPOINT"},
+			}
+			_, object := runPlugin(t, p, c.Object, c.PatchResponseJson)
+
+			// The removals must apply in order, leaving the other variables.
+			patched, err := json.Marshal(object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(patched), "KUBERNETES_SERVICE_HOST") || strings.Contains(string(patched), "API_ENDPOINT") {
+				t.Errorf("environment variables not removed: %s", patched)
+			}
+			if strings.Count(string(patched), "LOG_LEVEL") != 2 {
+				t.Errorf("unexpected environment variables removed: %s", patched)
+			}
+		})
+	}
+}
+
+func TestRunRemoveTemplateNodeName(t *testing.T) {
+	workload := func(kind string, spec map[string]interface{}) *unstructured.Unstructured {
+		return newObject("apps/v1", kind, map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": spec,
+				},
+			},
+		})
+	}
+	containers := []interface{}{
+		map[string]interface{}{"name": "app", "image": "quay.io/app/frontend:1.0"},
+	}
+
+	cases := []pluginCase{
+		{
+			Name:              "DeploymentWithNodeName",
+			Object:            workload("Deployment", map[string]interface{}{"nodeName": "node-1", "containers": containers}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/template/spec/nodeName"}]`,
+		},
+		{
+			Name:   "StatefulSetWithoutNodeName",
+			Object: workload("StatefulSet", map[string]interface{}{"containers": containers}),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunRegisteredImagePaths(t *testing.T) {
+	gk := schema.GroupKind{Group: "example.com", Kind: "Database"}
+	types.RegisterImagePath(gk, []string{"/spec/image", "/spec/backup/images", "/spec/missing"})
+
+	database := newObject("example.com/v1", "Database", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"image": "quay.io/example/postgres:13",
+			"backup": map[string]interface{}{
+				"images": []interface{}{"quay.io/example/backup:1.0", "docker.io/library/busybox:latest"},
+			},
+		},
+	})
+	var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+		RegistryReplacement: map[string]string{"quay.io": "registry.example.com"},
+	}
+	runPlugin(t, p, database, `[{"op": "replace", "path": "/spec/image", "value": "registry.example.com/example/postgres:13"},
+{"op": "replace", "path": "/spec/backup/images/0", "value": "registry.example.com/example/backup:1.0"}]`)
+
+	// Other kinds with the same fields are left alone.
+	other := database.DeepCopy()
+	other.SetKind("Cache")
+	runPlugin(t, p, other, "")
+}
+
+func TestRunStripTopologyConstraints(t *testing.T) {
+	constraints := []interface{}{
+		map[string]interface{}{
+			"maxSkew":           int64(1),
+			"topologyKey":       "topology.kubernetes.io/zone",
+			"whenUnsatisfiable": "DoNotSchedule",
+		},
+	}
+
+	plugin := kubernetes.KubernetesTransformPlugin{
+		StripTopologyConstraints: true,
+	}
+
+	cases := []pluginCase{
+		{
+			Name:   "Pod",
+			Plugin: plugin,
+			Object: newObject("v1", "Pod", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"topologySpreadConstraints": constraints,
+				},
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/topologySpreadConstraints"}]`,
+		},
+		{
+			Name:   "Deployment",
+			Plugin: plugin,
+			Object: newObject("apps/v1", "Deployment", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"spec": map[string]interface{}{
+							"topologySpreadConstraints": constraints,
+						},
+					},
+				},
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/template/spec/topologySpreadConstraints"}]`,
+		},
+		{
+			Name:   "WithoutConstraints",
+			Plugin: plugin,
+			Object: newObject("apps/v1", "Deployment", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"spec": map[string]interface{}{},
+					},
+				},
+			}),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunDisableTransforms(t *testing.T) {
+	service := newObject("v1", "Service", map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      "frontend",
+			"namespace": "source",
+		},
+		"spec": map[string]interface{}{
+			"clusterIP": "172.30.12.4",
+		},
+	})
+	deploymentConfig := newObject("apps.openshift.io/v1", "DeploymentConfig", map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      "frontend",
+			"namespace": "source",
+		},
+		"spec": map[string]interface{}{
+			"triggers": []interface{}{
+				map[string]interface{}{
+					"type": "ImageChange",
+					"imageChangeParams": map[string]interface{}{
+						"from":               map[string]interface{}{"kind": "ImageStreamTag", "name": "frontend:latest", "namespace": "source"},
+						"lastTriggeredImage": "quay.io/konveyor/frontend:latest",
+					},
+				},
+			},
+		},
+	})
+	pod := newObject("v1", "Pod", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"nodeName": "node-1",
+		},
+	})
+
+	cases := []pluginCase{
+		{
+			Name:   "DisableServiceTransform",
+			Plugin: kubernetes.KubernetesTransformPlugin{NewNamespace: "destination", DisableServiceTransform: true},
+			Object: service,
+		},
+		{
+			Name:              "DisableServiceTransformKeepsNamespaceRewrite",
+			Plugin:            kubernetes.KubernetesTransformPlugin{NewNamespace: "destination", DisableServiceTransform: true},
+			Object:            deploymentConfig,
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/triggers/0/imageChangeParams/from/namespace", "value": "destination"}]`,
+		},
+		{
+			Name:              "DisableImageReplacement",
+			Plugin:            kubernetes.KubernetesTransformPlugin{NewNamespace: "destination", RegistryReplacement: map[string]string{"quay.io": "registry.example.com"}, DisableImageReplacement: true},
+			Object:            deploymentConfig,
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/triggers/0/imageChangeParams/from/namespace", "value": "destination"}]`,
+		},
+		{
+			Name:   "DisablePodFieldRemoval",
+			Plugin: kubernetes.KubernetesTransformPlugin{DisablePodFieldRemoval: true},
+			Object: pod,
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunRequireRegistryMatch(t *testing.T) {
+	cases := []struct {
+		Name                    string
+		Images                  []string
+		WarnUnmatchedRegistries bool
+		ShouldError             bool
+		PatchResponseJson       string
+		Warnings                []string
+	}{
+		{
+			Name:              "AllMatched",
+			Images:            []string{"quay.io/konveyor/frontend:1.0", "registry.example.com/konveyor/backend:1.0"},
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "registry.example.com/konveyor/frontend:1.0"}]`,
+		},
+		{
+			Name:        "PartiallyMatched",
+			Images:      []string{"quay.io/konveyor/frontend:1.0", "docker.io/library/nginx:latest", "nginx"},
+			ShouldError: true,
+		},
+		{
+			Name:                    "PartiallyMatchedWarnOnly",
+			Images:                  []string{"quay.io/konveyor/frontend:1.0", "docker.io/library/nginx:latest"},
+			WarnUnmatchedRegistries: true,
+			PatchResponseJson:       `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "registry.example.com/konveyor/frontend:1.0"}]`,
+			Warnings:                []string{"images of Deployment / match no RegistryReplacement rule: docker.io/library/nginx:latest"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement:     map[string]string{"quay.io": "registry.example.com"},
+				RequireRegistryMatch:    true,
+				WarnUnmatchedRegistries: c.WarnUnmatchedRegistries,
+			}
+			obj := deploymentWithImages(c.Images...)
+			resp, err := p.Run(obj.DeepCopy())
+			if (err != nil) != c.ShouldError {
+				t.Fatalf("Run() error = %v, ShouldError %v", err, c.ShouldError)
+			}
+			if err != nil {
+				for _, image := range []string{"docker.io/library/nginx:latest", "nginx"} {
+					if !strings.Contains(err.Error(), image) {
+						t.Errorf("expected the error to list %v, got %v", image, err)
+					}
+				}
+				if strings.Contains(err.Error(), "quay.io") {
+					t.Errorf("expected the error to only list unmatched images, got %v", err)
+				}
+				return
+			}
+			checkPatches(t, resp.Patches, c.PatchResponseJson)
+			applyPatches(t, obj, resp.Patches)
+			if !reflect.DeepEqual(resp.Warnings, c.Warnings) {
+				t.Errorf("Warnings = %q, want %q", resp.Warnings, c.Warnings)
+			}
+		})
+	}
+}
+
+func TestRunStripServiceAccountTokenVolumes(t *testing.T) {
+	mount := func(name string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "mountPath": "/mnt/" + name}
+	}
+	pod := newObject("v1", "Pod", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{
+					"name":         "app",
+					"volumeMounts": []interface{}{mount("data"), mount("kube-api-access-x7k2p")},
+				},
+				map[string]interface{}{
+					"name":         "sidecar",
+					"volumeMounts": []interface{}{mount("kube-api-access-x7k2p"), mount("config")},
+				},
+			},
+			"initContainers": []interface{}{
+				map[string]interface{}{
+					"name":         "init",
+					"volumeMounts": []interface{}{mount("default-token-abcde")},
+				},
+			},
+			"volumes": []interface{}{
+				map[string]interface{}{"name": "data", "emptyDir": map[string]interface{}{}},
+				map[string]interface{}{
+					"name": "kube-api-access-x7k2p",
+					"projected": map[string]interface{}{
+						"sources": []interface{}{
+							map[string]interface{}{
+								"serviceAccountToken": map[string]interface{}{"expirationSeconds": int64(3607), "path": "token"},
+							},
+						},
+					},
+				},
+				map[string]interface{}{"name": "config", "configMap": map[string]interface{}{"name": "app-config"}},
+				map[string]interface{}{"name": "default-token-abcde", "secret": map[string]interface{}{"secretName": "default-token-abcde"}},
+			},
+		},
+	})
+
+	var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+		StripServiceAccountTokenVolumes: true,
+	}
+	_, object := runPlugin(t, p, pod, `[{"op": "remove", "path": "/spec/containers/0/volumeMounts/1"},
+{"op": "remove", "path": "/spec/containers/1/volumeMounts/0"},
+{"op": "remove", "path": "/spec/initContainers/0/volumeMounts/0"},
+{"op": "remove", "path": "/spec/volumes/3"},
+{"op": "remove", "path": "/spec/volumes/1"}]`)
+
+	// The removals must apply in order, leaving the other volumes.
+	patched, err := json.Marshal(object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(patched), "kube-api-access-") || strings.Contains(string(patched), "default-token-") {
+		t.Errorf("service account token volumes not removed: %s", patched)
+	}
+	for _, name := range []string{`"data"`, `"config"`} {
+		if strings.Count(string(patched), name) != 2 {
+			t.Errorf("volume %v or its mount removed: %s", name, patched)
+		}
+	}
+}
+
+func TestRunSetImagePullPolicy(t *testing.T) {
+	deployment := newObject("apps/v1", "Deployment", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app", "imagePullPolicy": "IfNotPresent"},
+						map[string]interface{}{"name": "sidecar"},
+						map[string]interface{}{"name": "proxy", "imagePullPolicy": "Always"},
+					},
+					"initContainers": []interface{}{
+						map[string]interface{}{"name": "init", "imagePullPolicy": "Never"},
+					},
+				},
+			},
+		},
+	})
+
+	p, err := kubernetes.NewKubernetesTransformPlugin(kubernetes.KubernetesTransformPlugin{
+		SetImagePullPolicy: "Always",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runPlugin(t, p, deployment, `[{"op": "replace", "path": "/spec/template/spec/containers/0/imagePullPolicy", "value": "Always"},
+{"op": "add", "path": "/spec/template/spec/containers/1/imagePullPolicy", "value": "Always"},
+{"op": "replace", "path": "/spec/template/spec/initContainers/0/imagePullPolicy", "value": "Always"}]`)
+
+	if _, err := kubernetes.NewKubernetesTransformPlugin(kubernetes.KubernetesTransformPlugin{
+		SetImagePullPolicy: "Sometimes",
+	}); err == nil {
+		t.Error("expected an invalid SetImagePullPolicy to error")
+	}
+}
+
+func TestRunResourceOverride(t *testing.T) {
+	deployment := newObject("apps/v1", "Deployment", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app"},
+						map[string]interface{}{
+							"name": "sidecar",
+							"resources": map[string]interface{}{
+								"requests": map[string]interface{}{"cpu": "500m", "memory": "1Gi"},
+								"limits":   map[string]interface{}{"memory": "2Gi"},
+							},
+						},
+						map[string]interface{}{
+							"name":      "proxy",
+							"resources": map[string]interface{}{},
+						},
+					},
+					"initContainers": []interface{}{
+						map[string]interface{}{
+							"name": "init",
+							"resources": map[string]interface{}{
+								"requests": map[string]interface{}{"cpu": "100m", "memory": "128Mi"},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	cases := []struct {
+		Name              string
+		ResourceOverride  []kubernetes.ContainerResourceOverride
+		PatchResponseJson string
+	}{
+		{
+			Name: "Wildcard",
+			ResourceOverride: []kubernetes.ContainerResourceOverride{
+				{Container: "*", Requests: map[string]string{"cpu": "100m", "memory": "128Mi"}},
+			},
+			PatchResponseJson: `[{"op": "add", "path": "/spec/template/spec/containers/0/resources", "value": {"requests": {"cpu": "100m", "memory": "128Mi"}}},
+{"op": "replace", "path": "/spec/template/spec/containers/1/resources/requests/cpu", "value": "100m"},
+{"op": "replace", "path": "/spec/template/spec/containers/1/resources/requests/memory", "value": "128Mi"},
+{"op": "add", "path": "/spec/template/spec/containers/2/resources/requests", "value": {"cpu": "100m", "memory": "128Mi"}}]`,
+		},
+		{
+			Name: "NamedOverWildcard",
+			ResourceOverride: []kubernetes.ContainerResourceOverride{
+				{Container: "sidecar", Requests: map[string]string{"cpu": "50m"}, Limits: map[string]string{"memory": "256Mi"}},
+				{Container: "*", Requests: map[string]string{"cpu": "100m", "memory": "128Mi"}},
+			},
+			PatchResponseJson: `[{"op": "add", "path": "/spec/template/spec/containers/0/resources", "value": {"requests": {"cpu": "100m", "memory": "128Mi"}}},
+{"op": "replace", "path": "/spec/template/spec/containers/1/resources/requests/cpu", "value": "50m"},
+{"op": "replace", "path": "/spec/template/spec/containers/1/resources/requests/memory", "value": "128Mi"},
+{"op": "replace", "path": "/spec/template/spec/containers/1/resources/limits/memory", "value": "256Mi"},
+{"op": "add", "path": "/spec/template/spec/containers/2/resources/requests", "value": {"cpu": "100m", "memory": "128Mi"}}]`,
+		},
+		{
+			Name: "Named",
+			ResourceOverride: []kubernetes.ContainerResourceOverride{
+				{Container: "app", Requests: map[string]string{"cpu": "250m"}, Limits: map[string]string{"cpu": "1"}},
+				{Container: "init", Limits: map[string]string{"memory": "256Mi"}},
+			},
+			PatchResponseJson: `[{"op": "add", "path": "/spec/template/spec/containers/0/resources", "value": {"requests": {"cpu": "250m"}}},
+{"op": "add", "path": "/spec/template/spec/containers/0/resources/limits", "value": {"cpu": "1"}},
+{"op": "add", "path": "/spec/template/spec/initContainers/0/resources/limits", "value": {"memory": "256Mi"}}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			p, err := kubernetes.NewKubernetesTransformPlugin(kubernetes.KubernetesTransformPlugin{
+				ResourceOverride: c.ResourceOverride,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			runPlugin(t, p, deployment, c.PatchResponseJson)
+		})
+	}
+
+	malformed := kubernetes.KubernetesTransformPlugin{
+		ResourceOverride: []kubernetes.ContainerResourceOverride{
+			{Container: "*", Requests: map[string]string{"cpu": "lots"}},
+		},
+	}
+	if _, err := kubernetes.NewKubernetesTransformPlugin(malformed); err == nil {
+		t.Error("expected a malformed quantity to be rejected")
+	}
+	if _, err := malformed.Run(deployment); err == nil {
+		t.Error("expected running with a malformed quantity to error")
+	}
+}
+
+func TestRunUnhandled(t *testing.T) {
+	cases := []struct {
+		Name                string
+		Object              *unstructured.Unstructured
+		IngressClassMapping map[string]string
+		Unhandled           bool
+	}{
+		{
+			Name: "NoTransformApplies",
+			Object: newObject("v1", "ConfigMap", map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name": "settings",
+				},
+				"data": map[string]interface{}{
+					"key": "value",
+				},
+			}),
+			Unhandled: true,
+		},
+		{
+			Name: "Transformed",
+			Object: newObject("v1", "Service", map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name": "frontend",
+				},
+				"spec": map[string]interface{}{
+					"clusterIP": "172.30.12.4",
+				},
+			}),
+		},
+		{
+			Name: "RecognizedKindWithoutChange",
+			Object: newObject("v1", "Service", map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name": "frontend-headless",
+				},
+				"spec": map[string]interface{}{
+					"clusterIP": "None",
+				},
+			}),
+		},
+		{
+			Name: "AlreadyTransformedDeployment",
+			Object: newObject("apps/v1", "Deployment", map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name": "frontend",
+				},
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"spec": map[string]interface{}{
+							"containers": []interface{}{
+								map[string]interface{}{"name": "web", "image": "registry.example.com/shop/web:1.0"},
+							},
+						},
+					},
+				},
+			}),
+		},
+		{
+			Name: "KindWithoutConfiguredTransform",
+			Object: newObject("networking.k8s.io/v1", "Ingress", map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name": "frontend",
+				},
+			}),
+			Unhandled: true,
+		},
+		{
+			Name: "KindWithConfiguredTransform",
+			Object: newObject("networking.k8s.io/v1", "Ingress", map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name": "frontend",
+				},
+			}),
+			IngressClassMapping: map[string]string{"nginx": "openshift-default"},
+		},
+		{
+			Name:   "WhitedOut",
+			Object: newObject("v1", "Endpoints", nil),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				IngressClassMapping: c.IngressClassMapping,
+			}
+			resp, err := p.Run(c.Object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Unhandled != c.Unhandled {
+				t.Errorf("Unhandled = %v, want %v", resp.Unhandled, c.Unhandled)
+			}
+		})
+	}
+}
+
+func TestRunPVCDataSource(t *testing.T) {
+	snapshotRef := func() map[string]interface{} {
+		return map[string]interface{}{
+			"apiGroup": "snapshot.storage.k8s.io",
+			"kind":     "VolumeSnapshot",
+			"name":     "data-snapshot",
+		}
+	}
+	pvc := newObject("v1", "PersistentVolumeClaim", map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      "data-restored",
+			"namespace": "test",
+		},
+		"spec": map[string]interface{}{
+			"accessModes":   []interface{}{"ReadWriteOnce"},
+			"dataSource":    snapshotRef(),
+			"dataSourceRef": snapshotRef(),
+		},
+	})
+
+	cases := []struct {
+		Name                 string
+		PVCDataSourceMapping map[string]string
+		PatchResponseJson    string
+	}{
+		{
+			Name: "Removed",
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/dataSource"},
+{"op": "remove", "path": "/spec/dataSourceRef"}]`,
+		},
+		{
+			Name:                 "Remapped",
+			PVCDataSourceMapping: map[string]string{"data-snapshot": "data-snapshot-migrated"},
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/dataSource/name", "value": "data-snapshot-migrated"},
+{"op": "replace", "path": "/spec/dataSourceRef/name", "value": "data-snapshot-migrated"}]`,
+		},
+		{
+			Name:                 "MappedToItself",
+			PVCDataSourceMapping: map[string]string{"data-snapshot": "data-snapshot"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				TransformPVCsInline:  true,
+				PVCDataSourceMapping: c.PVCDataSourceMapping,
+			}
+			runPlugin(t, p, pvc, c.PatchResponseJson)
+		})
+	}
+}
+
+func TestRunRegisteredPodSpecableKind(t *testing.T) {
+	types.RegisterPodSpecableKind(schema.GroupKind{Group: "argoproj.io", Kind: "Rollout"}, "/spec/template")
+	types.RegisterPodSpecableKind(schema.GroupKind{Group: "keda.sh", Kind: "ScaledJob"}, "/spec/jobTargetRef/template")
+
+	template := func() map[string]interface{} {
+		return map[string]interface{}{
+			"spec": map[string]interface{}{
+				"hostNetwork": true,
+				"containers": []interface{}{
+					map[string]interface{}{"name": "app", "image": "quay.io/app/api:1.0"},
+				},
+			},
+		}
+	}
+
+	plugin := kubernetes.KubernetesTransformPlugin{
+		RegistryReplacement: map[string]string{"quay.io": "registry.example.com"},
+		ClearHostNetworking: true,
+	}
+
+	cases := []pluginCase{
+		{
+			Name:   "Rollout",
+			Plugin: plugin,
+			Object: newObject("argoproj.io/v1alpha1", "Rollout", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"template": template(),
+				},
+			}),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "registry.example.com/app/api:1.0"},
+{"op": "remove", "path": "/spec/template/spec/hostNetwork"}]`,
+		},
+		{
+			Name:   "ScaledJob",
+			Plugin: plugin,
+			Object: newObject("keda.sh/v1alpha1", "ScaledJob", map[string]interface{}{
+				"spec": map[string]interface{}{
+					"jobTargetRef": map[string]interface{}{
+						"template": template(),
+					},
+				},
+			}),
+			PatchResponseJson: `[{"op": "replace", "path": "/spec/jobTargetRef/template/spec/containers/0/image", "value": "registry.example.com/app/api:1.0"},
+{"op": "remove", "path": "/spec/jobTargetRef/template/spec/hostNetwork"}]`,
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunStripKubectlAnnotations(t *testing.T) {
+	plugin := kubernetes.KubernetesTransformPlugin{
+		StripKubectlAnnotations: true,
+	}
+
+	cases := []pluginCase{
+		{
+			Name:   "WithKubectlAnnotations",
+			Plugin: plugin,
+			Object: annotatedObject("v1", "ConfigMap", "settings", map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": `{"apiVersion":"v1","kind":"ConfigMap"}`,
+				"kubernetes.io/change-cause":                       "kubectl apply --record",
+				"team":                                             "payments",
+			}),
+			PatchResponseJson: `[{"op": "remove", "path": "/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration"},
+{"op": "remove", "path": "/metadata/annotations/kubernetes.io~1change-cause"}]`,
+		},
+		{
+			Name:   "WithoutKubectlAnnotations",
+			Plugin: plugin,
+			Object: annotatedObject("v1", "ConfigMap", "settings", map[string]interface{}{
+				"team": "payments",
+			}),
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestWillWhiteOut(t *testing.T) {
+	object := func(apiVersion, kind string) unstructured.Unstructured {
+		return unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"kind":       kind,
+				"apiVersion": apiVersion,
+				"metadata": map[string]interface{}{
+					"name": "test",
+					"labels": map[string]interface{}{
+						"team": "payments",
+					},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		Name       string
+		Plugin     kubernetes.KubernetesTransformPlugin
+		Object     unstructured.Unstructured
+		IsWhiteOut bool
+		Reason     string
+	}{
+		{
+			Name:       "Endpoints",
+			Object:     object("v1", "Endpoints"),
+			IsWhiteOut: true,
+			Reason:     "Endpoints auto-generated",
+		},
+		{
+			Name:       "EndpointSlice",
+			Object:     object("discovery.k8s.io/v1", "EndpointSlice"),
+			IsWhiteOut: true,
+			Reason:     "EndpointSlice auto-generated",
+		},
+		{
+			Name:       "PersistentVolumeClaim",
+			Object:     object("v1", "PersistentVolumeClaim"),
+			IsWhiteOut: true,
+			Reason:     "PVC handled separately",
+		},
+		{
+			Name:   "PersistentVolumeClaimInline",
+			Plugin: kubernetes.KubernetesTransformPlugin{TransformPVCsInline: true},
+			Object: object("v1", "PersistentVolumeClaim"),
+		},
+		{
+			Name:   "Service",
+			Object: object("v1", "Service"),
+		},
+		{
+			Name: "Predicate",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				WhiteoutPredicate: func(obj unstructured.Unstructured) (bool, string) {
+					return obj.GetKind() == "Secret", "secrets are migrated separately"
+				},
+			},
+			Object:     object("v1", "Secret"),
+			IsWhiteOut: true,
+			Reason:     "secrets are migrated separately",
+		},
+		{
+			Name:   "NotSelected",
+			Plugin: kubernetes.KubernetesTransformPlugin{LabelSelector: "team=billing"},
+			Object: object("v1", "Endpoints"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			isWhiteOut, reason := c.Plugin.WillWhiteOut(c.Object)
+			if isWhiteOut != c.IsWhiteOut || reason != c.Reason {
+				t.Errorf("WillWhiteOut() = %v, %q, want %v, %q", isWhiteOut, reason, c.IsWhiteOut, c.Reason)
+			}
+
+			// Run must agree with WillWhiteOut.
+			obj := c.Object.DeepCopy()
+			resp, err := c.Plugin.Run(obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.IsWhiteOut != isWhiteOut || resp.WhiteOutReason != reason {
+				t.Errorf("Run() whiteout = %v, %q, WillWhiteOut() = %v, %q", resp.IsWhiteOut, resp.WhiteOutReason, isWhiteOut, reason)
+			}
+		})
+	}
+}
+
+func TestRunTransformEndpointSlices(t *testing.T) {
+	slice := newObject("discovery.k8s.io/v1beta1", "EndpointSlice", map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      "database-manual",
+			"namespace": "source",
+			"labels": map[string]interface{}{
+				"kubernetes.io/service-name": "database",
+			},
+			"ownerReferences": []interface{}{
+				map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "Service",
+					"name":       "database",
+					"uid":        "0f2e8d3b-5c5e-4e6f-8a9b-1c2d3e4f5a6b",
+				},
+			},
+		},
+		"addressType": "IPv4",
+		"endpoints": []interface{}{
+			map[string]interface{}{
+				"addresses": []interface{}{"10.0.0.12"},
+				"targetRef": map[string]interface{}{
+					"kind":      "Pod",
+					"name":      "database-0",
+					"namespace": "source",
+				},
+			},
+			map[string]interface{}{
+				"addresses": []interface{}{"10.0.0.13"},
+				"targetRef": map[string]interface{}{
+					"kind":      "Pod",
+					"name":      "replica-0",
+					"namespace": "shared",
+				},
+			},
+		},
+	})
+
+	cases := []struct {
+		Name                    string
+		TransformEndpointSlices bool
+		NewNamespace            string
+		IsWhiteOut              bool
+		PatchResponseJson       string
+	}{
+		{
+			Name:       "DefaultWhiteOut",
+			IsWhiteOut: true,
+		},
+		{
+			Name:                    "Transformed",
+			TransformEndpointSlices: true,
+			PatchResponseJson:       `[{"op": "remove", "path": "/metadata/ownerReferences"}]`,
+		},
+		{
+			Name:                    "TransformedToNewNamespace",
+			TransformEndpointSlices: true,
+			NewNamespace:            "destination",
+			PatchResponseJson: `[{"op": "remove", "path": "/metadata/ownerReferences"},
+{"op": "replace", "path": "/endpoints/0/targetRef/namespace", "value": "destination"}]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				TransformEndpointSlices: c.TransformEndpointSlices,
+				NewNamespace:            c.NewNamespace,
+			}
+			resp, _ := runPlugin(t, p, slice, c.PatchResponseJson)
+			if resp.IsWhiteOut != c.IsWhiteOut {
+				t.Errorf("Invalid white out determination. Actual: %v, Expected: %v", resp.IsWhiteOut, c.IsWhiteOut)
+			}
+		})
+	}
+}
+
+func TestRunTwice(t *testing.T) {
+	objects := []*unstructured.Unstructured{
+		{
+			Object: map[string]interface{}{
+				"kind":       "Deployment",
+				"apiVersion": "apps/v1",
+				"metadata": map[string]interface{}{
+					"name":      "frontend",
+					"namespace": "source",
+					"annotations": map[string]interface{}{
+						"kubectl.kubernetes.io/last-applied-configuration": "{}",
+					},
+				},
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"spec": map[string]interface{}{
+							"containers": []interface{}{
+								map[string]interface{}{"name": "app", "image": "quay.io/app/frontend:1.0"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			Object: map[string]interface{}{
+				"kind":       "Pod",
+				"apiVersion": "v1",
+				"metadata": map[string]interface{}{
+					"name":      "frontend-0",
+					"namespace": "source",
+					"annotations": map[string]interface{}{
+						"openshift.io/scc": "restricted",
+					},
+				},
+				"spec": map[string]interface{}{
+					"nodeName": "node-1",
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app", "image": "quay.io/app/frontend:1.0"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, consolidate := range []bool{false, true} {
+		for _, obj := range objects {
+			t.Run(fmt.Sprintf("%v/ConsolidateAnnotations=%v", obj.GetKind(), consolidate), func(t *testing.T) {
+				var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+					AddedAnnotations:       map[string]string{"example.com/migrated-from": "%NAMESPACE%"},
+					ConsolidateAnnotations: consolidate,
+					RegistryReplacement:    map[string]string{"quay.io": "registry.example.com"},
+					RemoveAnnotation:       []string{"kubectl.kubernetes.io/last-applied-configuration"},
+				}
+				resp, err := p.Run(obj.DeepCopy())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(resp.Patches) == 0 {
+					t.Fatal("expected the first run to transform the object")
+				}
+				transformed := &unstructured.Unstructured{Object: applyPatches(t, obj, resp.Patches)}
+
+				resp, err = p.Run(transformed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(resp.Patches) != 0 {
+					t.Errorf("expected the second run to be a no-op, got %v", resp.Patches)
+				}
+			})
+		}
+	}
+}
+
+func TestNewKubernetesTransformPluginFromJSON(t *testing.T) {
+	object := func() *unstructured.Unstructured {
+		return newObject("apps/v1", "Deployment", map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":      "frontend",
+				"namespace": "source",
+				"annotations": map[string]interface{}{
+					"kubectl.kubernetes.io/last-applied-configuration": "{}",
+				},
+			},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{"image": "quay.io/konveyor/app:v1"},
+						},
+					},
+				},
+			},
+		})
+	}
+	structured := kubernetes.KubernetesTransformPlugin{
+		AddedAnnotations:    map[string]string{"example.com/migrated-from": "%NAMESPACE%"},
+		RegistryReplacement: map[string]string{"quay.io": "registry.example.com:5000"},
+		NewNamespace:        "destination",
+		RemoveAnnotation:    []string{"kubectl.kubernetes.io/last-applied-configuration"},
+		SafeReplace:         true,
+	}
+
+	cases := []struct {
+		Name        string
+		Config      string
+		ShouldError bool
+	}{
+		{
+			Name: "ValidConfig",
+			Config: `{
+	"addedAnnotations": {"example.com/migrated-from": "%NAMESPACE%"},
+	"registryReplacement": {"quay.io": "registry.example.com:5000"},
+	"newNamespace": "destination",
+	"removeAnnotation": ["kubectl.kubernetes.io/last-applied-configuration"],
+	"safeReplace": true
+}`,
+		},
+		{
+			Name:        "UnknownOption",
+			Config:      `{"newNamespaces": "destination"}`,
+			ShouldError: true,
+		},
+		{
+			Name:        "InvalidOption",
+			Config:      `{"newNamespace": "Not_A_Namespace"}`,
+			ShouldError: true,
+		},
+		{
+			Name:        "InvalidJSON",
+			Config:      `{"newNamespace": `,
+			ShouldError: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			p, err := kubernetes.NewKubernetesTransformPluginFromJSON([]byte(c.Config))
+			if (err != nil) != c.ShouldError {
+				t.Fatalf("NewKubernetesTransformPluginFromJSON() error = %v, ShouldError %v", err, c.ShouldError)
+			}
+			if c.ShouldError {
+				return
+			}
+			resp, err := p.Run(object())
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := structured.Run(object())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(expected.Patches) == 0 {
+				t.Fatal("expected the configuration to produce patches")
+			}
+			if !reflect.DeepEqual(resp, expected) {
+				t.Errorf("JSON configuration output %v does not match the structured configuration output %v", resp, expected)
+			}
+		})
+	}
+}
+
+func TestRunLabelSelector(t *testing.T) {
+	service := func(labels map[string]interface{}) *unstructured.Unstructured {
+		return newObject("v1", "Service", map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":   "frontend",
+				"labels": labels,
+			},
+			"spec": map[string]interface{}{
+				"clusterIP": "172.30.12.4",
+			},
+		})
+	}
+
+	cases := []struct {
+		Name              string
+		Object            *unstructured.Unstructured
+		LabelSelector     string
+		IsWhiteOut        bool
+		PatchResponseJson string
+		ShouldError       bool
+	}{
+		{
+			Name:              "Matching",
+			Object:            service(map[string]interface{}{"team": "payments"}),
+			LabelSelector:     "team=payments",
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/clusterIP"}]`,
+		},
+		{
+			Name:          "NotMatching",
+			Object:        service(map[string]interface{}{"team": "billing"}),
+			LabelSelector: "team=payments",
+		},
+		{
+			Name:          "NotMatchingWhiteOut",
+			Object:        newObject("v1", "Endpoints", nil),
+			LabelSelector: "team=payments",
+		},
+		{
+			Name:          "InvalidSelector",
+			Object:        service(nil),
+			LabelSelector: "team in (payments",
+			ShouldError:   true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				LabelSelector: c.LabelSelector,
+			}
+			resp, err := p.Run(c.Object.DeepCopy())
+			if (err != nil) != c.ShouldError {
+				t.Fatalf("unexpected error: %v, ShouldError: %v", err, c.ShouldError)
+			}
+			if resp.IsWhiteOut != c.IsWhiteOut {
+				t.Errorf("Invalid white out determination. Actual: %v, Expected: %v", resp.IsWhiteOut, c.IsWhiteOut)
+			}
+			checkPatches(t, resp.Patches, c.PatchResponseJson)
+			applyPatches(t, c.Object, resp.Patches)
+		})
+	}
+}
+
+func TestRunRemoveWorkloadStatus(t *testing.T) {
+	statefulSet := func() *unstructured.Unstructured {
+		return newObject("apps/v1", "StatefulSet", map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name": "db",
+			},
+			"spec": map[string]interface{}{
+				"serviceName": "db",
+				"volumeClaimTemplates": []interface{}{
+					map[string]interface{}{
+						"metadata": map[string]interface{}{"name": "data"},
+						"status":   map[string]interface{}{"phase": "Pending"},
+					},
+					map[string]interface{}{
+						"metadata": map[string]interface{}{"name": "logs"},
+					},
+				},
+			},
+			"status": map[string]interface{}{
+				"collisionCount": int64(1),
+				"replicas":       int64(3),
+			},
+		})
+	}
+	daemonSet := func() *unstructured.Unstructured {
+		return newObject("apps/v1", "DaemonSet", map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name": "agent",
+			},
+			"status": map[string]interface{}{
+				"numberReady": int64(3),
+			},
+		})
+	}
+
+	cases := []struct {
+		Name                    string
+		Object                  *unstructured.Unstructured
+		RemoveStatefulSetStatus bool
+		RemoveDaemonSetStatus   bool
+		PatchResponseJson       string
+	}{
+		{
+			Name:                    "StatefulSet",
+			Object:                  statefulSet(),
+			RemoveStatefulSetStatus: true,
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/volumeClaimTemplates/0/status"},
+{"op": "remove", "path": "/status"}]`,
+		},
+		{
+			Name:                  "StatefulSetNotRequested",
+			Object:                statefulSet(),
+			RemoveDaemonSetStatus: true,
+		},
+		{
+			Name:                  "DaemonSet",
+			Object:                daemonSet(),
+			RemoveDaemonSetStatus: true,
+			PatchResponseJson:     `[{"op": "remove", "path": "/status"}]`,
+		},
+		{
+			Name:                    "DaemonSetNotRequested",
+			Object:                  daemonSet(),
+			RemoveStatefulSetStatus: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				RemoveStatefulSetStatus: c.RemoveStatefulSetStatus,
+				RemoveDaemonSetStatus:   c.RemoveDaemonSetStatus,
+			}
+			_, patched := runPlugin(t, p, c.Object, c.PatchResponseJson)
+			if serviceName, _, _ := unstructured.NestedString(patched, "spec", "serviceName"); c.Object.GetKind() == "StatefulSet" && serviceName != "db" {
+				t.Errorf("expected serviceName to be kept, got: %q", serviceName)
+			}
+		})
+	}
+}
+
+func TestRunClearHostNetworking(t *testing.T) {
+	pod := newObject("v1", "Pod", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"nodeName":    "node-1",
+			"hostNetwork": true,
+			"hostPID":     true,
+			"containers": []interface{}{
+				map[string]interface{}{"image": "quay.io/konveyor/agent:v1"},
+			},
+		},
+	})
+	deployment := deploymentWithImages("quay.io/konveyor/app:v1", "quay.io/konveyor/proxy:v1")
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	containers[1].(map[string]interface{})["ports"] = []interface{}{
+		map[string]interface{}{"containerPort": int64(8080)},
+		map[string]interface{}{"containerPort": int64(8443), "hostPort": int64(443)},
+	}
+	if err := unstructured.SetNestedSlice(deployment.Object, containers, "spec", "template", "spec", "containers"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []pluginCase{
+		{
+			Name:   "HostNetworkPod",
+			Plugin: kubernetes.KubernetesTransformPlugin{ClearHostNetworking: true},
+			Object: pod,
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"}, {"op": "remove", "path": "/spec/hostNetwork"},
+{"op": "remove", "path": "/spec/hostPID"}]`,
+		},
+		{
+			Name:              "WorkloadHostPort",
+			Plugin:            kubernetes.KubernetesTransformPlugin{ClearHostNetworking: true},
+			Object:            deployment,
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/template/spec/containers/1/ports/1/hostPort"}]`,
+		},
+		{
+			Name:              "NotRequested",
+			Object:            pod,
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/nodeName"}]`,
+		},
+	}
+
+	runPluginCases(t, cases)
+}
+
+func TestRunWhiteoutPredicate(t *testing.T) {
+	predicate := func(obj unstructured.Unstructured) (bool, string) {
+		if obj.GetAnnotations()["example.com/skip-migration"] == "true" {
+			return true, "skip-migration annotation set"
+		}
+		return false, ""
+	}
+
+	cases := []struct {
+		Name           string
+		Object         *unstructured.Unstructured
+		IsWhiteOut     bool
+		WhiteOutReason string
+	}{
+		{
+			Name:           "Annotated",
+			Object:         annotatedObject("v1", "ConfigMap", "test", map[string]interface{}{"example.com/skip-migration": "true"}),
+			IsWhiteOut:     true,
+			WhiteOutReason: "skip-migration annotation set",
+		},
+		{
+			Name:   "NotAnnotated",
+			Object: annotatedObject("v1", "ConfigMap", "test", map[string]interface{}{"example.com/owner": "team-a"}),
+		},
+		{
+			Name:           "BuiltInRuleTakesPrecedence",
+			Object:         annotatedObject("v1", "Endpoints", "test", map[string]interface{}{"example.com/skip-migration": "true"}),
+			IsWhiteOut:     true,
+			WhiteOutReason: "Endpoints auto-generated",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				WhiteoutPredicate: predicate,
+			}
+			resp, err := p.Run(c.Object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.IsWhiteOut != c.IsWhiteOut {
+				t.Errorf("Invalid white out determination. Actual: %v, Expected: %v", resp.IsWhiteOut, c.IsWhiteOut)
+			}
+			if resp.WhiteOutReason != c.WhiteOutReason {
+				t.Errorf("Invalid whiteout reason. Actual: %v, Expected: %v", resp.WhiteOutReason, c.WhiteOutReason)
+			}
+			if c.IsWhiteOut && len(resp.Patches) != 0 {
+				t.Errorf("expected no patches for a whited out object, got: %v", resp.Patches)
+			}
+		})
+	}
+}
+
+func TestRunStripPVCVolumeName(t *testing.T) {
+	pvc := func(volumeName string) *unstructured.Unstructured {
+		spec := map[string]interface{}{
+			"accessModes": []interface{}{"ReadWriteOnce"},
+		}
+		if volumeName != "" {
+			spec["volumeName"] = volumeName
+		}
+		return newObject("v1", "PersistentVolumeClaim", map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name": "data",
+				"annotations": map[string]interface{}{
+					"pv.kubernetes.io/bind-completed": "yes",
+				},
+			},
+			"spec": spec,
+		})
+	}
+
+	cases := []struct {
+		Name              string
+		Object            *unstructured.Unstructured
+		PatchResponseJson string
+	}{
+		{
+			Name:              "Bound",
+			Object:            pvc("pvc-0f2e8d3b"),
+			PatchResponseJson: `[{"op": "remove", "path": "/spec/volumeName"}]`,
+		},
+		{
+			Name:   "WithoutVolumeName",
+			Object: pvc(""),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var p transform.Plugin = &kubernetes.KubernetesTransformPlugin{
+				StripPVCVolumeName: true,
+			}
+			resp, _ := runPlugin(t, p, c.Object, c.PatchResponseJson)
+			if resp.IsWhiteOut {
+				t.Error("expected the PVC not to be whited out")
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RunList transforms each item of a list, such as a v1 List, independently
+// and returns the list rebuilt from the transformed items, in their original
+// order. Whited out items are dropped. Like RunAll, the returned error
+// aggregates the errors of all items, and the list is only returned when
+// every item succeeded.
+func (r *Runner) RunList(list unstructured.Unstructured, plugins []Plugin) (unstructured.Unstructured, error) {
+	if !isList(list) {
+		return unstructured.Unstructured{}, fmt.Errorf("%v is not a list", list.GetKind())
+	}
+	items := []unstructured.Unstructured{}
+	for i, item := range list.Object["items"].([]interface{}) {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return unstructured.Unstructured{}, fmt.Errorf("item %v of the list is not an object", i)
+		}
+		items = append(items, unstructured.Unstructured{Object: object})
+	}
+
+	results, err := r.RunAll(items, plugins)
+	if err != nil {
+		return unstructured.Unstructured{}, err
+	}
+	transformed := []interface{}{}
+	for i, result := range results {
+		if result.IsWhiteOut {
+			continue
+		}
+		item := items[i].DeepCopy()
+		if len(result.Patches) > 0 {
+			b, err := applyPatch(items[i], result.Patches)
+			if err != nil {
+				return unstructured.Unstructured{}, err
+			}
+			if err := item.UnmarshalJSON(b); err != nil {
+				return unstructured.Unstructured{}, err
+			}
+		}
+		transformed = append(transformed, item.Object)
+	}
+
+	rebuilt := list.DeepCopy()
+	rebuilt.Object["items"] = transformed
+	return *rebuilt, nil
+}
+
+// isList reports whether the object is a list kind holding its objects in
+// items, such as a v1 List or a DeploymentList.
+func isList(u unstructured.Unstructured) bool {
+	return strings.HasSuffix(u.GetKind(), "List") && u.IsList()
+}
@@ -0,0 +1,29 @@
+package transform
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Observer is notified by the Runner as it processes objects, e.g. to record
+// metrics. Plugins are identified by their String method when they implement
+// fmt.Stringer, otherwise by their type.
+type Observer interface {
+	// OnPluginStart is called before a plugin is run.
+	OnPluginStart(name string)
+	// OnPluginEnd is called after a plugin has run, with the time it took
+	// and the error it returned.
+	OnPluginEnd(name string, duration time.Duration, err error)
+	// OnObjectDone is called once all plugins have run against an object.
+	OnObjectDone(gvk schema.GroupVersionKind, isWhiteOut bool)
+}
+
+// pluginName identifies a plugin in observer callbacks and errors.
+func pluginName(plugin Plugin) string {
+	if s, ok := plugin.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", plugin)
+}
@@ -1,8 +1,13 @@
 package transform
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	jsonpatch "github.com/evanphx/json-patch"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type Plugin interface {
@@ -10,8 +15,99 @@ type Plugin interface {
 	Run(*unstructured.Unstructured) (PluginResponse, error)
 }
 
+// ContextPlugin is implemented by plugins that can abort a run when its
+// context is cancelled, such as plugins running an external process.
+type ContextPlugin interface {
+	Plugin
+	RunContext(context.Context, *unstructured.Unstructured) (PluginResponse, error)
+}
+
+// PriorityPlugin is implemented by plugins that must run before or after
+// other plugins, e.g. a namespace rewrite that references are rewritten
+// against. The Runner runs plugins with a higher priority first. Plugins not
+// implementing it have priority 0.
+type PriorityPlugin interface {
+	Plugin
+	Priority() int
+}
+
+// ScopedPlugin is implemented by plugins that only transform objects of some
+// GroupKinds. The Runner does not run them, e.g. does not start the process
+// of a binary plugin, against objects AppliesTo returns false for.
+type ScopedPlugin interface {
+	Plugin
+	AppliesTo(schema.GroupKind) bool
+}
+
 type PluginResponse struct {
-	Version    string          `json:"version,omitempty"`
-	IsWhiteOut bool            `json:"isWhiteOut,omitempty"`
-	Patches    jsonpatch.Patch `json:"patches,omitempty"`
+	Version    string `json:"version,omitempty"`
+	IsWhiteOut bool   `json:"isWhiteOut,omitempty"`
+	// WhiteOutReason optionally describes why the object is whited out.
+	WhiteOutReason string          `json:"whiteOutReason,omitempty"`
+	Patches        jsonpatch.Patch `json:"patches,omitempty"`
+	// Reasons optionally explains the patches, Reasons[i] describes why
+	// Patches[i] was emitted.
+	Reasons []string `json:"reasons,omitempty"`
+	// Unhandled reports that the plugin has no transform for the object, as
+	// opposed to transforming it without needing any change, so callers
+	// can report which objects the plugins cover.
+	Unhandled bool `json:"unhandled,omitempty"`
+	// Warnings report conditions worth the user's attention that do not
+	// prevent the plugin from transforming the object.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Merge combines the response with other, as if a single plugin had emitted
+// both: the patches of other are appended, the object is whited out if either
+// response whites it out, white out reasons are joined, the union of the
+// warnings is kept in the order they are first seen, and the object is only unhandled when neither response handles
+// it. Responses with different versions can not be merged, an empty version
+// takes the version of the other response.
+func (p PluginResponse) Merge(other PluginResponse) (PluginResponse, error) {
+	merged := PluginResponse{
+		Version:    p.Version,
+		IsWhiteOut: p.IsWhiteOut || other.IsWhiteOut,
+		Unhandled:  p.Unhandled && other.Unhandled,
+	}
+	if merged.Version == "" {
+		merged.Version = other.Version
+	} else if other.Version != "" && other.Version != p.Version {
+		return PluginResponse{}, fmt.Errorf("unable to merge responses with versions %q and %q", p.Version, other.Version)
+	}
+
+	whiteOutReasons := []string{}
+	for _, reason := range []string{p.WhiteOutReason, other.WhiteOutReason} {
+		if reason != "" {
+			whiteOutReasons = append(whiteOutReasons, reason)
+		}
+	}
+	merged.WhiteOutReason = strings.Join(whiteOutReasons, "; ")
+
+	merged.Patches = append(append(jsonpatch.Patch{}, p.Patches...), other.Patches...)
+	if len(merged.Patches) == 0 {
+		merged.Patches = nil
+	}
+	seen := map[string]bool{}
+	for _, warning := range append(append([]string{}, p.Warnings...), other.Warnings...) {
+		if seen[warning] {
+			continue
+		}
+		seen[warning] = true
+		merged.Warnings = append(merged.Warnings, warning)
+	}
+	// Reasons are kept aligned with the patches, padding with empty reasons
+	// for the patches that were not explained.
+	if len(p.Reasons) > 0 || len(other.Reasons) > 0 {
+		merged.Reasons = make([]string, len(merged.Patches))
+		copy(merged.Reasons, p.Reasons)
+		copy(merged.Reasons[len(p.Patches):], other.Reasons)
+	}
+	return merged, nil
+}
+
+// ExplainedOperation is a patch operation along with the reason the plugin
+// that emitted it gave for it.
+type ExplainedOperation struct {
+	Operation jsonpatch.Operation `json:"operation"`
+	Reason    string              `json:"reason,omitempty"`
 }
@@ -0,0 +1,98 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+func TestPluginResponseMerge(t *testing.T) {
+	decode := func(patch string) jsonpatch.Patch {
+		p, err := jsonpatch.DecodePatch([]byte(patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	labels := decode(`[{"op": "add", "path": "/metadata/labels", "value": {}}]`)
+	clusterIP := decode(`[{"op": "remove", "path": "/spec/clusterIP"}]`)
+
+	cases := []struct {
+		Name      string
+		Response  PluginResponse
+		Other     PluginResponse
+		Expected  PluginResponse
+		ShouldErr bool
+	}{
+		{
+			Name:     "ConcatenatesPatches",
+			Response: PluginResponse{Version: "v1", Patches: labels},
+			Other:    PluginResponse{Version: "v1", Patches: clusterIP},
+			Expected: PluginResponse{Version: "v1", Patches: append(append(jsonpatch.Patch{}, labels...), clusterIP...)},
+		},
+		{
+			Name:     "AlignsReasons",
+			Response: PluginResponse{Patches: labels},
+			Other:    PluginResponse{Patches: clusterIP, Reasons: []string{"removed clusterIP"}},
+			Expected: PluginResponse{
+				Patches: append(append(jsonpatch.Patch{}, labels...), clusterIP...),
+				Reasons: []string{"", "removed clusterIP"},
+			},
+		},
+		{
+			Name:     "PropagatesWhiteOut",
+			Response: PluginResponse{Version: "v1", Patches: labels},
+			Other:    PluginResponse{IsWhiteOut: true, WhiteOutReason: "PVC handled separately"},
+			Expected: PluginResponse{Version: "v1", IsWhiteOut: true, WhiteOutReason: "PVC handled separately", Patches: labels},
+		},
+		{
+			Name:     "JoinsWhiteOutReasons",
+			Response: PluginResponse{IsWhiteOut: true, WhiteOutReason: "first"},
+			Other:    PluginResponse{IsWhiteOut: true, WhiteOutReason: "second"},
+			Expected: PluginResponse{IsWhiteOut: true, WhiteOutReason: "first; second"},
+		},
+		{
+			Name:     "UnhandledByBoth",
+			Response: PluginResponse{Unhandled: true},
+			Other:    PluginResponse{Unhandled: true},
+			Expected: PluginResponse{Unhandled: true},
+		},
+		{
+			Name:     "HandledByOne",
+			Response: PluginResponse{Unhandled: true},
+			Other:    PluginResponse{Patches: clusterIP},
+			Expected: PluginResponse{Patches: clusterIP},
+		},
+		{
+			Name:     "AppendsWarnings",
+			Response: PluginResponse{Warnings: []string{"first"}},
+			Other:    PluginResponse{Patches: clusterIP, Warnings: []string{"second"}},
+			Expected: PluginResponse{Patches: clusterIP, Warnings: []string{"first", "second"}},
+		},
+		{
+			Name:     "DeduplicatesWarnings",
+			Response: PluginResponse{Warnings: []string{"first", "second", "first"}},
+			Other:    PluginResponse{Warnings: []string{"third", "second"}},
+			Expected: PluginResponse{Warnings: []string{"first", "second", "third"}},
+		},
+		{
+			Name:      "VersionConflict",
+			Response:  PluginResponse{Version: "v1"},
+			Other:     PluginResponse{Version: "v2"},
+			ShouldErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			merged, err := c.Response.Merge(c.Other)
+			if (err != nil) != c.ShouldErr {
+				t.Fatalf("unexpected error: %v, ShouldErr: %v", err, c.ShouldErr)
+			}
+			if !reflect.DeepEqual(merged, c.Expected) {
+				t.Errorf("incorrect merged response, actual: %#v expected: %#v", merged, c.Expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// PluginRecord is a record written by RecordingPlugin. Every run writes an
+// input record, holding the object passed to the plugin, followed by an
+// output record holding its response or error. The records of a run share
+// their ID.
+type PluginRecord struct {
+	ID       int64                      `json:"id"`
+	Plugin   string                     `json:"plugin"`
+	Input    *unstructured.Unstructured `json:"input,omitempty"`
+	Response *PluginResponse            `json:"response,omitempty"`
+	Error    string                     `json:"error,omitempty"`
+}
+
+// RecordingPlugin writes the input and output of every run of inner to sink
+// as JSON PluginRecords, one per line, for reproducing issues with a plugin.
+// Records of concurrent runs may interleave, their ID correlates them. A
+// failure to write a record fails the run.
+func RecordingPlugin(inner Plugin, sink io.Writer) Plugin {
+	return &recordingPlugin{inner: inner, encoder: json.NewEncoder(sink)}
+}
+
+type recordingPlugin struct {
+	inner Plugin
+
+	lock    sync.Mutex
+	encoder *json.Encoder
+	lastID  int64
+}
+
+var _ ContextPlugin = &recordingPlugin{}
+
+// String identifies the plugin by the plugin it wraps.
+func (r *recordingPlugin) String() string {
+	return pluginName(r.inner)
+}
+
+func (r *recordingPlugin) Run(u *unstructured.Unstructured) (PluginResponse, error) {
+	return r.RunContext(context.Background(), u)
+}
+
+func (r *recordingPlugin) RunContext(ctx context.Context, u *unstructured.Unstructured) (PluginResponse, error) {
+	r.lock.Lock()
+	r.lastID++
+	id := r.lastID
+	r.lock.Unlock()
+
+	name := pluginName(r.inner)
+	if err := r.write(PluginRecord{ID: id, Plugin: name, Input: u.DeepCopy()}); err != nil {
+		return PluginResponse{}, err
+	}
+	resp, err := runPluginContext(ctx, r.inner, u)
+	output := PluginRecord{ID: id, Plugin: name}
+	if err != nil {
+		output.Error = err.Error()
+	} else {
+		output.Response = &resp
+	}
+	if writeErr := r.write(output); writeErr != nil && err == nil {
+		return PluginResponse{}, writeErr
+	}
+	return resp, err
+}
+
+func (r *recordingPlugin) write(record PluginRecord) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.encoder.Encode(record); err != nil {
+		return fmt.Errorf("unable to record the run of plugin %q: %w", record.Plugin, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package transform_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/konveyor/crane-lib/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type failingPlugin struct{}
+
+func (failingPlugin) Run(u *unstructured.Unstructured) (transform.PluginResponse, error) {
+	return transform.PluginResponse{}, fmt.Errorf("cannot transform %v", u.GetName())
+}
+
+func TestRecordingPlugin(t *testing.T) {
+	configMap := func(name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"kind":       "ConfigMap",
+				"apiVersion": "v1",
+				"metadata":   map[string]interface{}{"name": name},
+			},
+		}
+	}
+
+	sink := &bytes.Buffer{}
+	recorded := transform.RecordingPlugin(&labelPlugin{}, sink)
+	for _, name := range []string{"first", "second"} {
+		if _, err := recorded.Run(configMap(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := transform.RecordingPlugin(failingPlugin{}, sink).Run(configMap("third")); err == nil {
+		t.Fatal("expected the error of the plugin")
+	}
+
+	records := []transform.PluginRecord{}
+	decoder := json.NewDecoder(sink)
+	for decoder.More() {
+		record := transform.PluginRecord{}
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 6 {
+		t.Fatalf("expected an input and an output record per run, got %v", len(records))
+	}
+	for i, name := range []string{"first", "second", "third"} {
+		input, output := records[2*i], records[2*i+1]
+		if input.ID != output.ID {
+			t.Errorf("records of run %v have different ids %v and %v", name, input.ID, output.ID)
+		}
+		if input.Input == nil || input.Input.GetName() != name {
+			t.Errorf("expected the input of run %v, got %v", name, input.Input)
+		}
+		if input.Response != nil || output.Input != nil {
+			t.Errorf("expected separate input and output records for run %v", name)
+		}
+	}
+	if records[0].ID == records[2].ID {
+		t.Error("expected distinct ids for distinct runs")
+	}
+	if records[1].Response == nil || len(records[1].Response.Patches) != 1 {
+		t.Errorf("expected the response of the plugin, got %v", records[1].Response)
+	}
+	if records[5].Error != "cannot transform third" || records[5].Response != nil {
+		t.Errorf("expected the error of the plugin, got %#v", records[5])
+	}
+}
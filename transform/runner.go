@@ -1,10 +1,17 @@
 package transform
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
 )
 
 type Runner struct {
@@ -12,47 +19,424 @@ type Runner struct {
 	// This should include generic args to be passed to each Plugin
 	// This also needs to handle the options that it will need.
 	// TODO: Figure out options that the runner will need and implement here.
+
+	// AllowedPaths, when set, restricts plugin patches to operations on the
+	// listed JSON pointer prefixes. By default every path is allowed.
+	AllowedPaths []string
+	// DeniedPaths rejects plugin patches with operations on any of the listed
+	// JSON pointer prefixes, e.g. "/metadata/uid", or on any of their
+	// ancestors, e.g. "/metadata". It takes precedence over AllowedPaths.
+	DeniedPaths []string
+
+	// PatchHook, when set, is called with the object and the patch merged
+	// from all plugins. The patch it returns replaces the merged patch, and
+	// an error aborts the transform of the object. It is not called for
+	// objects that are whited out.
+	PatchHook func(obj unstructured.Unstructured, patch jsonpatch.Patch) (jsonpatch.Patch, error)
+
+	// Observer, when set, is notified of plugin runs and processed objects.
+	Observer Observer
+
+	// FailFast makes RunAll stop at the first object that fails, instead of
+	// processing the remaining objects.
+	FailFast bool
+
+	// PluginsFor, when set, selects the plugins RunAll runs against each
+	// object, e.g. a KubernetesTransformPlugin with the NewNamespace of the
+	// object's namespace. The plugins it returns replace the plugins given
+	// to RunAll, which are still run for the objects it returns nil for.
+	PluginsFor func(object unstructured.Unstructured) []Plugin
+
+	// VerifyPatches applies the patch of each object to it in memory, and
+	// fails the object naming the first operation that does not apply. Like
+	// the apply package, an empty annotations map is added to objects without
+	// annotations before the patch is applied.
+	VerifyPatches bool
+
+	// ContinueOnError reports the errors of all plugins, rather than only the
+	// first one, in an aggregate error. The patches of the plugins that
+	// succeeded are still merged and returned along with the error, so in
+	// this mode a patch returned with an error reflects only the successful
+	// plugins.
+	ContinueOnError bool
+
+	// Validator, when set, is called with each object as it is once its
+	// patch is applied, and an error fails the object. It catches transforms
+	// producing objects the destination API server would reject.
+	Validator Validator
+
+	// SourceContext, when set, is passed on to plugins implementing
+	// ContextPlugin through their context, see SourceContextFrom. Plugins
+	// not looking for it are unaffected.
+	SourceContext *SourceContext
 }
 
+// Run executes each plugin against a copy of the object, by decreasing
+// priority for plugins implementing PriorityPlugin, and in the order the
+// plugins are given for plugins of equal priority. The returned patches are
+// the concatenation of each plugin's patches in that same order. As soon as a
+// plugin whites out the object, the remaining plugins are not run and the
+// patches of the earlier plugins are discarded. Plugins implementing
+// ScopedPlugin are skipped for objects they do not apply to.
 func (r *Runner) Run(object unstructured.Unstructured, plugins []Plugin) ([]byte, bool, error) {
-	haveWhiteOut := false
-	havePatches := false
+	return r.RunContext(context.Background(), object, plugins)
+}
+
+// RunContext is like Run, but stops invoking plugins once ctx is cancelled and
+// returns ctx.Err(). The context is passed on to plugins implementing
+// ContextPlugin, so they can abort a run in progress.
+func (r *Runner) RunContext(ctx context.Context, object unstructured.Unstructured, plugins []Plugin) ([]byte, bool, error) {
+	result := r.runObject(ctx, object, plugins, nil)
+	return result.Patches, result.IsWhiteOut, result.Err
+}
+
+// NamedPlugin is a plugin along with the name its results are reported under
+// by RunNamed.
+type NamedPlugin struct {
+	Name   string
+	Plugin Plugin
+}
+
+// RunNamed runs the plugins like Run, and also returns the response of each
+// plugin keyed by its name, so the names must be unique. Responses are only
+// recorded for the plugins that ran successfully.
+func (r *Runner) RunNamed(object unstructured.Unstructured, plugins []NamedPlugin) ([]byte, bool, map[string]PluginResponse, error) {
+	names := map[string]bool{}
+	ordered := make([]Plugin, 0, len(plugins))
+	for _, p := range plugins {
+		if names[p.Name] {
+			return nil, false, nil, fmt.Errorf("duplicate plugin name %q", p.Name)
+		}
+		names[p.Name] = true
+		ordered = append(ordered, p.Plugin)
+	}
+
+	responses := map[string]PluginResponse{}
+	result := r.runObject(context.Background(), object, ordered, func(i int, resp PluginResponse) {
+		responses[plugins[i].Name] = resp
+	})
+	return result.Patches, result.IsWhiteOut, responses, result.Err
+}
+
+// runObject runs the plugins against the object. onResponse, when set, is
+// called with the index and response of each plugin that succeeds.
+func (r *Runner) runObject(ctx context.Context, object unstructured.Unstructured, plugins []Plugin, onResponse func(int, PluginResponse)) RunResult {
+	warnings := []string{}
+	ops, isWhiteOut, whiteOutReason, pluginErr := r.run(ctx, object, plugins, func(i int, resp PluginResponse) {
+		warnings = append(warnings, resp.Warnings...)
+		if onResponse != nil {
+			onResponse(i, resp)
+		}
+	})
+	result := r.result(object, ops, isWhiteOut, whiteOutReason, pluginErr)
+	if len(warnings) > 0 {
+		result.Warnings = warnings
+	}
+	return result
+}
+
+// result merges the operations of the plugins into the object's patch,
+// running it through the PatchHook and the verifications.
+func (r *Runner) result(object unstructured.Unstructured, ops []ExplainedOperation, isWhiteOut bool, whiteOutReason string, pluginErr error) RunResult {
+	if pluginErr != nil && !r.ContinueOnError {
+		return RunResult{Err: pluginErr}
+	}
+	if isWhiteOut {
+		return RunResult{IsWhiteOut: true, WhiteOutReason: whiteOutReason, Err: pluginErr}
+	}
+	// TODO: Handle dedup
+	// TODO: Handle conflicts with paths
 	patches := jsonpatch.Patch{}
+	for _, op := range ops {
+		patches = append(patches, op.Operation)
+	}
+	if r.PatchHook != nil {
+		var err error
+		patches, err = r.PatchHook(*object.DeepCopy(), patches)
+		if err != nil {
+			return RunResult{Err: err}
+		}
+	}
+	if r.VerifyPatches {
+		if err := verifyPatch(object, patches); err != nil {
+			return RunResult{Err: err}
+		}
+	}
+	if r.Validator != nil {
+		if err := validatePatched(r.Validator, object, patches); err != nil {
+			return RunResult{Err: err}
+		}
+	}
+	if len(patches) > 0 {
+		b, err := json.Marshal(patches)
+		if err != nil {
+			return RunResult{Err: err}
+		}
+		return RunResult{Patches: b, Err: pluginErr}
+	}
+	return RunResult{Err: pluginErr}
+}
+
+// RunResult is the outcome of running the plugins against a single object.
+type RunResult struct {
+	// Patches is the marshaled JSON patch for the object, as returned by Run.
+	Patches    []byte
+	IsWhiteOut bool
+	// WhiteOutReason holds the reasons given by the plugins that whited out
+	// the object.
+	WhiteOutReason string
+	// Warnings holds the warnings reported by the plugins that ran
+	// successfully.
+	Warnings []string
+	Err      error
+}
+
+// RunAll runs the plugins against each of the objects. The returned results
+// are in the same order as the objects. An error for one object does not stop
+// the remaining objects from being processed: it is recorded in that object's
+// result, and the returned error aggregates the errors of all objects. With
+// FailFast set, RunAll returns the results up to and including the first
+// failed object instead. With PluginsFor set, the plugins are selected per
+// object.
+func (r *Runner) RunAll(objects []unstructured.Unstructured, plugins []Plugin) ([]RunResult, error) {
+	results := make([]RunResult, 0, len(objects))
 	errs := []error{}
+	for _, object := range objects {
+		objectPlugins := plugins
+		if r.PluginsFor != nil {
+			if selected := r.PluginsFor(object); selected != nil {
+				objectPlugins = selected
+			}
+		}
+		result := r.runObject(context.Background(), object, objectPlugins, nil)
+		results = append(results, result)
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%v %v/%v: %w", object.GroupVersionKind(), object.GetNamespace(), object.GetName(), result.Err))
+			if r.FailFast {
+				break
+			}
+		}
+	}
+	return results, utilerrors.NewAggregate(errs)
+}
+
+// RunExplain runs the plugins like Run, but returns each resulting operation
+// along with the reason given by the plugin that emitted it. Operations from
+// plugins that do not explain their patches have an empty reason. The
+// PatchHook is not applied, as its changes can not be explained.
+func (r *Runner) RunExplain(object unstructured.Unstructured, plugins []Plugin) ([]ExplainedOperation, bool, error) {
+	ops, isWhiteOut, _, err := r.run(context.Background(), object, plugins, nil)
+	if isWhiteOut {
+		return nil, true, err
+	}
+	return ops, false, err
+}
 
-	for _, plugin := range plugins {
+func (r *Runner) run(ctx context.Context, object unstructured.Unstructured, plugins []Plugin, onResponse func(int, PluginResponse)) ([]ExplainedOperation, bool, string, error) {
+	haveWhiteOut := false
+	whiteOutReasons := []string{}
+	ops := []ExplainedOperation{}
+	errs := []error{}
+	if r.SourceContext != nil {
+		ctx = WithSourceContext(ctx, *r.SourceContext)
+	}
+
+	for _, i := range pluginOrder(plugins) {
+		plugin := plugins[i]
+		if err := ctx.Err(); err != nil {
+			return nil, false, "", err
+		}
+		if scoped, ok := plugin.(ScopedPlugin); ok && !scoped.AppliesTo(object.GroupVersionKind().GroupKind()) {
+			continue
+		}
 		// We want to keep the original while we run each plugin.
 		c := object.DeepCopy()
 		// TODO: Handle Version things here
-		resp, err := plugin.Run(c)
+		resp, err := r.runPlugin(ctx, plugin, c)
 		if err != nil {
 			//TODO: add debug level logging here
-			errs = append(errs, err)
+			errs = append(errs, fmt.Errorf("plugin %q failed: %w", pluginName(plugin), err))
 			continue
 		}
+		if err := r.validatePaths(resp.Patches); err != nil {
+			errs = append(errs, fmt.Errorf("plugin %q failed: %w", pluginName(plugin), err))
+			continue
+		}
+		if onResponse != nil {
+			onResponse(i, resp)
+		}
 		if resp.IsWhiteOut {
 			haveWhiteOut = true
+			if resp.WhiteOutReason != "" {
+				whiteOutReasons = append(whiteOutReasons, resp.WhiteOutReason)
+			}
+			// The object is dropped, the remaining plugins would only do
+			// wasted work.
+			break
 		}
-		if len(resp.Patches) > 0 {
-			havePatches = true
-			patches = append(patches, resp.Patches...)
+		for j, op := range resp.Patches {
+			explained := ExplainedOperation{Operation: op}
+			if j < len(resp.Reasons) {
+				explained.Reason = resp.Reasons[j]
+			}
+			ops = append(ops, explained)
 		}
 	}
 	// TODO: in the future we should consider a way to speed this up with go routines.
-	if len(errs) > 0 {
-		// TODO: handle error in a reasonable way. Probably needs an enhancement
-		// Should Consider option to ignore errors
-		return nil, false, errs[0]
+	if r.Observer != nil {
+		r.Observer.OnObjectDone(object.GroupVersionKind(), len(errs) == 0 && haveWhiteOut)
+	}
+	if len(errs) > 0 && !r.ContinueOnError {
+		return nil, false, "", errs[0]
 	}
+	err := utilerrors.NewAggregate(errs)
 	if haveWhiteOut {
 		// TODO: handle if we should skip whiteOut if there is a transform
-		return nil, true, nil
+		return nil, true, strings.Join(whiteOutReasons, "; "), err
 	}
-	if havePatches {
-		// TODO: Handle dedup
-		// TODO: Handle conflicts with paths
-		b, err := json.Marshal(patches)
-		return b, false, err
+	return ops, false, "", err
+}
+
+// pluginOrder returns the indexes of the plugins in the order they are run:
+// by decreasing priority, keeping the given order for equal priorities.
+func pluginOrder(plugins []Plugin) []int {
+	order := make([]int, len(plugins))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return pluginPriority(plugins[order[i]]) > pluginPriority(plugins[order[j]])
+	})
+	return order
+}
+
+func pluginPriority(plugin Plugin) int {
+	if p, ok := plugin.(PriorityPlugin); ok {
+		return p.Priority()
+	}
+	return 0
+}
+
+func (r *Runner) runPlugin(ctx context.Context, plugin Plugin, object *unstructured.Unstructured) (PluginResponse, error) {
+	if r.Observer == nil {
+		return runPluginContext(ctx, plugin, object)
+	}
+	name := pluginName(plugin)
+	r.Observer.OnPluginStart(name)
+	start := time.Now()
+	resp, err := runPluginContext(ctx, plugin, object)
+	r.Observer.OnPluginEnd(name, time.Since(start), err)
+	return resp, err
+}
+
+func runPluginContext(ctx context.Context, plugin Plugin, object *unstructured.Unstructured) (PluginResponse, error) {
+	if p, ok := plugin.(ContextPlugin); ok {
+		return p.RunContext(ctx, object)
+	}
+	return plugin.Run(object)
+}
+
+// verifyPatch checks that each operation of patch applies to the object.
+func verifyPatch(object unstructured.Unstructured, patch jsonpatch.Patch) error {
+	if len(patch) == 0 {
+		return nil
 	}
-	return nil, false, nil
+	doc, err := patchableDocument(object)
+	if err != nil {
+		return err
+	}
+	for i, op := range patch {
+		doc, err = jsonpatch.Patch{op}.Apply(doc)
+		if err != nil {
+			path, _ := op.Path()
+			return fmt.Errorf("patch operation %v (%v %v) does not apply: %w", i, op.Kind(), path, err)
+		}
+	}
+	return nil
+}
+
+// validatePatched validates the object resulting from applying patch.
+func validatePatched(validator Validator, object unstructured.Unstructured, patch jsonpatch.Patch) error {
+	doc, err := patchableDocument(object)
+	if err != nil {
+		return err
+	}
+	if len(patch) > 0 {
+		doc, err = patch.Apply(doc)
+		if err != nil {
+			return fmt.Errorf("unable to apply the patch to validate the object: %w", err)
+		}
+	}
+	patched := map[string]interface{}{}
+	if err := utiljson.Unmarshal(doc, &patched); err != nil {
+		return err
+	}
+	if err := validator.Validate(unstructured.Unstructured{Object: patched}); err != nil {
+		return fmt.Errorf("transformed object is invalid: %w", err)
+	}
+	return nil
+}
+
+// patchableDocument marshals the object the way the apply package does
+// before applying patches: an empty annotations map is added to objects
+// without annotations.
+func patchableDocument(object unstructured.Unstructured) ([]byte, error) {
+	u := object.DeepCopy()
+	if len(u.GetAnnotations()) == 0 {
+		u.SetAnnotations(map[string]string{})
+	}
+	return u.MarshalJSON()
+}
+
+// validatePaths ensures the patch only touches paths permitted by
+// AllowedPaths and DeniedPaths.
+func (r *Runner) validatePaths(patch jsonpatch.Patch) error {
+	if len(r.AllowedPaths) == 0 && len(r.DeniedPaths) == 0 {
+		return nil
+	}
+	for _, op := range patch {
+		paths := []string{}
+		path, err := op.Path()
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		if op.Kind() == "move" {
+			// A move removes the value at from.
+			from, err := op.From()
+			if err != nil {
+				return err
+			}
+			paths = append(paths, from)
+		}
+		for _, p := range paths {
+			for _, denied := range r.DeniedPaths {
+				// An operation on an ancestor, e.g. a replace of /metadata,
+				// would overwrite the denied path as well.
+				if hasPathPrefix(p, denied) || hasPathPrefix(denied, p) {
+					return fmt.Errorf("patch operation %v on %v is denied", op.Kind(), p)
+				}
+			}
+			if len(r.AllowedPaths) == 0 {
+				continue
+			}
+			allowed := false
+			for _, prefix := range r.AllowedPaths {
+				if hasPathPrefix(p, prefix) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return fmt.Errorf("patch operation %v on %v is not allowed", op.Kind(), p)
+			}
+		}
+	}
+	return nil
+}
+
+// hasPathPrefix reports whether the JSON pointer path is prefix or lies below it.
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
 }
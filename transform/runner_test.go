@@ -1,8 +1,13 @@
 package transform
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	internaljsonpatch "github.com/konveyor/crane-lib/transform/internal/jsonpatch"
@@ -154,3 +159,1082 @@ func TestRunnerRun(t *testing.T) {
 	}
 
 }
+
+func TestRunnerRunPreservesPluginOrder(t *testing.T) {
+	patchPlugin := func(patch string) Plugin {
+		return fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			p, err := jsonpatch.DecodePatch([]byte(patch))
+			if err != nil {
+				return PluginResponse{}, err
+			}
+			return PluginResponse{Patches: p}, nil
+		})
+	}
+	plugins := []Plugin{
+		patchPlugin(`[{"op": "add", "path": "/metadata/namespace", "value": "new"}]`),
+		patchPlugin(`[{"op": "add", "path": "/spec/reference", "value": "new"}]`),
+	}
+
+	runner := Runner{}
+	patches, _, err := runner.Run(unstructured.Unstructured{}, plugins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"op":"add","path":"/metadata/namespace","value":"new"},{"op":"add","path":"/spec/reference","value":"new"}]`
+	if string(patches) != expected {
+		t.Errorf("patches not in plugin order, actual: %v expected: %v", string(patches), expected)
+	}
+}
+
+// priorityPlugin adds its name to /spec/order.
+type priorityPlugin struct {
+	name     string
+	priority int
+}
+
+func (p priorityPlugin) Run(u *unstructured.Unstructured) (PluginResponse, error) {
+	patch, err := jsonpatch.DecodePatch([]byte(fmt.Sprintf(`[{"op": "add", "path": "/spec/order/-", "value": %q}]`, p.name)))
+	if err != nil {
+		return PluginResponse{}, err
+	}
+	return PluginResponse{Patches: patch}, nil
+}
+
+func (p priorityPlugin) Priority() int {
+	return p.priority
+}
+
+func TestRunnerRunPluginPriority(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Plugins  []Plugin
+		Expected []string
+	}{
+		{
+			Name: "HigherPriorityFirst",
+			Plugins: []Plugin{
+				priorityPlugin{name: "low", priority: -1},
+				priorityPlugin{name: "high", priority: 10},
+			},
+			Expected: []string{"high", "low"},
+		},
+		{
+			Name: "TiesKeepInputOrder",
+			Plugins: []Plugin{
+				priorityPlugin{name: "first", priority: 1},
+				priorityPlugin{name: "second", priority: 1},
+				priorityPlugin{name: "high", priority: 2},
+				priorityPlugin{name: "third", priority: 1},
+			},
+			Expected: []string{"high", "first", "second", "third"},
+		},
+		{
+			Name: "PluginsWithoutPriority",
+			Plugins: []Plugin{
+				priorityPlugin{name: "negative", priority: -1},
+				fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+					return priorityPlugin{name: "none"}.Run(u)
+				}),
+				priorityPlugin{name: "zero"},
+				priorityPlugin{name: "positive", priority: 1},
+			},
+			Expected: []string{"positive", "none", "zero", "negative"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			object := unstructured.Unstructured{Object: map[string]interface{}{
+				"spec": map[string]interface{}{"order": []interface{}{}},
+			}}
+			runner := Runner{}
+			patches, _, err := runner.Run(object, c.Plugins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			patch, err := jsonpatch.DecodePatch(patches)
+			if err != nil {
+				t.Fatal(err)
+			}
+			order := []string{}
+			for _, op := range patch {
+				value, err := op.ValueInterface()
+				if err != nil {
+					t.Fatal(err)
+				}
+				order = append(order, value.(string))
+			}
+			if !reflect.DeepEqual(order, c.Expected) {
+				t.Errorf("plugins not run by priority, actual: %v expected: %v", order, c.Expected)
+			}
+		})
+	}
+}
+
+// scopedPlugin is a plugin applying to the kinds of its group kinds.
+type scopedPlugin struct {
+	fakePlugin
+	groupKinds []schema.GroupKind
+}
+
+func (p scopedPlugin) AppliesTo(gk schema.GroupKind) bool {
+	for _, groupKind := range p.groupKinds {
+		if groupKind == gk {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRunnerRunScopedPlugin(t *testing.T) {
+	object := func(apiVersion, kind string) unstructured.Unstructured {
+		return unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+		}}
+	}
+	cases := []struct {
+		Name       string
+		Object     unstructured.Unstructured
+		GroupKinds []schema.GroupKind
+		ShouldRun  bool
+	}{
+		{
+			Name:       "MatchingKind",
+			Object:     object("apps/v1", "Deployment"),
+			GroupKinds: []schema.GroupKind{{Group: "apps", Kind: "Deployment"}},
+			ShouldRun:  true,
+		},
+		{
+			Name:       "OneOfTheKinds",
+			Object:     object("v1", "ConfigMap"),
+			GroupKinds: []schema.GroupKind{{Group: "apps", Kind: "Deployment"}, {Kind: "ConfigMap"}},
+			ShouldRun:  true,
+		},
+		{
+			Name:       "OtherKind",
+			Object:     object("v1", "Service"),
+			GroupKinds: []schema.GroupKind{{Group: "apps", Kind: "Deployment"}},
+		},
+		{
+			Name:       "SameKindOtherGroup",
+			Object:     object("extensions/v1beta1", "Deployment"),
+			GroupKinds: []schema.GroupKind{{Group: "apps", Kind: "Deployment"}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ran := false
+			plugin := scopedPlugin{
+				fakePlugin: func(u *unstructured.Unstructured) (PluginResponse, error) {
+					ran = true
+					return PluginResponse{}, nil
+				},
+				groupKinds: c.GroupKinds,
+			}
+			unscopedRan := false
+			unscoped := fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+				unscopedRan = true
+				return PluginResponse{}, nil
+			})
+
+			runner := Runner{}
+			if _, _, err := runner.Run(c.Object, []Plugin{plugin, unscoped}); err != nil {
+				t.Fatal(err)
+			}
+			if ran != c.ShouldRun {
+				t.Errorf("scoped plugin ran: %v, expected: %v", ran, c.ShouldRun)
+			}
+			if !unscopedRan {
+				t.Error("expected the plugin without a scope to run")
+			}
+		})
+	}
+}
+
+func TestRunnerRunExplain(t *testing.T) {
+	plugins := []Plugin{
+		fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/spec/testing", "value": "test"}, {"op": "remove", "path": "/spec/old"}]`))
+			if err != nil {
+				return PluginResponse{}, err
+			}
+			return PluginResponse{
+				Patches: p,
+				Reasons: []string{"added testing", "removed old"},
+			}, nil
+		}),
+		fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/spec/newValue", "value": "test"}]`))
+			if err != nil {
+				return PluginResponse{}, err
+			}
+			return PluginResponse{
+				Patches: p,
+			}, nil
+		}),
+	}
+
+	runner := Runner{}
+	ops, isWhiteOut, err := runner.RunExplain(unstructured.Unstructured{}, plugins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isWhiteOut {
+		t.Error("unexpected white out")
+	}
+	expected := []struct{ path, reason string }{
+		{"/spec/testing", "added testing"},
+		{"/spec/old", "removed old"},
+		{"/spec/newValue", ""},
+	}
+	if len(ops) != len(expected) {
+		t.Fatalf("incorrect number of operations, actual: %v expected: %v", len(ops), len(expected))
+	}
+	for i, e := range expected {
+		path, err := ops[i].Operation.Path()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != e.path || ops[i].Reason != e.reason {
+			t.Errorf("incorrect operation %v, actual: %v %q expected: %v %q", i, path, ops[i].Reason, e.path, e.reason)
+		}
+	}
+}
+
+func TestRunnerRunAll(t *testing.T) {
+	object := func(kind string) unstructured.Unstructured {
+		return unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"kind":       kind,
+				"apiVersion": "v1",
+				"metadata": map[string]interface{}{
+					"name":      "test",
+					"namespace": "test",
+				},
+			},
+		}
+	}
+	plugins := []Plugin{
+		fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			switch u.GetKind() {
+			case "PersistentVolumeClaim":
+				return PluginResponse{IsWhiteOut: true}, nil
+			case "Broken":
+				return PluginResponse{}, fmt.Errorf("unable to transform")
+			case "Service":
+				p, err := jsonpatch.DecodePatch([]byte(`[{"op": "remove", "path": "/spec/clusterIP"}]`))
+				if err != nil {
+					return PluginResponse{}, err
+				}
+				return PluginResponse{Patches: p}, nil
+			case "ConfigMap":
+				return PluginResponse{Warnings: []string{"config may be stale"}}, nil
+			}
+			return PluginResponse{}, nil
+		}),
+	}
+
+	runner := Runner{}
+	results, err := runner.RunAll([]unstructured.Unstructured{
+		object("PersistentVolumeClaim"),
+		object("Service"),
+		object("Broken"),
+		object("ConfigMap"),
+	}, plugins)
+	if err == nil {
+		t.Error("expected the error of the broken object to be returned")
+	}
+
+	expected := []struct {
+		patches    string
+		isWhiteOut bool
+		warnings   []string
+		shouldErr  bool
+	}{
+		{isWhiteOut: true},
+		{patches: `[{"op":"remove","path":"/spec/clusterIP"}]`},
+		{shouldErr: true},
+		{warnings: []string{"config may be stale"}},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("incorrect number of results, actual: %v expected: %v", len(results), len(expected))
+	}
+	for i, e := range expected {
+		if string(results[i].Patches) != e.patches {
+			t.Errorf("result %v: incorrect patches, actual: %s expected: %s", i, results[i].Patches, e.patches)
+		}
+		if results[i].IsWhiteOut != e.isWhiteOut {
+			t.Errorf("result %v: incorrect white out determination, actual: %v expected: %v", i, results[i].IsWhiteOut, e.isWhiteOut)
+		}
+		if !reflect.DeepEqual(results[i].Warnings, e.warnings) {
+			t.Errorf("result %v: incorrect warnings, actual: %q expected: %q", i, results[i].Warnings, e.warnings)
+		}
+		if (results[i].Err != nil) != e.shouldErr {
+			t.Errorf("result %v: unexpected error: %v", i, results[i].Err)
+		}
+	}
+}
+
+func TestRunnerRunAllFailFast(t *testing.T) {
+	object := func(name string) unstructured.Unstructured {
+		return unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"kind":       "ConfigMap",
+				"apiVersion": "v1",
+				"metadata": map[string]interface{}{
+					"name":      name,
+					"namespace": "test",
+				},
+			},
+		}
+	}
+	plugins := []Plugin{
+		fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			if u.GetName() == "second" {
+				return PluginResponse{}, fmt.Errorf("unable to transform")
+			}
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/metadata/labels", "value": {"migrated": "true"}}]`))
+			if err != nil {
+				return PluginResponse{}, err
+			}
+			return PluginResponse{Patches: p}, nil
+		}),
+	}
+	objects := []unstructured.Unstructured{object("first"), object("second"), object("third")}
+	patches := `[{"op":"add","path":"/metadata/labels","value":{"migrated":"true"}}]`
+
+	cases := []struct {
+		Name      string
+		FailFast  bool
+		ShouldErr []bool
+	}{
+		{
+			Name:      "ContinueOnError",
+			ShouldErr: []bool{false, true, false},
+		},
+		{
+			Name:      "FailFast",
+			FailFast:  true,
+			ShouldErr: []bool{false, true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := Runner{FailFast: c.FailFast}
+			results, err := runner.RunAll(objects, plugins)
+			if err == nil || !strings.Contains(err.Error(), "test/second") {
+				t.Errorf("expected the error of the second object, got: %v", err)
+			}
+			if len(results) != len(c.ShouldErr) {
+				t.Fatalf("incorrect number of results, actual: %v expected: %v", len(results), len(c.ShouldErr))
+			}
+			for i, shouldErr := range c.ShouldErr {
+				if (results[i].Err != nil) != shouldErr {
+					t.Errorf("result %v: unexpected error: %v", i, results[i].Err)
+				}
+				if !shouldErr && string(results[i].Patches) != patches {
+					t.Errorf("result %v: incorrect patches, actual: %s expected: %s", i, results[i].Patches, patches)
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerRunPathValidation(t *testing.T) {
+	patchPlugin := fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+		p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/metadata/annotations/test", "value": "test"}, {"op": "replace", "path": "/metadata/uid", "value": "stolen"}]`))
+		if err != nil {
+			return PluginResponse{}, err
+		}
+		return PluginResponse{Patches: p}, nil
+	})
+	movePlugin := fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+		p, err := jsonpatch.DecodePatch([]byte(`[{"op": "move", "from": "/metadata/managedFields", "path": "/metadata/annotations/fields"}]`))
+		if err != nil {
+			return PluginResponse{}, err
+		}
+		return PluginResponse{Patches: p}, nil
+	})
+	ancestorPlugin := fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+		p, err := jsonpatch.DecodePatch([]byte(`[{"op": "replace", "path": "/metadata", "value": {"name": "test", "uid": "stolen"}}]`))
+		if err != nil {
+			return PluginResponse{}, err
+		}
+		return PluginResponse{Patches: p}, nil
+	})
+	rootPlugin := fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+		p, err := jsonpatch.DecodePatch([]byte(`[{"op": "replace", "path": "", "value": {"metadata": {"uid": "stolen"}}}]`))
+		if err != nil {
+			return PluginResponse{}, err
+		}
+		return PluginResponse{Patches: p}, nil
+	})
+	ancestorMovePlugin := fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+		p, err := jsonpatch.DecodePatch([]byte(`[{"op": "move", "from": "/metadata", "path": "/spec/metadata"}]`))
+		if err != nil {
+			return PluginResponse{}, err
+		}
+		return PluginResponse{Patches: p}, nil
+	})
+
+	cases := []struct {
+		Name         string
+		Plugin       Plugin
+		AllowedPaths []string
+		DeniedPaths  []string
+		ShouldError  bool
+	}{
+		{
+			Name:   "Permissive",
+			Plugin: patchPlugin,
+		},
+		{
+			Name:        "DeniedPath",
+			Plugin:      patchPlugin,
+			DeniedPaths: []string{"/metadata/uid", "/metadata/managedFields"},
+			ShouldError: true,
+		},
+		{
+			Name:        "DeniedPathSiblingAllowed",
+			Plugin:      patchPlugin,
+			DeniedPaths: []string{"/metadata/ui"},
+		},
+		{
+			Name:         "NotInAllowedPaths",
+			Plugin:       patchPlugin,
+			AllowedPaths: []string{"/metadata/annotations", "/spec"},
+			ShouldError:  true,
+		},
+		{
+			Name:         "AllowedPaths",
+			Plugin:       patchPlugin,
+			AllowedPaths: []string{"/metadata/"},
+		},
+		{
+			Name:        "DeniedMoveSource",
+			Plugin:      movePlugin,
+			DeniedPaths: []string{"/metadata/managedFields"},
+			ShouldError: true,
+		},
+		{
+			Name:        "DeniedPathAncestor",
+			Plugin:      ancestorPlugin,
+			DeniedPaths: []string{"/metadata/uid"},
+			ShouldError: true,
+		},
+		{
+			Name:        "DeniedPathRoot",
+			Plugin:      rootPlugin,
+			DeniedPaths: []string{"/metadata/uid"},
+			ShouldError: true,
+		},
+		{
+			Name:        "DeniedMoveSourceAncestor",
+			Plugin:      ancestorMovePlugin,
+			DeniedPaths: []string{"/metadata/uid"},
+			ShouldError: true,
+		},
+		{
+			Name:        "DeniedPathAncestorSiblingAllowed",
+			Plugin:      ancestorPlugin,
+			DeniedPaths: []string{"/spec/selector"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := Runner{AllowedPaths: c.AllowedPaths, DeniedPaths: c.DeniedPaths}
+			patches, _, err := runner.Run(unstructured.Unstructured{}, []Plugin{c.Plugin})
+			if (err != nil) != c.ShouldError {
+				t.Fatalf("Run() error = %v, ShouldError %v", err, c.ShouldError)
+			}
+			if c.ShouldError && patches != nil {
+				t.Errorf("expected no patches on error, got: %s", patches)
+			}
+		})
+	}
+}
+
+func TestRunnerRunPatchHook(t *testing.T) {
+	plugins := []Plugin{
+		fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/spec/testing", "value": "test"}, {"op": "remove", "path": "/spec/clusterIP"}]`))
+			if err != nil {
+				return PluginResponse{}, err
+			}
+			return PluginResponse{Patches: p}, nil
+		}),
+	}
+	object := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "Service",
+			"apiVersion": "v1",
+			"metadata": map[string]interface{}{
+				"name": "frontend",
+			},
+		},
+	}
+
+	cases := []struct {
+		Name          string
+		Plugins       []Plugin
+		PatchHook     func(unstructured.Unstructured, jsonpatch.Patch) (jsonpatch.Patch, error)
+		PatchesString string
+		ShouldError   bool
+	}{
+		{
+			Name:    "HookAppendsOperation",
+			Plugins: plugins,
+			PatchHook: func(obj unstructured.Unstructured, patch jsonpatch.Patch) (jsonpatch.Patch, error) {
+				audit, err := jsonpatch.DecodePatch([]byte(fmt.Sprintf(`[{"op": "add", "path": "/metadata/annotations/migrated", "value": "%v"}]`, obj.GetName())))
+				if err != nil {
+					return nil, err
+				}
+				return append(patch, audit...), nil
+			},
+			PatchesString: `[{"op":"add","path":"/spec/testing","value":"test"},{"op":"remove","path":"/spec/clusterIP"},{"op":"add","path":"/metadata/annotations/migrated","value":"frontend"}]`,
+		},
+		{
+			Name:    "HookRemovesOperation",
+			Plugins: plugins,
+			PatchHook: func(obj unstructured.Unstructured, patch jsonpatch.Patch) (jsonpatch.Patch, error) {
+				filtered := jsonpatch.Patch{}
+				for _, op := range patch {
+					if op.Kind() != "remove" {
+						filtered = append(filtered, op)
+					}
+				}
+				return filtered, nil
+			},
+			PatchesString: `[{"op":"add","path":"/spec/testing","value":"test"}]`,
+		},
+		{
+			Name: "HookCalledWithoutPluginPatches",
+			PatchHook: func(obj unstructured.Unstructured, patch jsonpatch.Patch) (jsonpatch.Patch, error) {
+				return jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/metadata/annotations/migrated", "value": "true"}]`))
+			},
+			PatchesString: `[{"op":"add","path":"/metadata/annotations/migrated","value":"true"}]`,
+		},
+		{
+			Name:    "HookError",
+			Plugins: plugins,
+			PatchHook: func(obj unstructured.Unstructured, patch jsonpatch.Patch) (jsonpatch.Patch, error) {
+				return nil, fmt.Errorf("rejected")
+			},
+			ShouldError: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := Runner{PatchHook: c.PatchHook}
+			patches, _, err := runner.Run(object, c.Plugins)
+			if (err != nil) != c.ShouldError {
+				t.Fatalf("Run() error = %v, ShouldError %v", err, c.ShouldError)
+			}
+			if string(patches) != c.PatchesString {
+				t.Errorf("incorrect patches, actual: %s expected: %s", patches, c.PatchesString)
+			}
+		})
+	}
+}
+
+type observedEvent struct {
+	event    string
+	name     string
+	duration time.Duration
+	err      error
+	gvk      schema.GroupVersionKind
+	whiteOut bool
+}
+
+type recordingObserver struct {
+	events []observedEvent
+}
+
+func (o *recordingObserver) OnPluginStart(name string) {
+	o.events = append(o.events, observedEvent{event: "start", name: name})
+}
+
+func (o *recordingObserver) OnPluginEnd(name string, duration time.Duration, err error) {
+	o.events = append(o.events, observedEvent{event: "end", name: name, duration: duration, err: err})
+}
+
+func (o *recordingObserver) OnObjectDone(gvk schema.GroupVersionKind, whiteOut bool) {
+	o.events = append(o.events, observedEvent{event: "done", gvk: gvk, whiteOut: whiteOut})
+}
+
+type namedPlugin struct {
+	name  string
+	sleep time.Duration
+	resp  PluginResponse
+	err   error
+}
+
+func (n namedPlugin) String() string {
+	return n.name
+}
+
+func (n namedPlugin) Run(u *unstructured.Unstructured) (PluginResponse, error) {
+	time.Sleep(n.sleep)
+	return n.resp, n.err
+}
+
+func TestRunnerRunObserver(t *testing.T) {
+	object := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "PersistentVolumeClaim",
+			"apiVersion": "v1",
+		},
+	}
+	observer := &recordingObserver{}
+	runner := Runner{Observer: observer}
+	_, _, err := runner.Run(object, []Plugin{
+		namedPlugin{name: "slow", sleep: 20 * time.Millisecond},
+		namedPlugin{name: "whiteout", resp: PluginResponse{IsWhiteOut: true}},
+		fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			return PluginResponse{}, nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []observedEvent{
+		{event: "start", name: "slow"},
+		{event: "end", name: "slow"},
+		{event: "start", name: "whiteout"},
+		{event: "end", name: "whiteout"},
+		// The plugin after the whiteout is not run.
+		{event: "done", gvk: schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"}, whiteOut: true},
+	}
+	if len(observer.events) != len(expected) {
+		t.Fatalf("incorrect number of events, actual: %#v expected: %#v", observer.events, expected)
+	}
+	for i, e := range expected {
+		actual := observer.events[i]
+		if actual.event != e.event || actual.name != e.name || actual.gvk != e.gvk || actual.whiteOut != e.whiteOut {
+			t.Errorf("event %v incorrect, actual: %#v expected: %#v", i, actual, e)
+		}
+	}
+	if observer.events[1].duration < 20*time.Millisecond {
+		t.Errorf("slow plugin duration too short: %v", observer.events[1].duration)
+	}
+	if observer.events[3].duration >= 20*time.Millisecond {
+		t.Errorf("whiteout plugin duration too long: %v", observer.events[3].duration)
+	}
+}
+
+func TestRunnerRunObserverError(t *testing.T) {
+	observer := &recordingObserver{}
+	runner := Runner{Observer: observer}
+	pluginErr := fmt.Errorf("plugin failed")
+	_, _, err := runner.Run(unstructured.Unstructured{}, []Plugin{namedPlugin{name: "failing", err: pluginErr}})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(observer.events) != 3 || observer.events[1].err != pluginErr || observer.events[2].whiteOut {
+		t.Errorf("incorrect events: %#v", observer.events)
+	}
+}
+
+type contextPlugin struct {
+	fakePlugin
+	ctx context.Context
+}
+
+func (p *contextPlugin) RunContext(ctx context.Context, u *unstructured.Unstructured) (PluginResponse, error) {
+	p.ctx = ctx
+	return p.Run(u)
+}
+
+func TestRunnerRunContext(t *testing.T) {
+	object := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "ConfigMap",
+			"apiVersion": "v1",
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	first := &contextPlugin{fakePlugin: func(u *unstructured.Unstructured) (PluginResponse, error) {
+		calls++
+		cancel()
+		return PluginResponse{}, nil
+	}}
+	second := fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+		calls++
+		return PluginResponse{}, nil
+	})
+
+	runner := Runner{}
+	_, _, err := runner.RunContext(ctx, object, []Plugin{first, second})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error, got: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected plugins after the cancellation to be skipped, got %v calls", calls)
+	}
+	if first.ctx != ctx {
+		t.Error("expected the context to be passed to the plugin")
+	}
+}
+
+func TestRunnerRunDoesNotShareMutations(t *testing.T) {
+	object := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "ConfigMap",
+			"apiVersion": "v1",
+			"metadata": map[string]interface{}{
+				"name":   "test",
+				"labels": map[string]interface{}{"app": "test"},
+			},
+			"data": map[string]interface{}{
+				"key": "value",
+			},
+		},
+	}
+	original := object.DeepCopy()
+
+	mutating := fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+		u.SetName("mutated")
+		labels := u.Object["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+		labels["app"] = "mutated"
+		u.Object["data"].(map[string]interface{})["key"] = "mutated"
+		return PluginResponse{}, nil
+	})
+	sibling := fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+		if !reflect.DeepEqual(u.Object, original.Object) {
+			return PluginResponse{}, fmt.Errorf("plugin was given a mutated object: %v", u.Object)
+		}
+		return PluginResponse{}, nil
+	})
+
+	runner := Runner{}
+	if _, _, err := runner.Run(object, []Plugin{mutating, sibling, mutating, sibling}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(object.Object, original.Object) {
+		t.Errorf("the original object was mutated: %v", object.Object)
+	}
+}
+
+func TestRunnerRunPluginErrorIdentity(t *testing.T) {
+	object := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "ConfigMap",
+			"apiVersion": "v1",
+		},
+	}
+	errTransform := errors.New("unable to transform")
+
+	cases := []struct {
+		Name     string
+		Plugin   Plugin
+		Expected string
+	}{
+		{
+			Name:     "NamedPlugin",
+			Plugin:   namedPlugin{name: "KubernetesPlugin", err: errTransform},
+			Expected: `plugin "KubernetesPlugin" failed: unable to transform`,
+		},
+		{
+			Name: "UnnamedPlugin",
+			Plugin: fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+				return PluginResponse{}, errTransform
+			}),
+			Expected: `plugin "transform.fakePlugin" failed: unable to transform`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := Runner{}
+			_, _, err := runner.Run(object, []Plugin{namedPlugin{name: "first"}, c.Plugin})
+			if err == nil || err.Error() != c.Expected {
+				t.Errorf("incorrect error, actual: %v expected: %v", err, c.Expected)
+			}
+			if !errors.Is(err, errTransform) {
+				t.Errorf("expected the plugin error to be wrapped, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunnerRunVerifyPatches(t *testing.T) {
+	object := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "Service",
+			"apiVersion": "v1",
+			"spec": map[string]interface{}{
+				"clusterIP": "172.30.12.4",
+			},
+		},
+	}
+	patchPlugin := func(patch string) Plugin {
+		return fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			p, err := jsonpatch.DecodePatch([]byte(patch))
+			if err != nil {
+				return PluginResponse{}, err
+			}
+			return PluginResponse{Patches: p}, nil
+		})
+	}
+
+	cases := []struct {
+		Name          string
+		Plugins       []Plugin
+		VerifyPatches bool
+		ErrorContains string
+	}{
+		{
+			Name: "PatchApplies",
+			Plugins: []Plugin{
+				patchPlugin(`[{"op": "remove", "path": "/spec/clusterIP"}]`),
+				patchPlugin(`[{"op": "add", "path": "/metadata/annotations/migrated", "value": "true"}]`),
+			},
+			VerifyPatches: true,
+		},
+		{
+			Name: "RemoveMissingPath",
+			Plugins: []Plugin{
+				patchPlugin(`[{"op": "remove", "path": "/spec/clusterIP"}]`),
+				patchPlugin(`[{"op": "remove", "path": "/spec/clusterIP"}]`),
+			},
+			VerifyPatches: true,
+			ErrorContains: "patch operation 1 (remove /spec/clusterIP) does not apply",
+		},
+		{
+			Name: "NotVerified",
+			Plugins: []Plugin{
+				patchPlugin(`[{"op": "remove", "path": "/spec/loadBalancerIP"}]`),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := Runner{VerifyPatches: c.VerifyPatches}
+			_, _, err := runner.Run(object, c.Plugins)
+			if c.ErrorContains == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.ErrorContains) {
+				t.Errorf("incorrect error, actual: %v expected to contain: %v", err, c.ErrorContains)
+			}
+		})
+	}
+}
+
+func TestRunnerRunNamed(t *testing.T) {
+	patchPlugin := func(patch string) Plugin {
+		return fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			p, err := jsonpatch.DecodePatch([]byte(patch))
+			if err != nil {
+				return PluginResponse{}, err
+			}
+			return PluginResponse{Version: "v1", Patches: p}, nil
+		})
+	}
+	first := `[{"op": "add", "path": "/spec/first", "value": "a"}]`
+	second := `[{"op": "add", "path": "/spec/second", "value": "b"}]`
+
+	t.Run("KeyedResults", func(t *testing.T) {
+		r := Runner{}
+		patches, isWhiteOut, responses, err := r.RunNamed(unstructured.Unstructured{}, []NamedPlugin{
+			{Name: "first", Plugin: patchPlugin(first)},
+			{Name: "second", Plugin: patchPlugin(second)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isWhiteOut {
+			t.Error("expected no whiteout")
+		}
+		merged, err := jsonpatch.DecodePatch(patches)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/spec/first", "value": "a"}, {"op": "add", "path": "/spec/second", "value": "b"}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := internaljsonpatch.Equal(merged, expected); !ok || err != nil {
+			t.Errorf("unexpected merged patches: %s", patches)
+		}
+		if len(responses) != 2 {
+			t.Fatalf("expected 2 responses, got %v", len(responses))
+		}
+		for name, expected := range map[string]string{"first": first, "second": second} {
+			resp, found := responses[name]
+			if !found {
+				t.Fatalf("missing response for %v", name)
+			}
+			p, err := jsonpatch.DecodePatch([]byte(expected))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := internaljsonpatch.Equal(resp.Patches, p); !ok || err != nil {
+				t.Errorf("unexpected patches for %v: %v", name, resp.Patches)
+			}
+		}
+	})
+
+	t.Run("DuplicateNames", func(t *testing.T) {
+		r := Runner{}
+		_, _, _, err := r.RunNamed(unstructured.Unstructured{}, []NamedPlugin{
+			{Name: "same", Plugin: patchPlugin(first)},
+			{Name: "same", Plugin: patchPlugin(second)},
+		})
+		if err == nil || !strings.Contains(err.Error(), `duplicate plugin name "same"`) {
+			t.Errorf("expected a duplicate name error, got %v", err)
+		}
+	})
+}
+
+func TestRunnerRunValidator(t *testing.T) {
+	deploymentGVK := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	validator := SchemaValidator{
+		deploymentGVK: {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"spec": {
+					Type:     "object",
+					Required: []string{"replicas"},
+					Properties: map[string]*Schema{
+						"replicas": {Type: "integer"},
+					},
+				},
+			},
+		},
+	}
+	object := unstructured.Unstructured{}
+	object.SetGroupVersionKind(deploymentGVK)
+	object.SetName("frontend")
+
+	cases := []struct {
+		Name        string
+		Patch       string
+		ShouldError bool
+	}{
+		{
+			Name:  "Valid",
+			Patch: `[{"op": "add", "path": "/spec", "value": {"replicas": 3}}]`,
+		},
+		{
+			Name:        "ReplicasAsString",
+			Patch:       `[{"op": "add", "path": "/spec", "value": {"replicas": "3"}}]`,
+			ShouldError: true,
+		},
+		{
+			Name:        "MissingReplicas",
+			Patch:       `[{"op": "add", "path": "/spec", "value": {}}]`,
+			ShouldError: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			r := Runner{Validator: validator}
+			_, _, err := r.Run(object, []Plugin{
+				fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+					p, err := jsonpatch.DecodePatch([]byte(c.Patch))
+					if err != nil {
+						return PluginResponse{}, err
+					}
+					return PluginResponse{Patches: p}, nil
+				}),
+			})
+			if c.ShouldError && err == nil {
+				t.Error("expected the transformed object to be rejected")
+			}
+			if !c.ShouldError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunnerRunStopsAtWhiteOut(t *testing.T) {
+	called := false
+	plugins := []Plugin{
+		fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/spec/testing", "value": "test"}]`))
+			if err != nil {
+				return PluginResponse{}, err
+			}
+			return PluginResponse{Patches: p}, nil
+		}),
+		fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			return PluginResponse{IsWhiteOut: true}, nil
+		}),
+		fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			called = true
+			return PluginResponse{}, nil
+		}),
+	}
+
+	r := Runner{}
+	patches, isWhiteOut, err := r.Run(unstructured.Unstructured{}, plugins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isWhiteOut {
+		t.Error("expected the object to be whited out")
+	}
+	if len(patches) != 0 {
+		t.Errorf("expected no patches, got %s", patches)
+	}
+	if called {
+		t.Error("expected the plugin after the whiteout not to be run")
+	}
+}
+
+func TestRunnerRunContinueOnError(t *testing.T) {
+	failing := func(name string) Plugin {
+		return namedPlugin{name: name, err: fmt.Errorf("%v is broken", name)}
+	}
+	plugins := []Plugin{
+		failing("first"),
+		fakePlugin(func(u *unstructured.Unstructured) (PluginResponse, error) {
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/spec/testing", "value": "test"}]`))
+			if err != nil {
+				return PluginResponse{}, err
+			}
+			return PluginResponse{Patches: p}, nil
+		}),
+		failing("second"),
+	}
+
+	r := Runner{ContinueOnError: true}
+	patches, isWhiteOut, err := r.Run(unstructured.Unstructured{}, plugins)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, name := range []string{"first", "second"} {
+		if !strings.Contains(err.Error(), name+" is broken") {
+			t.Errorf("expected the error of plugin %v, got %v", name, err)
+		}
+	}
+	if isWhiteOut {
+		t.Error("expected no whiteout")
+	}
+	if string(patches) != `[{"op":"add","path":"/spec/testing","value":"test"}]` {
+		t.Errorf("expected the patches of the successful plugin, got %s", patches)
+	}
+
+	r = Runner{}
+	patches, _, err = r.Run(unstructured.Unstructured{}, plugins)
+	if err == nil || strings.Contains(err.Error(), "second") {
+		t.Errorf("expected only the first error by default, got %v", err)
+	}
+	if patches != nil {
+		t.Errorf("expected no patches by default, got %s", patches)
+	}
+}
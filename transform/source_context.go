@@ -0,0 +1,41 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// SourceContext describes where the transformed objects come from, for
+// plugins that log or branch on it. Every field is optional.
+type SourceContext struct {
+	// Cluster is the name of the source cluster.
+	Cluster string `json:"cluster,omitempty"`
+	// Namespace is the namespace the objects are exported from.
+	Namespace string `json:"namespace,omitempty"`
+	// MigrationID identifies the migration the objects are transformed for.
+	MigrationID string `json:"migrationID,omitempty"`
+}
+
+// PluginRequest is written to the stdin of binary plugins speaking the "v2"
+// protocol instead of the bare object. Plugins read it with
+// cli.UnstructuredWithSourceContext.
+type PluginRequest struct {
+	// Object is the object to transform.
+	Object json.RawMessage `json:"object"`
+	// SourceContext is the source context of the run, if any.
+	SourceContext *SourceContext `json:"sourceContext,omitempty"`
+}
+
+type sourceContextKey struct{}
+
+// WithSourceContext returns a copy of ctx carrying the source context. The
+// Runner sets it for ContextPlugins when its SourceContext is configured.
+func WithSourceContext(ctx context.Context, source SourceContext) context.Context {
+	return context.WithValue(ctx, sourceContextKey{}, source)
+}
+
+// SourceContextFrom returns the source context carried by ctx, if any.
+func SourceContextFrom(ctx context.Context) (SourceContext, bool) {
+	source, ok := ctx.Value(sourceContextKey{}).(SourceContext)
+	return source, ok
+}
@@ -0,0 +1,74 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ChangeSummary describes what the plugins change on an object, for audit
+// and reporting.
+type ChangeSummary struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	IsWhiteOut bool   `json:"isWhiteOut,omitempty"`
+	// WhiteOutReason holds the reasons given by the plugins that whited out
+	// the object.
+	WhiteOutReason string `json:"whiteOutReason,omitempty"`
+	// Warnings holds the warnings reported by the plugins.
+	Warnings []string `json:"warnings,omitempty"`
+	// Changes are the operations of the object's patch, in order.
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Change is a single operation of an object's patch.
+type Change struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	// From is the source path of move and copy operations.
+	From string `json:"from,omitempty"`
+	// Reason is the explanation the plugin gave for the operation, if any.
+	Reason string `json:"reason,omitempty"`
+}
+
+// RunSummary runs the plugins like Run and also summarizes the resulting
+// changes. When a PatchHook is set, the changes are those of the patch it
+// returns, which carry no reasons.
+func (r *Runner) RunSummary(object unstructured.Unstructured, plugins []Plugin) ([]byte, ChangeSummary, error) {
+	summary := ChangeSummary{
+		APIVersion: object.GetAPIVersion(),
+		Kind:       object.GetKind(),
+		Namespace:  object.GetNamespace(),
+		Name:       object.GetName(),
+	}
+	ops, isWhiteOut, whiteOutReason, pluginErr := r.run(context.Background(), object, plugins, func(_ int, resp PluginResponse) {
+		summary.Warnings = append(summary.Warnings, resp.Warnings...)
+	})
+	result := r.result(object, ops, isWhiteOut, whiteOutReason, pluginErr)
+	summary.IsWhiteOut = result.IsWhiteOut
+	summary.WhiteOutReason = result.WhiteOutReason
+	if result.IsWhiteOut || len(result.Patches) == 0 {
+		return result.Patches, summary, result.Err
+	}
+
+	if r.PatchHook != nil {
+		changes := []Change{}
+		if err := json.Unmarshal(result.Patches, &changes); err != nil {
+			return nil, ChangeSummary{}, err
+		}
+		summary.Changes = changes
+		return result.Patches, summary, result.Err
+	}
+	for _, op := range ops {
+		change := Change{Op: op.Operation.Kind(), Reason: op.Reason}
+		change.Path, _ = op.Operation.Path()
+		if from, err := op.Operation.From(); err == nil {
+			change.From = from
+		}
+		summary.Changes = append(summary.Changes, change)
+	}
+	return result.Patches, summary, result.Err
+}
@@ -0,0 +1,106 @@
+package transform_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/transform/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRunnerRunSummary(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Plugin  kubernetes.KubernetesTransformPlugin
+		Object  unstructured.Unstructured
+		Summary transform.ChangeSummary
+	}{
+		{
+			Name: "Service",
+			Object: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "Service",
+					"metadata":   map[string]interface{}{"name": "frontend", "namespace": "shop"},
+					"spec":       map[string]interface{}{"clusterIP": "172.30.12.4"},
+				},
+			},
+			Summary: transform.ChangeSummary{
+				APIVersion: "v1",
+				Kind:       "Service",
+				Namespace:  "shop",
+				Name:       "frontend",
+				Changes: []transform.Change{
+					{Op: "remove", Path: "/spec/clusterIP", Reason: "removed clusterIP so it is allocated on the destination cluster"},
+				},
+			},
+		},
+		{
+			Name: "WhitedOutPVC",
+			Object: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "PersistentVolumeClaim",
+					"metadata":   map[string]interface{}{"name": "data", "namespace": "shop"},
+				},
+			},
+			Summary: transform.ChangeSummary{
+				APIVersion:     "v1",
+				Kind:           "PersistentVolumeClaim",
+				Namespace:      "shop",
+				Name:           "data",
+				IsWhiteOut:     true,
+				WhiteOutReason: "PVC handled separately",
+			},
+		},
+		{
+			Name: "UnmatchedRegistry",
+			Plugin: kubernetes.KubernetesTransformPlugin{
+				RegistryReplacement:     map[string]string{"quay.io": "registry.example.com"},
+				RequireRegistryMatch:    true,
+				WarnUnmatchedRegistries: true,
+			},
+			Object: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "Pod",
+					"metadata":   map[string]interface{}{"name": "frontend", "namespace": "shop"},
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{"name": "frontend", "image": "docker.io/library/nginx:latest"},
+						},
+					},
+				},
+			},
+			Summary: transform.ChangeSummary{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Namespace:  "shop",
+				Name:       "frontend",
+				Warnings:   []string{"images of Pod shop/frontend match no RegistryReplacement rule: docker.io/library/nginx:latest"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := transform.Runner{}
+			plugins := []transform.Plugin{&c.Plugin}
+			patch, summary, err := runner.RunSummary(c.Object, plugins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(summary, c.Summary) {
+				t.Errorf("unexpected summary %#v, want %#v", summary, c.Summary)
+			}
+			expected, _, err := runner.Run(c.Object, plugins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(patch) != string(expected) {
+				t.Errorf("patch %s differs from the one returned by Run %s", patch, expected)
+			}
+		})
+	}
+}
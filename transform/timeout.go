@@ -0,0 +1,65 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TimeoutPlugin bounds the time the caller waits for each run of inner to d.
+// A run exceeding it fails with an error wrapping context.DeadlineExceeded.
+//
+// Plugins implementing ContextPlugin are passed a context that is cancelled
+// once d elapses, so they can stop, as BinaryPlugin does by killing its
+// process. An in-process plugin ignoring its context cannot be stopped
+// though: its goroutine is abandoned and keeps running in the background,
+// with its eventual response discarded.
+func TimeoutPlugin(inner Plugin, d time.Duration) Plugin {
+	return &timeoutPlugin{inner: inner, timeout: d}
+}
+
+type timeoutPlugin struct {
+	inner   Plugin
+	timeout time.Duration
+}
+
+var _ ContextPlugin = &timeoutPlugin{}
+
+// String identifies the plugin by the plugin it wraps.
+func (t *timeoutPlugin) String() string {
+	return pluginName(t.inner)
+}
+
+func (t *timeoutPlugin) Run(u *unstructured.Unstructured) (PluginResponse, error) {
+	return t.RunContext(context.Background(), u)
+}
+
+func (t *timeoutPlugin) RunContext(ctx context.Context, u *unstructured.Unstructured) (PluginResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	type result struct {
+		resp PluginResponse
+		err  error
+	}
+	// Buffered so an abandoned run does not block forever on its result.
+	done := make(chan result, 1)
+	// An abandoned run must not keep using the caller's object.
+	object := u.DeepCopy()
+	go func() {
+		resp, err := runPluginContext(ctx, t.inner, object)
+		done <- result{resp, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.resp, r.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return PluginResponse{}, fmt.Errorf("plugin %q did not finish within %v: %w", pluginName(t.inner), t.timeout, ctx.Err())
+		}
+		return PluginResponse{}, ctx.Err()
+	}
+}
@@ -0,0 +1,69 @@
+package transform_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/konveyor/crane-lib/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type slowPlugin struct {
+	delay   time.Duration
+	release chan struct{}
+}
+
+func (s *slowPlugin) Run(u *unstructured.Unstructured) (transform.PluginResponse, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-s.release:
+	}
+	return transform.PluginResponse{Version: "v1"}, nil
+}
+
+func TestTimeoutPlugin(t *testing.T) {
+	u := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "ConfigMap",
+			"apiVersion": "v1",
+		},
+	}
+
+	t.Run("Fast", func(t *testing.T) {
+		p := transform.TimeoutPlugin(&labelPlugin{}, time.Minute)
+		resp, err := p.Run(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Patches) != 1 {
+			t.Errorf("expected the response of the wrapped plugin, got %v", resp)
+		}
+	})
+
+	t.Run("Slow", func(t *testing.T) {
+		slow := &slowPlugin{delay: time.Minute, release: make(chan struct{})}
+		// Let the abandoned run finish once the test is done.
+		defer close(slow.release)
+		p := transform.TimeoutPlugin(slow, 10*time.Millisecond)
+		start := time.Now()
+		_, err := p.Run(u)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a timeout error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("Run() returned after %v", elapsed)
+		}
+	})
+
+	t.Run("Runner", func(t *testing.T) {
+		slow := &slowPlugin{delay: time.Minute, release: make(chan struct{})}
+		defer close(slow.release)
+		r := transform.Runner{}
+		_, _, err := r.Run(*u, []transform.Plugin{transform.TimeoutPlugin(slow, 10*time.Millisecond)})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a timeout error, got %v", err)
+		}
+	})
+}
@@ -2,25 +2,91 @@ package types
 
 import (
 	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
-func IsPodSpecable(u unstructured.Unstructured) (*v1.PodTemplateSpec, bool) {
-	// Get Spec
-	spec, ok := u.UnstructuredContent()["spec"]
-	if !ok {
-		return nil, false
+// podSpecableKinds are the well known kinds that carry a pod template at
+// spec.template. CronJob is not included as its pod template is nested under
+// spec.jobTemplate.
+var podSpecableKinds = []schema.GroupKind{
+	{Group: "apps", Kind: "Deployment"},
+	{Group: "apps", Kind: "StatefulSet"},
+	{Group: "apps", Kind: "DaemonSet"},
+	{Group: "apps", Kind: "ReplicaSet"},
+	{Group: "", Kind: "ReplicationController"},
+	{Group: "batch", Kind: "Job"},
+}
+
+// defaultPodTemplatePath is where the pod template of the well known kinds,
+// and of kinds not registered with RegisterPodSpecableKind, is found.
+const defaultPodTemplatePath = "/spec/template"
+
+var (
+	registeredKindsLock sync.RWMutex
+	// registeredKinds maps the kinds registered with RegisterPodSpecableKind
+	// to the path of their pod template.
+	registeredKinds = map[schema.GroupKind]string{}
+)
+
+// RegisterPodSpecableKind records the JSON pointer to the pod template of a
+// third-party workload kind, such as "/spec/template" for Argo Rollouts, so
+// IsPodSpecable finds templates that are not at spec.template and the
+// transforms of pod templates apply to the kind. Registering a kind again
+// replaces its path.
+func RegisterPodSpecableKind(gk schema.GroupKind, templatePath string) {
+	registeredKindsLock.Lock()
+	defer registeredKindsLock.Unlock()
+	registeredKinds[gk] = templatePath
+}
+
+// PodTemplatePath returns the JSON pointer to the pod template of objects of
+// the kind.
+func PodTemplatePath(gk schema.GroupKind) string {
+	registeredKindsLock.RLock()
+	defer registeredKindsLock.RUnlock()
+	if path, ok := registeredKinds[gk]; ok {
+		return path
 	}
+	return defaultPodTemplatePath
+}
 
-	specMap, ok := spec.(map[string]interface{})
-	if !ok {
-		return nil, false
+// ListPodSpecableKinds returns the well known kinds that IsPodSpecable
+// recognizes, followed by the kinds registered with RegisterPodSpecableKind.
+// IsPodSpecable itself is not limited to these kinds, any object with a pod
+// template at spec.template is recognized.
+func ListPodSpecableKinds() []schema.GroupKind {
+	kinds := make([]schema.GroupKind, len(podSpecableKinds))
+	copy(kinds, podSpecableKinds)
+
+	registeredKindsLock.RLock()
+	defer registeredKindsLock.RUnlock()
+	registered := []schema.GroupKind{}
+	for gk := range registeredKinds {
+		known := false
+		for _, k := range podSpecableKinds {
+			known = known || k == gk
+		}
+		if !known {
+			registered = append(registered, gk)
+		}
 	}
+	sort.Slice(registered, func(i, j int) bool {
+		return registered[i].String() < registered[j].String()
+	})
+	return append(kinds, registered...)
+}
 
-	// Is template apart of the spec
-	templateInterface, ok := specMap["template"]
+// IsPodSpecable returns the pod template of objects that carry one at
+// spec.template, such as Deployments or Jobs, or at the path registered for
+// their kind with RegisterPodSpecableKind.
+func IsPodSpecable(u unstructured.Unstructured) (*v1.PodTemplateSpec, bool) {
+	templateInterface, _, ok := NestedPodTemplate(u)
 	if !ok {
 		return nil, false
 	}
@@ -41,3 +107,35 @@ func IsPodSpecable(u unstructured.Unstructured) (*v1.PodTemplateSpec, bool) {
 
 	return &template, true
 }
+
+// NestedPodTemplate returns the unstructured pod template of the object,
+// without copying it, along with its JSON pointer. Unlike IsPodSpecable, it
+// does not check that the template is a valid PodTemplateSpec.
+func NestedPodTemplate(u unstructured.Unstructured) (map[string]interface{}, string, bool) {
+	path := PodTemplatePath(u.GroupVersionKind().GroupKind())
+	template, ok := NestedPointer(u.Object, path)
+	if !ok {
+		return nil, "", false
+	}
+	templateMap, ok := template.(map[string]interface{})
+	if !ok {
+		return nil, "", false
+	}
+	return templateMap, path, true
+}
+
+// NestedPointer returns the value at the JSON pointer in obj, without
+// copying it. Pointers into arrays are not supported.
+func NestedPointer(obj map[string]interface{}, pointer string) (interface{}, bool) {
+	value, ok, err := unstructured.NestedFieldNoCopy(obj, pointerFields(pointer)...)
+	return value, ok && err == nil
+}
+
+// pointerFields splits a JSON pointer into its unescaped reference tokens.
+func pointerFields(pointer string) []string {
+	fields := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, field := range fields {
+		fields[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(field)
+	}
+	return fields
+}
@@ -2,6 +2,7 @@ package types_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/konveyor/crane-lib/transform/types"
@@ -9,6 +10,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func deploymentToUnstructured() unstructured.Unstructured {
@@ -124,3 +126,94 @@ func TestIsPodSpecable(t *testing.T) {
 	}
 
 }
+
+func TestListPodSpecableKinds(t *testing.T) {
+	kinds := types.ListPodSpecableKinds()
+	if len(kinds) == 0 {
+		t.Fatal("no pod specable kinds listed")
+	}
+	for _, gk := range kinds {
+		t.Run(gk.String(), func(t *testing.T) {
+			u := unstructured.Unstructured{Object: map[string]interface{}{}}
+			template := map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"image": "quay.io/test/image"},
+					},
+				},
+			}
+			fields := strings.Split(strings.TrimPrefix(types.PodTemplatePath(gk), "/"), "/")
+			if err := unstructured.SetNestedField(u.Object, template, fields...); err != nil {
+				t.Fatal(err)
+			}
+			u.SetGroupVersionKind(gk.WithVersion("v1"))
+			if _, ok := types.IsPodSpecable(u); !ok {
+				t.Errorf("%v is listed but not recognized as pod specable", gk)
+			}
+		})
+	}
+}
+
+func TestRegisterPodSpecableKind(t *testing.T) {
+	rollout := schema.GroupKind{Group: "argoproj.io", Kind: "Rollout"}
+	nested := schema.GroupKind{Group: "example.com", Kind: "NestedWorkload"}
+	types.RegisterPodSpecableKind(rollout, "/spec/template")
+	types.RegisterPodSpecableKind(nested, "/spec/workload/template")
+
+	template := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"image": "quay.io/test/image"},
+			},
+		},
+	}
+	cases := []struct {
+		Name          string
+		Kind          schema.GroupKind
+		Spec          map[string]interface{}
+		IsPodSpecable bool
+	}{
+		{
+			Name:          "Rollout",
+			Kind:          rollout,
+			Spec:          map[string]interface{}{"template": template},
+			IsPodSpecable: true,
+		},
+		{
+			Name:          "NestedTemplate",
+			Kind:          nested,
+			Spec:          map[string]interface{}{"workload": map[string]interface{}{"template": template}},
+			IsPodSpecable: true,
+		},
+		{
+			Name: "NestedKindWithDefaultPath",
+			Kind: nested,
+			Spec: map[string]interface{}{"template": template},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			u := unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"spec": runtime.DeepCopyJSONValue(c.Spec),
+				},
+			}
+			u.SetGroupVersionKind(c.Kind.WithVersion("v1"))
+			podTemplate, ok := types.IsPodSpecable(u)
+			if ok != c.IsPodSpecable {
+				t.Fatalf("podSpecable is not correct, actual: %v, expected: %v", ok, c.IsPodSpecable)
+			}
+			if ok && podTemplate.Spec.Containers[0].Image != "quay.io/test/image" {
+				t.Errorf("unexpected pod template: %v", podTemplate)
+			}
+		})
+	}
+
+	listed := map[schema.GroupKind]bool{}
+	for _, gk := range types.ListPodSpecableKinds() {
+		listed[gk] = true
+	}
+	if !listed[rollout] || !listed[nested] {
+		t.Errorf("registered kinds not listed: %v", types.ListPodSpecableKinds())
+	}
+}
@@ -0,0 +1,33 @@
+package types
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	imagePathsLock sync.RWMutex
+	// imagePaths maps the kinds registered with RegisterImagePath to the
+	// JSON pointers to their images.
+	imagePaths = map[schema.GroupKind][]string{}
+)
+
+// RegisterImagePath records the JSON pointers to the image references of a
+// kind whose images are not in a pod template, such as the spec.image of an
+// operator's custom resource, so image transforms like RegistryReplacement
+// reach them. Each pointer may refer to a single image or to an array of
+// images. Registering a kind again replaces its pointers.
+func RegisterImagePath(gk schema.GroupKind, jsonPointers []string) {
+	imagePathsLock.Lock()
+	defer imagePathsLock.Unlock()
+	imagePaths[gk] = append([]string{}, jsonPointers...)
+}
+
+// ImagePaths returns the JSON pointers registered for the kind with
+// RegisterImagePath.
+func ImagePaths(gk schema.GroupKind) []string {
+	imagePathsLock.RLock()
+	defer imagePathsLock.RUnlock()
+	return append([]string{}, imagePaths[gk]...)
+}
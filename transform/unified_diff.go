@@ -0,0 +1,52 @@
+package transform
+
+import (
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// diffContext is the number of unchanged lines shown around the changes of a
+// unified diff.
+const diffContext = 3
+
+// UnifiedDiff applies the patch returned by the Runner to a copy of the
+// object and returns a unified diff of the object's YAML before and after,
+// for showing what a transform changes. It returns an empty string when the
+// patch does not change the object.
+func UnifiedDiff(original unstructured.Unstructured, patch []byte) (string, error) {
+	before, err := yaml.Marshal(original.Object)
+	if err != nil {
+		return "", err
+	}
+	after := before
+	if len(patch) > 0 {
+		patched, err := applyPatch(*original.DeepCopy(), patch)
+		if err != nil {
+			return "", err
+		}
+		after, err = yaml.JSONToYAML(patched)
+		if err != nil {
+			return "", err
+		}
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(string(before)),
+		B:        splitLines(string(after)),
+		FromFile: "original",
+		ToFile:   "transformed",
+		Context:  diffContext,
+		Eol:      "\n",
+	})
+}
+
+// splitLines splits s into lines, keeping their line endings.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,116 @@
+package transform_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/transform/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	deployment := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":        "frontend",
+				"annotations": map[string]interface{}{"owner": "team-a"},
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(2),
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name":  "frontend",
+								"image": "quay.io/konveyor/frontend:latest",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	runner := transform.Runner{}
+	patch, _, err := runner.Run(deployment, []transform.Plugin{
+		&kubernetes.KubernetesTransformPlugin{
+			RegistryReplacement: map[string]string{"quay.io": "registry.example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := transform.UnifiedDiff(deployment, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `--- original
++++ transformed
+@@ -9,5 +9,5 @@
+   template:
+     spec:
+       containers:
+-      - image: quay.io/konveyor/frontend:latest
++      - image: registry.example.com/konveyor/frontend:latest
+         name: frontend
+`
+	if diff != expected {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", diff, expected)
+	}
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	if image := containers[0].(map[string]interface{})["image"]; !strings.HasPrefix(image.(string), "quay.io/") {
+		t.Errorf("the original object was modified, image: %v", image)
+	}
+
+	diff, err = transform.UnifiedDiff(deployment, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Errorf("expected no diff without a patch, got:\n%s", diff)
+	}
+}
+
+func TestUnifiedDiffWithoutAnnotations(t *testing.T) {
+	service := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]interface{}{
+				"name": "frontend",
+			},
+			"spec": map[string]interface{}{
+				"clusterIP": "172.30.12.4",
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(80)},
+				},
+			},
+		},
+	}
+
+	runner := transform.Runner{}
+	patch, _, err := runner.Run(service, []transform.Plugin{&kubernetes.KubernetesTransformPlugin{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := transform.UnifiedDiff(service, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `--- original
++++ transformed
+@@ -3,6 +3,5 @@
+ metadata:
+   name: frontend
+ spec:
+-  clusterIP: 172.30.12.4
+   ports:
+   - port: 80
+`
+	if diff != expected {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", diff, expected)
+	}
+}
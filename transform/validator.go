@@ -0,0 +1,120 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Validator checks the objects resulting from applying the transforms, e.g.
+// against the schema the destination API server enforces.
+type Validator interface {
+	Validate(obj unstructured.Unstructured) error
+}
+
+// Schema is the subset of an OpenAPI v3 structural schema, as found in the
+// openAPIV3Schema of CustomResourceDefinitions, used by SchemaValidator.
+type Schema struct {
+	Type         string             `json:"type,omitempty"`
+	Properties   map[string]*Schema `json:"properties,omitempty"`
+	Items        *Schema            `json:"items,omitempty"`
+	Required     []string           `json:"required,omitempty"`
+	Nullable     bool               `json:"nullable,omitempty"`
+	XIntOrString bool               `json:"x-kubernetes-int-or-string,omitempty"`
+}
+
+// SchemaValidator validates objects against the schema of their kind.
+// Objects of kinds without a schema are accepted.
+type SchemaValidator map[schema.GroupVersionKind]*Schema
+
+func (v SchemaValidator) Validate(obj unstructured.Unstructured) error {
+	s, ok := v[obj.GroupVersionKind()]
+	if !ok {
+		return nil
+	}
+	return validateValue(s, obj.Object, nil).ToAggregate()
+}
+
+// validateValue checks the type of value and, recursively, of the values it
+// holds. Fields without a schema are not validated.
+func validateValue(s *Schema, value interface{}, path *field.Path) field.ErrorList {
+	if s == nil {
+		return nil
+	}
+	if value == nil {
+		if s.Nullable {
+			return nil
+		}
+		return field.ErrorList{field.Invalid(path, value, "must not be null")}
+	}
+	if s.XIntOrString {
+		switch value.(type) {
+		case string, int64, float64:
+			return nil
+		}
+		return field.ErrorList{field.Invalid(path, value, "must be an integer or a string")}
+	}
+
+	errs := field.ErrorList{}
+	switch s.Type {
+	case "object":
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return field.ErrorList{field.Invalid(path, value, "must be an object")}
+		}
+		for _, name := range s.Required {
+			if _, ok := m[name]; !ok {
+				errs = append(errs, field.Required(path.Child(name), ""))
+			}
+		}
+		// Validate the properties in a stable order so the errors are too.
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			errs = append(errs, validateValue(s.Properties[name], m[name], path.Child(name))...)
+		}
+	case "array":
+		a, ok := value.([]interface{})
+		if !ok {
+			return field.ErrorList{field.Invalid(path, value, "must be an array")}
+		}
+		for i, item := range a {
+			errs = append(errs, validateValue(s.Items, item, path.Index(i))...)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			errs = append(errs, field.Invalid(path, value, "must be a string"))
+		}
+	case "integer":
+		switch n := value.(type) {
+		case int64:
+		case float64:
+			if n != float64(int64(n)) {
+				errs = append(errs, field.Invalid(path, value, "must be an integer"))
+			}
+		default:
+			errs = append(errs, field.Invalid(path, value, "must be an integer"))
+		}
+	case "number":
+		switch value.(type) {
+		case int64, float64:
+		default:
+			errs = append(errs, field.Invalid(path, value, "must be a number"))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs = append(errs, field.Invalid(path, value, "must be a boolean"))
+		}
+	case "":
+		// Untyped schemas accept any value.
+	default:
+		errs = append(errs, field.InternalError(path, fmt.Errorf("unsupported schema type %q", s.Type)))
+	}
+	return errs
+}
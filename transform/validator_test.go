@@ -0,0 +1,93 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	validator := SchemaValidator{
+		gvk: {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"spec": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"size":   {Type: "integer"},
+						"port":   {XIntOrString: true},
+						"paused": {Type: "boolean"},
+						"tags": {
+							Type:  "array",
+							Items: &Schema{Type: "string"},
+						},
+					},
+				},
+			},
+		},
+	}
+	object := func(spec map[string]interface{}) unstructured.Unstructured {
+		return unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "example.com/v1",
+				"kind":       "Widget",
+				"spec":       spec,
+			},
+		}
+	}
+
+	cases := []struct {
+		Name   string
+		Object unstructured.Unstructured
+		Error  string
+	}{
+		{
+			Name: "Valid",
+			Object: object(map[string]interface{}{
+				"size":   int64(3),
+				"port":   "http",
+				"paused": false,
+				"tags":   []interface{}{"a", "b"},
+				"extra":  "not in the schema",
+			}),
+		},
+		{
+			Name:   "IntegerAsString",
+			Object: object(map[string]interface{}{"size": "3"}),
+			Error:  "spec.size",
+		},
+		{
+			Name:   "InvalidArrayItem",
+			Object: object(map[string]interface{}{"tags": []interface{}{"a", int64(1)}}),
+			Error:  "spec.tags[1]",
+		},
+		{
+			Name: "KindWithoutSchema",
+			Object: unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "ConfigMap",
+					"data":       "not an object",
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			err := validator.Validate(c.Object)
+			if c.Error == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("expected an error for %v, got %v", c.Error, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+// preserveYAMLOrder encodes the transformed JSON document as YAML, ordering
+// the keys of every mapping like in the original YAML document instead of
+// sorting them, so transformed manifests only differ from the original where
+// the transform changed them. Keys the original lacks are sorted after the
+// others. Comments of the original are not preserved.
+func preserveYAMLOrder(original, transformedJSON []byte) ([]byte, error) {
+	// Decoding into a MapSlice decodes the nested mappings as MapSlices too,
+	// which keep the order of their keys.
+	originalDoc := yamlv2.MapSlice{}
+	if err := yamlv2.Unmarshal(original, &originalDoc); err != nil {
+		return nil, err
+	}
+	var transformed interface{}
+	if err := yamlv2.Unmarshal(transformedJSON, &transformed); err != nil {
+		return nil, err
+	}
+	return yamlv2.Marshal(orderLike(transformed, originalDoc))
+}
+
+// orderLike converts the mappings of value to MapSlices ordered like the
+// corresponding mappings of original. Sequence items are matched by index.
+func orderLike(value, original interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		originalMap, _ := original.(yamlv2.MapSlice)
+		ordered := yamlv2.MapSlice{}
+		seen := map[interface{}]bool{}
+		for _, originalItem := range originalMap {
+			if item, ok := v[originalItem.Key]; ok {
+				seen[originalItem.Key] = true
+				ordered = append(ordered, yamlv2.MapItem{Key: originalItem.Key, Value: orderLike(item, originalItem.Value)})
+			}
+		}
+		added := yamlv2.MapSlice{}
+		for key, item := range v {
+			if !seen[key] {
+				added = append(added, yamlv2.MapItem{Key: key, Value: orderLike(item, nil)})
+			}
+		}
+		sort.Slice(added, func(i, j int) bool {
+			return fmt.Sprint(added[i].Key) < fmt.Sprint(added[j].Key)
+		})
+		return append(ordered, added...)
+	case []interface{}:
+		originalItems, _ := original.([]interface{})
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			var originalItem interface{}
+			if i < len(originalItems) {
+				originalItem = originalItems[i]
+			}
+			items[i] = orderLike(item, originalItem)
+		}
+		return items
+	}
+	return value
+}